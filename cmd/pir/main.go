@@ -0,0 +1,155 @@
+// Command pir serves a database file over gRPC and privately retrieves entries from it.
+//
+//	pir serve --db file.bin [--addr :50051]
+//	pir get --addr host:port --index N [--state pir.state] [--dbsize N]
+//
+// The database file holds the entries, each 8 bytes in little-endian order. get runs the setup phase once,
+// which downloads the database and needs its size, and saves the client state to the state file. Later
+// invocations load the state and only send the punctured query of the index.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+
+	"example.com/piano"
+	"example.com/piano/pirserver"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("pir: ")
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "serve":
+		err = serve(os.Args[2:])
+	case "get":
+		err = get(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: pir serve --db file.bin [--addr :50051]")
+	fmt.Fprintln(os.Stderr, "       pir get --addr host:port --index N [--state pir.state] [--dbsize N]")
+	os.Exit(2)
+}
+
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	dbPath := flags.String("db", "", "database file, 8 bytes per entry in little-endian order")
+	addr := flags.String("addr", ":50051", "address to listen on")
+	flags.Parse(args)
+	if *dbPath == "" {
+		return fmt.Errorf("serve: --db is required")
+	}
+
+	f, err := os.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 || info.Size()%8 != 0 {
+		return fmt.Errorf("serve: %s has %d bytes, want a positive multiple of 8", *dbPath, info.Size())
+	}
+	server, err := piano.NewServerFromReader(f, uint64(info.Size()/8))
+	if err != nil {
+		return fmt.Errorf("serve: %w", err)
+	}
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	// the actual address, in case the port was 0
+	fmt.Printf("serving %d entries on %s\n", server.DBSize, lis.Addr())
+	return pirserver.NewGRPCServer(server).Serve(lis)
+}
+
+func get(args []string) error {
+	flags := flag.NewFlagSet("get", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:50051", "address of the server")
+	index := flags.Uint64("index", 0, "index to retrieve")
+	statePath := flags.String("state", "pir.state", "file the client state is kept in between invocations")
+	dbSize := flags.Uint64("dbsize", 0, "number of entries of the database, needed for the first invocation")
+	flags.Parse(args)
+
+	remote, err := pirserver.Dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	state, err := loadState(*statePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		if *dbSize == 0 {
+			return fmt.Errorf("get: no state in %s, --dbsize is required for the setup", *statePath)
+		}
+		db, err := remote.Download(*dbSize)
+		if err != nil {
+			return fmt.Errorf("get: setup: %w", err)
+		}
+		state = piano.NewClient(*dbSize).InitializeState(db)
+	} else if err != nil {
+		return fmt.Errorf("get: loading %s: %w", *statePath, err)
+	}
+
+	if *index >= state.DBSize {
+		return fmt.Errorf("get: index %d out of range, DBSize is %d", *index, state.DBSize)
+	}
+	answer, err := state.Retrieve(*index, remote)
+	// a failed retrieval can still have consumed hints, so the state is saved either way
+	if saveErr := saveState(*statePath, state); saveErr != nil {
+		return fmt.Errorf("get: saving %s: %w", *statePath, saveErr)
+	}
+	if err != nil {
+		if remoteErr := remote.Err(); remoteErr != nil {
+			return fmt.Errorf("get: %w", remoteErr)
+		}
+		return fmt.Errorf("get: %w", err)
+	}
+	fmt.Println(answer)
+	return nil
+}
+
+func loadState(path string) (*piano.ClientState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return piano.LoadClientState(f)
+}
+
+// saveState writes the state to a temporary file first, so a crash never leaves a truncated state behind.
+func saveState(path string, state *piano.ClientState) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := state.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestServeAndGet builds the binary, serves a database file with it and retrieves entries in later
+// invocations that share the client state.
+func TestServeAndGet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and runs the binary")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "pir")
+	if out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+
+	const DBSize = 1000
+	raw := make([]byte, 8*DBSize)
+	for i := 0; i < DBSize; i++ {
+		binary.LittleEndian.PutUint64(raw[8*i:], uint64(i)*31+7)
+	}
+	dbPath := filepath.Join(dir, "db.bin")
+	if err := os.WriteFile(dbPath, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := exec.Command(bin, "serve", "--db", dbPath, "--addr", "127.0.0.1:0")
+	stdout, err := serve.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serve.Start(); err != nil {
+		t.Fatalf("pir serve: %v", err)
+	}
+	defer serve.Process.Kill()
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading the address of pir serve: %v", err)
+	}
+	fields := strings.Fields(line)
+	addr := fields[len(fields)-1]
+
+	statePath := filepath.Join(dir, "pir.state")
+	for k, x := range []uint64{5, 999, 5, 123} {
+		args := []string{"get", "--addr", addr, "--index", strconv.FormatUint(x, 10), "--state", statePath}
+		if k == 0 {
+			args = append(args, "--dbsize", strconv.Itoa(DBSize))
+		}
+		out, err := exec.Command(bin, args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("pir get %d: %v\n%s", x, err, out)
+		}
+		if got := strings.TrimSpace(string(out)); got != strconv.FormatUint(x*31+7, 10) {
+			t.Fatalf("pir get %d: got %q, want %d", x, got, x*31+7)
+		}
+	}
+
+	// without a state the setup needs the database size
+	args := []string{"get", "--addr", addr, "--index", "1", "--state", filepath.Join(dir, "other.state")}
+	if out, err := exec.Command(bin, args...).CombinedOutput(); err == nil {
+		t.Fatalf("pir get without a state and --dbsize succeeded: %s", out)
+	}
+}
@@ -2,11 +2,14 @@ module easypir
 
 go 1.20
 
+replace example.com/piano => ./piano
+
 replace example.com/query => ./query
 
 replace example.com/util => ./util
 
 require (
+	example.com/piano v0.0.0-00010101000000-000000000000
 	example.com/query v0.0.0-00010101000000-000000000000
 	example.com/util v0.0.0-00010101000000-000000000000
 	google.golang.org/grpc v1.53.0
@@ -0,0 +1,223 @@
+package piano
+
+import (
+	"fmt"
+	"testing"
+)
+
+var benchDBSizes = []uint64{10000, 100000, 1000000}
+
+type benchSetup struct {
+	server Server
+	state  *ClientState
+}
+
+// benchSetups caches the setup of every size, since it dominates the other benchmarks.
+var benchSetups = map[uint64]benchSetup{}
+
+func getBenchSetup(DBSize uint64) benchSetup {
+	if setup, ok := benchSetups[DBSize]; ok {
+		return setup
+	}
+	server := NewServerWithSeed(DBSize, 1)
+	state := NewClient(DBSize).InitializeStateWithSeed(server, 2)
+	benchSetups[DBSize] = benchSetup{server, state}
+	return benchSetups[DBSize]
+}
+
+// nextQuery returns a query that can be recovered, starting over from a clone of the setup when
+// the backup hints of the queried chunk are exhausted.
+func nextQuery(setup benchSetup, state **ClientState) ClientQuery {
+	for {
+		query, err := (*state).TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		if (*state).consumedHintNum[query.chunkId] >= (*state).config.M2 {
+			*state = setup.state.Clone()
+			continue
+		}
+		return query
+	}
+}
+
+func BenchmarkInitializeState(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			server := NewServerWithSeed(DBSize, 1)
+			client := NewClient(DBSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				client.InitializeStateWithSeed(server, 2)
+			}
+		})
+	}
+}
+
+func BenchmarkInitializeStateParallel(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			server := NewServerWithSeed(DBSize, 1)
+			client := NewClient(DBSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				client.InitializeStateParallelWithSeed(server, 0, 2)
+			}
+		})
+	}
+}
+
+func BenchmarkPrepare(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			setup := getBenchSetup(DBSize)
+			state := setup.state.Clone()
+			query := nextQuery(setup, &state)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				query.Prepare()
+			}
+		})
+	}
+}
+
+// benchHitIds returns n primary hint ids to prepare a batch of queries for.
+func benchHitIds(state *ClientState, n int) []uint64 {
+	hitIds := make([]uint64, n)
+	for k := range hitIds {
+		hitIds[k] = uint64(k) * state.config.M1 / uint64(n)
+	}
+	return hitIds
+}
+
+func BenchmarkAllOffsets(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			state := getBenchSetup(DBSize).state.Clone()
+			hitIds := benchHitIds(state, 64)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				state.AllOffsets(hitIds)
+			}
+		})
+	}
+}
+
+// compare with BenchmarkAllOffsets
+func BenchmarkPrepareBatch(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			state := getBenchSetup(DBSize).state.Clone()
+			hitIds := benchHitIds(state, 64)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, hitId := range hitIds {
+					state.buildQuery(0, hitId).Prepare()
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkProcess(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			server := NewServerWithSeed(DBSize, 1)
+			offsetVec := randomOffsetVec(server, 2)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				server.Process(offsetVec)
+			}
+		})
+	}
+}
+
+func BenchmarkProcessFast(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			server := NewServerWithSeed(DBSize, 1)
+			precompute := server.BuildPrecompute()
+			offsetVec := randomOffsetVec(server, 2)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				server.ProcessFast(precompute, offsetVec)
+			}
+		})
+	}
+}
+
+func BenchmarkProcessInto(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			server := NewServerWithSeed(DBSize, 1)
+			offsetVec := randomOffsetVec(server, 2)
+			out := make([]uint64, server.ChunkNum)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				server.ProcessInto(offsetVec, out)
+			}
+		})
+	}
+}
+
+// hintBatch returns the offset vectors of one primary hint punctured at size different chunks.
+func hintBatch(setup benchSetup, size int) [][]uint64 {
+	offsetVec := setup.state.AllOffsets([]uint64{0})[0]
+	batch := make([][]uint64, size)
+	for k := range batch {
+		batch[k] = ClientQuery{offsetVec: offsetVec, chunkId: uint64(k) * setup.state.ChunkNum / uint64(size)}.Prepare()
+	}
+	return batch
+}
+
+// compare with BenchmarkProcessManyIndependent
+func BenchmarkProcessMany(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			setup := getBenchSetup(DBSize)
+			batch := hintBatch(setup, 16)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				setup.server.ProcessMany(batch)
+			}
+		})
+	}
+}
+
+func BenchmarkProcessManyIndependent(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			setup := getBenchSetup(DBSize)
+			batch := hintBatch(setup, 16)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, offsetVec := range batch {
+					setup.server.Process(offsetVec)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRecoverAnswer(b *testing.B) {
+	for _, DBSize := range benchDBSizes {
+		b.Run(fmt.Sprint(DBSize), func(b *testing.B) {
+			setup := getBenchSetup(DBSize)
+			state := setup.state.Clone()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				query := nextQuery(setup, &state)
+				parities := setup.server.Process(query.Prepare())
+				b.StartTimer()
+				if _, err := state.RecoverAnswer(query, parities); err != nil {
+					b.Fatalf("RecoverAnswer: %v", err)
+				}
+			}
+		})
+	}
+}
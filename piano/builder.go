@@ -0,0 +1,99 @@
+package piano
+
+import (
+	"context"
+	"time"
+)
+
+// ClientBuilder configures a client and runs its setup phase, for callers that need more than the defaults of
+// NewClient. The With methods return the builder, so that calls can be chained. A builder can build several
+// states; each Build samples its hints anew unless WithSeed fixed the seed.
+type ClientBuilder struct {
+	client    Client
+	hasParams bool
+	seed      int64
+	hasSeed   bool
+	mode      FailureMode
+	capacity  int
+	err       error // the first error of a With method, returned by Build
+}
+
+// NewClientBuilder returns a builder with the defaults of NewClient and InitializeState.
+func NewClientBuilder() *ClientBuilder {
+	return &ClientBuilder{}
+}
+
+// WithSeed samples the hints and the random queries from seed, as InitializeStateWithSeed does.
+func (b *ClientBuilder) WithSeed(seed int64) *ClientBuilder {
+	b.seed, b.hasSeed = seed, true
+	return b
+}
+
+// WithParams sets the parameters of NewClientWithParams instead of the defaults for the database.
+func (b *ClientBuilder) WithParams(Q, M1, M2 uint64) *ClientBuilder {
+	client, err := NewClientWithParams(Q, M1, M2)
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	client.DisableCache, client.PRF = b.client.DisableCache, b.client.PRF
+	b.client, b.hasParams = client, true
+	return b
+}
+
+// WithFailureMode sets what Retrieve does when backup hints run out, see ClientState.SetFailureMode.
+func (b *ClientBuilder) WithFailureMode(mode FailureMode) *ClientBuilder {
+	b.mode = mode
+	return b
+}
+
+// WithPRF selects the PRF of the hint keys.
+func (b *ClientBuilder) WithPRF(prf PRF) *ClientBuilder {
+	b.client.PRF = prf
+	return b
+}
+
+// WithCacheCapacity bounds the local cache, see ClientState.SetCacheCapacity.
+func (b *ClientBuilder) WithCacheCapacity(capacity int) *ClientBuilder {
+	b.capacity = capacity
+	return b
+}
+
+// WithoutCache turns the local cache off, see Client.DisableCache.
+func (b *ClientBuilder) WithoutCache() *ClientBuilder {
+	b.client.DisableCache = true
+	return b
+}
+
+// Build runs the setup phase against server with the configured options. Without WithParams the parameters are
+// the defaults for the database, including its chunk boundaries. It returns the first error of the With methods,
+// if any, or the error of the setup.
+func (b *ClientBuilder) Build(server Server) (*ClientState, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	client := b.client
+	if !b.hasParams {
+		defaults := NewClient(server.DBSize)
+		if server.Boundaries != nil {
+			var err error
+			if defaults, err = NewClientWithBoundaries(server.Boundaries); err != nil {
+				return nil, err
+			}
+		}
+		client.Q, client.M1, client.M2 = defaults.Q, defaults.M1, defaults.M2
+	}
+	client.Boundaries = server.Boundaries
+	seed := b.seed
+	if !b.hasSeed {
+		seed = time.Now().UnixNano()
+	}
+	state, err := client.initializeState(context.Background(), server, seed, 1)
+	if err != nil {
+		return nil, err
+	}
+	state.SetFailureMode(b.mode)
+	if b.capacity > 0 {
+		state.SetCacheCapacity(b.capacity)
+	}
+	return state, nil
+}
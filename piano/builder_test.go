@@ -0,0 +1,69 @@
+package piano
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestClientBuilder(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+
+	// the same seed gives the same hints as InitializeStateWithSeed
+	state, err := NewClientBuilder().WithSeed(2).Build(server)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	want := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+	if !reflect.DeepEqual(state.primaryHints, want.primaryHints) || !reflect.DeepEqual(state.backupHints, want.backupHints) {
+		t.Fatalf("Build with a seed gives different hints than InitializeStateWithSeed")
+	}
+
+	// custom parameters with few backup hints, refreshed when they run out
+	state, err = NewClientBuilder().WithParams(100, 4000, 2).WithFailureMode(FailRefresh).WithPRF(PRFSHA256).Build(server)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if state.config.M1 != 4000 || state.config.M2 != 2 || state.config.PRF != PRFSHA256 {
+		t.Fatalf("Build ignored the options: %+v", state.config)
+	}
+	for i := uint64(0); i < 5; i++ {
+		x := 17 + i*server.ChunkSize/10
+		if answer, err := state.Retrieve(x, server); err != nil || answer != server.Query(x) {
+			t.Fatalf("Retrieve(%d) = %d, %v, want %d", x, answer, err, server.Query(x))
+		}
+	}
+
+	// the SHA-256 PRF places the hints elsewhere
+	sha, err := NewClientBuilder().WithSeed(2).WithPRF(PRFSHA256).Build(server)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if sha.Elem(&sha.primaryHints[0], 1) == want.Elem(&want.primaryHints[0], 1) && sha.Elem(&sha.primaryHints[0], 2) == want.Elem(&want.primaryHints[0], 2) {
+		t.Fatalf("PRFSHA256 gives the same hint elements as PRFAES")
+	}
+
+	// a bounded cache, and no cache at all
+	state, err = NewClientBuilder().WithCacheCapacity(2).Build(server)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	uncached, err := NewClientBuilder().WithoutCache().Build(server)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	for _, x := range []uint64{1, 2, 3} {
+		state.Retrieve(x, server)
+		uncached.Retrieve(x, server)
+	}
+	if len(state.localCache) != 2 || len(uncached.localCache) != 0 {
+		t.Fatalf("%d cached entries with capacity 2, %d without a cache", len(state.localCache), len(uncached.localCache))
+	}
+
+	if _, err := NewClientBuilder().WithParams(100, 0, 1).Build(server); err == nil {
+		t.Fatalf("Build: expected an error for M1 0")
+	}
+	if _, err := NewClientBuilder().Build(Server{}); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("Build of an empty database: got %v, want ErrEmptyDatabase", err)
+	}
+}
@@ -0,0 +1,1572 @@
+package piano
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+
+	"example.com/util"
+)
+
+var (
+	// ErrHintsExhausted is returned when the queried chunk has no backup hints left.
+	ErrHintsExhausted = errors.New("not enough backup hints")
+	// ErrNoHint is returned when no primary hint contains the queried index.
+	ErrNoHint = errors.New("cannot find the hitId")
+	// ErrAlreadyCached is returned by QueryIndex for an index in the local cache; read it with Cached instead.
+	ErrAlreadyCached = errors.New("index is already in the local cache")
+	// ErrMalformedResponse is returned when the server's response does not have ChunkNum parities.
+	ErrMalformedResponse = errors.New("malformed server response")
+	// ErrMalformedQuery is returned by Server.CheckOffsetVec for an offset vector with the wrong number of offsets
+	// or an offset out of range.
+	ErrMalformedQuery = errors.New("malformed offset vector")
+	// ErrStaleQuery is returned when the primary hint of a query was consumed by another query.
+	ErrStaleQuery = errors.New("the hint of the query was already consumed")
+	// ErrIntegrity is returned when a recovered record does not match its checksum.
+	ErrIntegrity = errors.New("recovered record fails the integrity check")
+	// ErrInconsistent is returned by RecoverAnswerRobust when no majority of the replicas agrees on the answer.
+	ErrInconsistent = errors.New("the replicas do not agree on the answer")
+	// ErrKeyNotFound is returned by KVClient.Get for a key that is not in the database.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrStaleHints is returned when the server answered from another Version of the database than the hints of
+	// the client were computed for; the client has to rerun the setup phase or apply the missed updates.
+	ErrStaleHints = errors.New("hints are stale for the server version")
+	// ErrCacheSaturated is returned by TryRandomQuery when nearly every index is in the local cache, so that there is
+	// hardly an index left to sample.
+	ErrCacheSaturated = errors.New("the local cache holds nearly every index")
+	// ErrEmptyDatabase is returned, or panicked with by the constructors without an error, for a database of
+	// DBSize 0, which has neither chunks nor indices.
+	ErrEmptyDatabase = errors.New("empty database")
+)
+
+// retrieveAttempts caps how many queries Retrieve sends for an index that no primary hint contains.
+const retrieveAttempts = 8
+
+// cacheSaturation is the share of uncached indices, one in cacheSaturation, below which a random query fails with
+// ErrCacheSaturated instead of resampling. sampleAttempts bounds the resampling above it; it fails with probability
+// (1-1/cacheSaturation)^sampleAttempts, which is negligible.
+const (
+	cacheSaturation = 32
+	sampleAttempts  = 2048
+)
+
+// noHit marks that no primary hint contains the queried index.
+const noHit = ^uint64(0)
+
+// Client holds the query and hint parameters.
+type Client struct {
+	Q  uint64 // number of queries supported by one setup
+	M1 uint64 // number of primary hints
+	M2 uint64 // number of backup hints per chunk
+
+	PerChunkM2 []uint64 // number of backup hints of every chunk, overrides M2 if set
+
+	// the window [RangeStart, RangeEnd) of the database the client queries, see NewClientForRange;
+	// RangeEnd 0 means the whole database
+	RangeStart uint64
+	RangeEnd   uint64
+
+	// DisableCache turns the local cache off: answers are not kept, so every query and every Retrieve of an
+	// index, even a repeated one, goes to the server, and random queries are uniform over all indices instead
+	// of the ones not cached yet. This keeps the access pattern exactly uniform at the cost of a query and a
+	// backup hint for every repeated read.
+	DisableCache bool
+
+	// Boundaries are the chunk boundaries of a Server from NewServerWithBoundaries, see NewClientWithBoundaries;
+	// nil for the default chunking
+	Boundaries []uint64
+
+	PRF PRF // the PRF that places the hints in the chunks
+}
+
+// PRF selects the pseudorandom function of the hint keys.
+type PRF int
+
+const (
+	// PRFAES is util.PRFEval, AES-128 in Matyas-Meyer-Oseas mode. This is the default.
+	PRFAES PRF = iota
+	// PRFSHA256 is util.PRFEvalSHA256, which is slower but does not need the AES instructions.
+	PRFSHA256
+)
+
+// NewClient derives the default parameters for a database with DBSize entries.
+func NewClient(DBSize uint64) Client {
+	if DBSize == 0 {
+		// the setup phase fails with ErrEmptyDatabase anyway
+		return Client{Q: 1, M1: 1, M2: 1}
+	}
+	Q := uint64(math.Sqrt(float64(DBSize)) * math.Log(float64(DBSize)))
+	M1 := 4 * uint64(math.Sqrt(float64(DBSize))*math.Log(float64(DBSize)))
+	M2 := 4 * uint64(math.Log(float64(DBSize)))
+	// the formulas are 0 for tiny databases, but every query needs a primary and a backup hint
+	if Q < 1 {
+		Q = 1
+	}
+	if M1 < 1 {
+		M1 = 1
+	}
+	if M2 < 1 {
+		M2 = 1
+	}
+	return Client{Q: Q, M1: M1, M2: M2}
+}
+
+// NewClientWithParams returns a Client with the given parameters instead of the default formulas.
+// Q is the number of queries the caller plans to make. With too few primary hints (M1) a query is
+// more likely to find no hint containing its index (ErrNoHint); with too few backup hints per chunk
+// (M2) a chunk that is queried more than M2 times returns ErrHintsExhausted. The defaults keep both
+// probabilities negligible for Q queries; Validate checks a custom choice.
+func NewClientWithParams(Q uint64, M1 uint64, M2 uint64) (Client, error) {
+	if M1 == 0 || M2 == 0 {
+		return Client{}, fmt.Errorf("M1 and M2 must be positive, got M1 %d, M2 %d", M1, M2)
+	}
+	return Client{Q: Q, M1: M1, M2: M2}, nil
+}
+
+// NewClientWithPerChunkBackups is like NewClientWithParams, but chunk i gets backups[i] backup hints, so
+// chunks that are queried more often can get more of them. backups must have an entry for every chunk of
+// the database passed to InitializeState.
+func NewClientWithPerChunkBackups(Q uint64, M1 uint64, backups []uint64) (Client, error) {
+	if M1 == 0 || len(backups) == 0 {
+		return Client{}, fmt.Errorf("M1 and the number of chunks must be positive, got M1 %d, %d chunks", M1, len(backups))
+	}
+	for i, m := range backups {
+		if m == 0 {
+			return Client{}, fmt.Errorf("chunk %d has no backup hints", i)
+		}
+	}
+	return Client{Q: Q, M1: M1, PerChunkM2: append([]uint64(nil), backups...)}, nil
+}
+
+// NewClientForRange returns a Client with the default parameters for the rangeEnd-rangeStart entries of the
+// window [rangeStart, rangeEnd) of a database. Its InitializeState only downloads the window and its hints only
+// cover it, so the setup cost and the client storage scale with the window. Queries take indices of the whole
+// database and fail for an index outside the window. The server needs to answer them on the window, see
+// Server.Window, and it learns the window, only the index within it stays private.
+func NewClientForRange(rangeStart, rangeEnd uint64) (Client, error) {
+	if rangeStart >= rangeEnd {
+		return Client{}, fmt.Errorf("empty range [%d, %d)", rangeStart, rangeEnd)
+	}
+	c := NewClient(rangeEnd - rangeStart)
+	c.RangeStart, c.RangeEnd = rangeStart, rangeEnd
+	return c, nil
+}
+
+// backupStarts returns, for a database with ChunkNum chunks, where the backup hints of every chunk start
+// in the backup hints of a ClientState. The last entry is the total number of backup hints.
+func (c Client) backupStarts(ChunkNum uint64) []uint64 {
+	if c.PerChunkM2 != nil && uint64(len(c.PerChunkM2)) != ChunkNum {
+		panic(fmt.Sprintf("piano: %d per-chunk backup counts for %d chunks", len(c.PerChunkM2), ChunkNum))
+	}
+	starts := make([]uint64, ChunkNum+1)
+	for i := uint64(0); i < ChunkNum; i++ {
+		m := c.M2
+		if c.PerChunkM2 != nil {
+			m = c.PerChunkM2[i]
+		}
+		starts[i+1] = starts[i] + m
+	}
+	return starts
+}
+
+// maxFailureProbability is the highest probability of a failed query in Q queries that Validate accepts.
+const maxFailureProbability = 0.01
+
+// Validate checks the parameters for a database with DBSize entries. It returns an error if one of Q
+// queries finds no primary hint (ErrNoHint), or a chunk runs out of backup hints (ErrHintsExhausted),
+// with a probability above maxFailureProbability.
+func (c Client) Validate(DBSize uint64) error {
+	if err := c.checkChunking(DBSize); err != nil {
+		return err
+	}
+	_, ChunkNum := c.chunking(DBSize)
+	if c.PerChunkM2 != nil && uint64(len(c.PerChunkM2)) != ChunkNum {
+		return fmt.Errorf("%d per-chunk backup counts for %d chunks", len(c.PerChunkM2), ChunkNum)
+	}
+	if c.M1 == 0 {
+		return fmt.Errorf("M1 must be positive")
+	}
+	for i, m := range c.chunkBackups(ChunkNum) {
+		if m == 0 {
+			return fmt.Errorf("M2 must be positive, chunk %d has no backup hints", i)
+		}
+	}
+	noHint, exhausted := c.failureProbabilities(DBSize)
+	if noHint > maxFailureProbability {
+		return fmt.Errorf("M1 %d is too small: %d queries find no hint with probability %.3g", c.M1, c.Q, noHint)
+	}
+	if exhausted > maxFailureProbability {
+		return fmt.Errorf("M2 is too small: %d queries exhaust a chunk with probability %.3g", c.Q, exhausted)
+	}
+	return nil
+}
+
+// chunkBackups returns the number of backup hints of every chunk.
+func (c Client) chunkBackups(ChunkNum uint64) []uint64 {
+	starts := c.backupStarts(ChunkNum)
+	backups := make([]uint64, ChunkNum)
+	for i := range backups {
+		backups[i] = starts[i+1] - starts[i]
+	}
+	return backups
+}
+
+// failureProbabilities returns upper bounds on the probability that one of Q queries finds no primary hint,
+// and that Q queries query a chunk more often than it has backup hints.
+func (c Client) failureProbabilities(DBSize uint64) (noHint float64, exhausted float64) {
+	ChunkSize, ChunkNum := c.chunking(DBSize)
+	return failureProbability(DBSize, ChunkSize, c.Boundaries, c.Q, c.M1, c.chunkBackups(ChunkNum))
+}
+
+// FailureProbability returns the standard Piano bounds for q queries of uniformly random indices of a database
+// with dbSize entries in chunkNum chunks of chunkSize entries, with m1 primary and m2 backup hints per chunk:
+// noHint bounds the probability that a query finds no primary hint (ErrNoHint), and exhaust the probability
+// that some chunk is queried more than m2 times (ErrHintsExhausted). Both are union bounds over the queries and
+// the chunks, capped at 1. Repeated indices are answered from the local cache, so the real rates are lower.
+func FailureProbability(dbSize, chunkSize, chunkNum, q, m1, m2 uint64) (noHint, exhaust float64) {
+	backups := make([]uint64, chunkNum)
+	for i := range backups {
+		backups[i] = m2
+	}
+	return failureProbability(dbSize, chunkSize, nil, q, m1, backups)
+}
+
+// failureProbability computes the bounds of FailureProbability for a chunk size of chunkSize, or the chunks of
+// boundaries if they are set, whose largest one has chunkSize entries.
+func failureProbability(dbSize, chunkSize uint64, boundaries []uint64, q, m1 uint64, backups []uint64) (noHint, exhaust float64) {
+	// a primary hint contains a given index with probability 1/chunkSize, or more in a smaller chunk
+	miss := math.Pow(1-1/float64(chunkSize), float64(m1))
+	if chunkSize == 1 {
+		miss = 0
+	}
+	noHint = math.Min(1, float64(q)*miss)
+
+	// a query falls into chunk i with probability proportional to its entries, the last chunk may be shorter
+	type tailKey struct{ m, entries uint64 }
+	tails := make(map[tailKey]float64)
+	for i, m := range backups {
+		entries := chunkLen(boundaries, chunkSize, uint64(i))
+		if end := chunkStart(boundaries, chunkSize, uint64(i)) + entries; end > dbSize {
+			entries -= end - dbSize
+		}
+		key := tailKey{m, entries}
+		if _, ok := tails[key]; !ok {
+			tails[key] = binomialTail(q, float64(entries)/float64(dbSize), m)
+		}
+		exhaust += tails[key]
+	}
+	return noHint, math.Min(1, exhaust)
+}
+
+// binomialTail returns the probability that more than m of q trials of probability p succeed.
+func binomialTail(q uint64, p float64, m uint64) float64 {
+	Q := float64(q)
+	if p >= 1 {
+		if q > m {
+			return 1
+		}
+		return 0
+	}
+	tail := 0.0
+	lq, _ := math.Lgamma(Q + 1)
+	for k := m + 1; k <= q; k++ {
+		kf := float64(k)
+		lk, _ := math.Lgamma(kf + 1)
+		lr, _ := math.Lgamma(Q - kf + 1)
+		term := math.Exp(lq - lk - lr + kf*math.Log(p) + (Q-kf)*math.Log1p(-p))
+		tail += term
+		// past the mean the terms only decrease
+		if kf > Q*p && term <= tail*1e-17 {
+			break
+		}
+	}
+	return tail
+}
+
+// EstimateClientMemory returns the approximate number of bytes of a ClientState for a database with DBSize
+// entries: the M1 primary and M2*ChunkNum backup hints, the per-chunk counters and a local cache of Q answers.
+// The offset cache (SetOffsetCache) and the overhead of the cache map are not included.
+func (c Client) EstimateClientMemory(DBSize uint64) uint64 {
+	_, ChunkNum := c.chunking(DBSize)
+	hints := (c.M1 + c.backupStarts(ChunkNum)[ChunkNum]) * uint64(unsafe.Sizeof(LocalHint{}))
+	return hints + 2*8*ChunkNum + 16*c.Q
+}
+
+type LocalHint struct {
+	key             util.PrfKey
+	parity          uint64
+	programmedPoint uint64
+	isProgrammed    bool
+	offsets         []uint64 // PRF offsets of every chunk, filled by Elem if the offset cache is enabled
+}
+
+// KeyBytes returns the 16 bytes of the hint's PRF key, laid out as described for util.PrfKey.
+func (h LocalHint) KeyBytes() []byte {
+	return append([]byte(nil), h.key[:]...)
+}
+
+// LocalHintFromBytes rebuilds an unprogrammed hint from the KeyBytes of its PRF key and its parity.
+func LocalHintFromBytes(keyBytes []byte, parity uint64) (LocalHint, error) {
+	var hint LocalHint
+	if len(keyBytes) != len(hint.key) {
+		return LocalHint{}, fmt.Errorf("hint key is %d bytes, want %d", len(keyBytes), len(hint.key))
+	}
+	copy(hint.key[:], keyBytes)
+	hint.parity = parity
+	return hint, nil
+}
+
+// ClientState is the client's local storage after the setup phase.
+type ClientState struct {
+	config     Client
+	DBSize     uint64 // the size of the window for a Client from NewClientForRange
+	ChunkSize  uint64
+	ChunkNum   uint64
+	rangeStart uint64 // the state holds indices relative to it, see NewClientForRange
+	version    uint64 // the Server.Version the hints match
+
+	rng             *rand.Rand
+	primaryHints    []LocalHint
+	backupHints     []LocalHint
+	backupStart     []uint64 // the backup hints of chunk i are backupHints[backupStart[i]:backupStart[i+1]]
+	localCache      map[uint64]uint64
+	consumedHintNum []uint64
+	cacheOffsets    bool // see SetOffsetCache
+	statsEnabled    bool // see SetStatsEnabled
+	failureMode     FailureMode
+	logger          Logger // see SetLogger
+	stats           Stats
+
+	// cacheCapacity bounds localCache when it is positive, the least recently used entry is evicted first
+	cacheCapacity int
+	cacheOrder    *list.List               // front is the most recently used index
+	cacheElems    map[uint64]*list.Element // index -> element of cacheOrder
+
+	streaming *streaming // see EnableStreaming, nil if disabled
+	scratch   []uint64   // reused by Retrieve for the parities of a server with ProcessInto
+
+	// the queries whose primary hint is not consumed yet, for RecoverAnswerByID
+	lastQueryID  uint64
+	pending      map[uint64]ClientQuery // query id -> query
+	hintQueries  map[uint64][]uint64    // hitId -> query ids
+	pendingOrder []uint64               // the ids of pending in the order they were built, and some untracked ones
+
+	pools        map[string]*ClientState // see AddHintPool
+	poolSelector PoolSelector
+
+	twoServer bool // a TwoServerClientState, which has no backup hints and refreshes from the left server
+}
+
+// ClientQuery is a query in flight. Prepare gives the message for the server.
+type ClientQuery struct {
+	index     uint64
+	chunkId   uint64
+	hitId     uint64
+	offsetVec []uint64
+	dummy     bool
+	hintKey   util.PrfKey // key of the primary hint when the query was made
+	id        uint64      // see QueryID
+	base      uint64      // rangeStart of the state, index is relative to it
+	pool      string      // the hint pool of the query, "" for the hints of the state itself
+}
+
+// Elem returns the element in the chunkID-th chunk of the hint. It takes care of the case when the hint is programmed.
+func (c *ClientState) Elem(hint *LocalHint, chunkId uint64) uint64 {
+	if hint.isProgrammed && chunkId == c.chunkOf(hint.programmedPoint) {
+		return hint.programmedPoint
+	} else if c.config.Boundaries != nil {
+		return c.chunkStart(chunkId) + c.prfOffset(hint, chunkId)%c.chunkLen(chunkId)
+	}
+	return c.prfOffset(hint, chunkId) + chunkId*c.ChunkSize
+}
+
+// prfOffset returns the PRF offset of hint in the chunkId-th chunk, in [0, ChunkSize).
+func (c *ClientState) prfOffset(hint *LocalHint, chunkId uint64) uint64 {
+	if !c.cacheOffsets {
+		if c.statsEnabled {
+			c.stats.PRFEvals++
+		}
+		return c.evalPRF(&hint.key, chunkId) % c.ChunkSize
+	}
+	if hint.offsets == nil {
+		if c.statsEnabled {
+			c.stats.PRFEvals += c.ChunkNum
+		}
+		hint.offsets = make([]uint64, c.ChunkNum)
+		for i := uint64(0); i < c.ChunkNum; i++ {
+			hint.offsets[i] = c.evalPRF(&hint.key, i) % c.ChunkSize
+		}
+	}
+	return hint.offsets[chunkId]
+}
+
+// evalPRF evaluates the PRF of the config at x.
+func (c *ClientState) evalPRF(key *util.PrfKey, x uint64) uint64 {
+	if c.config.PRF == PRFSHA256 {
+		return util.PRFEvalSHA256(key, x)
+	}
+	return util.PRFEval(key, x)
+}
+
+// sentOffset returns the offset of hint in the chunkId-th chunk as the query sends it. With Boundaries it is
+// uniform in [0, ChunkSize) and the server reduces it modulo the size of the chunk, so the offsets of a smaller
+// chunk do not reveal which chunk is punctured: this is the PRF offset, with the offset of a programmed point
+// in place of its remainder.
+func (c *ClientState) sentOffset(hint *LocalHint, chunkId uint64) uint64 {
+	if c.config.Boundaries == nil {
+		return c.Elem(hint, chunkId) % c.ChunkSize
+	}
+	offset := c.prfOffset(hint, chunkId)
+	if hint.isProgrammed && chunkId == c.chunkOf(hint.programmedPoint) {
+		size := c.chunkLen(chunkId)
+		offset += hint.programmedPoint - c.chunkStart(chunkId) - offset%size
+	}
+	return offset
+}
+
+// SetOffsetCache turns the per-hint offset cache on or off. When it is on, the first Elem call on a hint
+// evaluates the PRF for all ChunkNum chunks and later calls are lookups, which saves the repeated PRF
+// evaluations of queries. The offsets only depend on the hint key, so programming a hint keeps them valid.
+// It costs 8*ChunkNum bytes for every hint that is used, so it is off by default.
+func (c *ClientState) SetOffsetCache(enabled bool) {
+	c.cacheOffsets = enabled
+	if !enabled {
+		for j := range c.primaryHints {
+			c.primaryHints[j].offsets = nil
+		}
+		for j := range c.backupHints {
+			c.backupHints[j].offsets = nil
+		}
+	}
+}
+
+// newClientState samples the hint keys with rng for a database with the given chunking. The parities are left empty.
+func (c Client) newClientState(DBSize uint64, ChunkSize uint64, ChunkNum uint64, rng *rand.Rand) *ClientState {
+	state := &ClientState{
+		config:          c,
+		DBSize:          DBSize,
+		ChunkSize:       ChunkSize,
+		ChunkNum:        ChunkNum,
+		rng:             rng,
+		primaryHints:    make([]LocalHint, c.M1),
+		backupStart:     c.backupStarts(ChunkNum),
+		localCache:      make(map[uint64]uint64),
+		consumedHintNum: make([]uint64, ChunkNum),
+	}
+	state.backupHints = make([]LocalHint, state.backupStart[ChunkNum])
+
+	for i := uint64(0); i < c.M1; i++ {
+		state.primaryHints[i] = LocalHint{key: util.RandKey(rng)}
+	}
+	for i := range state.backupHints {
+		state.backupHints[i] = LocalHint{key: util.RandKey(rng)}
+	}
+	return state
+}
+
+// InitializeState runs the setup phase against the server.
+func (c Client) InitializeState(s Server) *ClientState {
+	return c.InitializeStateWithSeed(s, time.Now().UnixNano())
+}
+
+// InitializeStateWithSeed is like InitializeState, but the hints and the later random queries are
+// sampled from seed. This makes a run reproducible.
+// Both panic if the range of a Client from NewClientForRange does not fit into the database.
+func (c Client) InitializeStateWithSeed(s Server, seed int64) *ClientState {
+	state, err := c.initializeState(context.Background(), s, seed, 1)
+	if err != nil {
+		panic(err)
+	}
+	return state
+}
+
+// InitializeStateParallel is like InitializeState, but folds the chunks into the hints with workers goroutines,
+// each of which accumulates the parities of its own share of the hints over all chunks. If workers is not
+// positive, GOMAXPROCS workers are used. The hints are identical to the ones of InitializeState for the same seed.
+func (c Client) InitializeStateParallel(s Server, workers int) *ClientState {
+	return c.InitializeStateParallelWithSeed(s, workers, time.Now().UnixNano())
+}
+
+// InitializeStateParallelWithSeed is like InitializeStateParallel, but samples from seed like
+// InitializeStateWithSeed.
+func (c Client) InitializeStateParallelWithSeed(s Server, workers int, seed int64) *ClientState {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	state, err := c.initializeState(context.Background(), s, seed, workers)
+	if err != nil {
+		panic(err)
+	}
+	return state
+}
+
+// InitializeStateContext is like InitializeState, but stops between chunks once ctx is done and returns ctx.Err().
+func (c Client) InitializeStateContext(ctx context.Context, s Server) (*ClientState, error) {
+	return c.initializeState(ctx, s, time.Now().UnixNano(), 1)
+}
+
+func (c Client) initializeState(ctx context.Context, s Server, seed int64, workers int) (*ClientState, error) {
+	if s.DBSize == 0 {
+		return nil, fmt.Errorf("setup: %w", ErrEmptyDatabase)
+	}
+	if c.RangeEnd != 0 {
+		window, err := s.Window(c.RangeStart, c.RangeEnd)
+		if err != nil {
+			return nil, err
+		}
+		s = window
+	}
+
+	if !sameBoundaries(c.Boundaries, s.Boundaries) {
+		return nil, fmt.Errorf("setup: the server has chunk boundaries %v, the client %v", s.Boundaries, c.Boundaries)
+	}
+
+	//The client first samples the hints
+	state := c.newClientState(s.DBSize, s.ChunkSize, s.ChunkNum, rand.New(rand.NewSource(seed)))
+	state.rangeStart = c.RangeStart
+	state.version = s.Version
+
+	if workers > 1 {
+		if err := state.foldParallel(ctx, s, workers); err != nil {
+			return nil, err
+		}
+		return state, nil
+	}
+
+	//The client streamingly downloads the chunks from the server
+	for i := uint64(0); i < s.ChunkNum; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// suppose the client receives the i-th chunk, DB[i*ChunkSize:(i+1)*ChunkSize]
+		state.foldChunk(i, s.chunk(i))
+	}
+
+	return state, nil
+}
+
+// foldParallel folds every chunk of s into the hints with workers goroutines. The w-th worker owns the w-th share
+// of the primary and of the backup hints, so no parity is written by two workers.
+func (c *ClientState) foldParallel(ctx context.Context, s Server, workers int) error {
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := uint64(0); i < s.ChunkNum && ctx.Err() == nil; i++ {
+				c.foldChunkShare(i, s.chunk(i), w, workers)
+			}
+		}(w)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// InitializeStateStreaming runs the setup phase on a database of DBSize entries read from r, each 8 bytes
+// in little-endian order as for NewServerFromReader. Only one chunk is held in memory at a time.
+func (c Client) InitializeStateStreaming(r io.Reader, DBSize uint64) (*ClientState, error) {
+	return c.InitializeStateStreamingWithSeed(r, DBSize, time.Now().UnixNano())
+}
+
+// InitializeStateStreamingWithSeed is like InitializeStateStreaming, but samples from seed like
+// InitializeStateWithSeed. With the same seed and data both give identical hints.
+func (c Client) InitializeStateStreamingWithSeed(r io.Reader, DBSize uint64, seed int64) (*ClientState, error) {
+	if DBSize == 0 {
+		return nil, fmt.Errorf("setup: %w", ErrEmptyDatabase)
+	}
+	if err := c.checkChunking(DBSize); err != nil {
+		return nil, err
+	}
+	ChunkSize, ChunkNum := c.chunking(DBSize)
+	state := c.newClientState(DBSize, ChunkSize, ChunkNum, rand.New(rand.NewSource(seed)))
+
+	reader := bufio.NewReader(r)
+	buf := make([]byte, 8)
+	chunk := make([]uint64, ChunkSize)
+	for i := uint64(0); i < ChunkNum; i++ {
+		start := state.chunkStart(i)
+		chunk = chunk[:state.chunkLen(i)]
+		for k := range chunk {
+			// the padding part of the last chunk is all 0
+			chunk[k] = 0
+			if start+uint64(k) >= DBSize {
+				continue
+			}
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				return nil, fmt.Errorf("reading entry %d: %w", start+uint64(k), err)
+			}
+			chunk[k] = binary.LittleEndian.Uint64(buf)
+		}
+		state.foldChunk(i, chunk)
+	}
+	return state, nil
+}
+
+// InitializeStateFromStream runs the setup phase on the chunks of a database of DBSize entries received from ch,
+// as sent by Server.StreamChunks. It folds every chunk into the hints as it arrives and fails if ch is closed
+// before all chunks are received or a chunk has the wrong length.
+func (c Client) InitializeStateFromStream(ch <-chan []uint64, DBSize uint64) (*ClientState, error) {
+	return c.InitializeStateFromStreamWithSeed(ch, DBSize, time.Now().UnixNano())
+}
+
+// InitializeStateFromStreamWithSeed is like InitializeStateFromStream, but samples from seed like
+// InitializeStateWithSeed. With the same seed and database both give identical hints.
+func (c Client) InitializeStateFromStreamWithSeed(ch <-chan []uint64, DBSize uint64, seed int64) (*ClientState, error) {
+	if DBSize == 0 {
+		return nil, fmt.Errorf("setup: %w", ErrEmptyDatabase)
+	}
+	if err := c.checkChunking(DBSize); err != nil {
+		return nil, err
+	}
+	ChunkSize, ChunkNum := c.chunking(DBSize)
+	state := c.newClientState(DBSize, ChunkSize, ChunkNum, rand.New(rand.NewSource(seed)))
+	for i := uint64(0); i < ChunkNum; i++ {
+		chunk, ok := <-ch
+		if !ok {
+			return nil, fmt.Errorf("stream closed after %d of %d chunks", i, ChunkNum)
+		}
+		if uint64(len(chunk)) != state.chunkLen(i) {
+			return nil, fmt.Errorf("chunk %d has %d entries, want %d", i, len(chunk), state.chunkLen(i))
+		}
+		state.foldChunk(i, chunk)
+	}
+	return state, nil
+}
+
+// foldChunk XORs the entries of the i-th chunk into the parities of the hints.
+func (c *ClientState) foldChunk(i uint64, chunk []uint64) {
+	c.foldChunkShare(i, chunk, 0, 1)
+}
+
+// foldChunkShare is foldChunk for the w-th of workers equal shares of the primary and of the backup hints.
+func (c *ClientState) foldChunkShare(i uint64, chunk []uint64, w int, workers int) {
+	primaryNum, backupNum := uint64(len(c.primaryHints)), uint64(len(c.backupHints))
+	for j := primaryNum * uint64(w) / uint64(workers); j < primaryNum*uint64(w+1)/uint64(workers); j++ {
+		c.primaryHints[j].parity ^= chunk[c.Elem(&c.primaryHints[j], i)-c.chunkStart(i)]
+	}
+	for j := backupNum * uint64(w) / uint64(workers); j < backupNum*uint64(w+1)/uint64(workers); j++ {
+		if !c.isBackupOf(j, i) {
+			c.backupHints[j].parity ^= chunk[c.Elem(&c.backupHints[j], i)-c.chunkStart(i)]
+		}
+	}
+}
+
+// RefreshHints replaces up to count consumed backup hints of every chunk with freshly sampled ones and
+// folds their parities from a pass over every chunk of s, like the setup phase. Reading the entries of the
+// new hints one by one would show the server their sets, and so the queries that later consume them.
+// Calling it periodically lets a client query beyond Q without running out of backup hints. s has to be at
+// the Version of the state; the state is unchanged if it fails.
+func (c *ClientState) RefreshHints(s Server, count uint64) error {
+	if s.Version != c.version {
+		return fmt.Errorf("refresh: server version %d, hints of version %d: %w", s.Version, c.version, ErrStaleHints)
+	}
+	if c.config.RangeEnd != 0 {
+		window, err := s.Window(c.config.RangeStart, c.config.RangeEnd)
+		if err != nil {
+			return err
+		}
+		s = window
+	}
+	if s.DBSize != c.DBSize || s.ChunkNum != c.ChunkNum || !sameBoundaries(s.Boundaries, c.config.Boundaries) {
+		return fmt.Errorf("refresh: server has DBSize %d and %d chunks, the client DBSize %d and %d chunks",
+			s.DBSize, s.ChunkNum, c.DBSize, c.ChunkNum)
+	}
+	return c.refreshHints(count, func(i uint64) ([]uint64, error) {
+		return s.chunk(i), nil
+	})
+}
+
+// RefreshHintsFromStream is like RefreshHints, but reads the chunks of the database, or of the window of a state
+// from NewClientForRange, from ch as sent by Server.StreamChunks.
+func (c *ClientState) RefreshHintsFromStream(ch <-chan []uint64, count uint64) error {
+	return c.refreshHints(count, func(i uint64) ([]uint64, error) {
+		chunk, ok := <-ch
+		if !ok {
+			return nil, fmt.Errorf("stream closed after %d of %d chunks", i, c.ChunkNum)
+		}
+		if uint64(len(chunk)) != c.chunkLen(i) {
+			return nil, fmt.Errorf("chunk %d has %d entries, want %d", i, len(chunk), c.chunkLen(i))
+		}
+		return chunk, nil
+	})
+}
+
+// refreshHints replaces up to count consumed backup hints of every chunk, folding the chunks returned by chunk.
+func (c *ClientState) refreshHints(count uint64, chunk func(i uint64) ([]uint64, error)) error {
+	// the consumed backup hints of a chunk are the first consumedHintNum[chunkId] ones
+	replaced := make([]uint64, c.ChunkNum)
+	var ids []uint64
+	for chunkId := uint64(0); chunkId < c.ChunkNum; chunkId++ {
+		replaced[chunkId] = count
+		if replaced[chunkId] > c.consumedHintNum[chunkId] {
+			replaced[chunkId] = c.consumedHintNum[chunkId]
+		}
+		for k := c.consumedHintNum[chunkId] - replaced[chunkId]; k < c.consumedHintNum[chunkId]; k++ {
+			ids = append(ids, c.backupStart[chunkId]+k)
+		}
+	}
+
+	hints := make([]LocalHint, len(ids))
+	for k := range hints {
+		hints[k] = LocalHint{key: util.RandKey(c.rng)}
+	}
+	for i := uint64(0); i < c.ChunkNum; i++ {
+		data, err := chunk(i)
+		if err != nil {
+			return err
+		}
+		for k, id := range ids {
+			if !c.isBackupOf(id, i) {
+				hints[k].parity ^= data[c.Elem(&hints[k], i)-c.chunkStart(i)]
+			}
+		}
+	}
+
+	for k, id := range ids {
+		c.backupHints[id] = hints[k]
+	}
+	for chunkId, n := range replaced {
+		c.consumedHintNum[chunkId] -= n
+	}
+	return nil
+}
+
+// refreshFrom replaces every consumed backup hint from the chunks of srv, which has to be a Server or have
+// StreamChunks.
+func (c *ClientState) refreshFrom(srv PIRServer) error {
+	switch s := srv.(type) {
+	case Server:
+		return c.RefreshHints(s, ^uint64(0))
+	case *Server:
+		return c.RefreshHints(*s, ^uint64(0))
+	case interface{ StreamChunks() <-chan []uint64 }:
+		return c.RefreshHintsFromStream(s.StreamChunks(), ^uint64(0))
+	}
+	return fmt.Errorf("refresh: the server cannot stream its chunks")
+}
+
+// RotateKeys discards all hints and runs the setup phase against s again with freshly sampled PRF keys,
+// so a leaked copy of the state says nothing about the hints used from now on. Unlike RefreshHints it
+// also replaces the primary hints. The local cache is kept if keepCache is set and cleared otherwise.
+func (c *ClientState) RotateKeys(s Server, keepCache bool) {
+	c.replaceHints(c.config.InitializeStateWithSeed(s, c.rng.Int63()), keepCache)
+}
+
+// RebindServer recomputes the parities of all hints against s, which holds different data with the same DBSize
+// and ChunkSize, so the client can query s without drawing new PRF keys. The consumed backup hints stay consumed,
+// and the local cache, which holds answers of the old server, is cleared.
+func (c *ClientState) RebindServer(s Server) error {
+	if s.DBSize != c.DBSize || s.ChunkSize != c.ChunkSize || s.ChunkNum != c.ChunkNum || !sameBoundaries(s.Boundaries, c.config.Boundaries) {
+		return fmt.Errorf("server has DBSize %d and ChunkSize %d, the client DBSize %d and ChunkSize %d",
+			s.DBSize, s.ChunkSize, c.DBSize, c.ChunkSize)
+	}
+	for j := range c.primaryHints {
+		c.primaryHints[j].parity = 0
+	}
+	for j := range c.backupHints {
+		c.backupHints[j].parity = 0
+	}
+	// Elem follows the programmed points, so the primary hints keep the entries they were programmed with
+	for i := uint64(0); i < s.ChunkNum; i++ {
+		c.foldChunk(i, s.chunk(i))
+	}
+	c.localCache = make(map[uint64]uint64)
+	c.SetCacheCapacity(c.cacheCapacity)
+	c.version = s.Version
+	if c.streaming != nil {
+		c.streaming.server = s
+	}
+	return nil
+}
+
+// replaceHints takes over the hints of next, which must have been set up for the same database.
+func (c *ClientState) replaceHints(next *ClientState, keepCache bool) {
+	c.primaryHints = next.primaryHints
+	c.backupHints = next.backupHints
+	c.consumedHintNum = next.consumedHintNum
+	c.version = next.version
+	c.pending, c.hintQueries, c.pendingOrder = nil, nil, nil
+	if !keepCache {
+		c.clearCache()
+	}
+}
+
+// ApplyUpdate patches the parities of every hint containing index, and the local cache, after the server
+// XORed delta into the index-th entry (see Server.Update). A primary hint programmed at index is patched too.
+// The updates have to be applied one by one in the order of the server, each one moves the state to the next
+// Server.Version. An update at DBSize or above, which Server.Append writes into the padding of the last chunk,
+// grows DBSize to cover index, so the appended entries can be queried; the padding is already in the hints.
+func (c *ClientState) ApplyUpdate(index uint64, delta uint64) {
+	chunkId := c.chunkOf(index)
+	c.version++
+	if index >= c.DBSize && c.config.RangeEnd == 0 && c.config.Boundaries == nil && index < c.ChunkSize*c.ChunkNum {
+		c.DBSize = index + 1
+	}
+	for j := range c.primaryHints {
+		if c.Elem(&c.primaryHints[j], chunkId) == index {
+			c.primaryHints[j].parity ^= delta
+		}
+	}
+	for j := uint64(0); j < uint64(len(c.backupHints)); j++ {
+		// a backup hint does not cover its own chunk
+		if !c.isBackupOf(j, chunkId) && c.Elem(&c.backupHints[j], chunkId) == index {
+			c.backupHints[j].parity ^= delta
+		}
+	}
+	if answer, ok := c.localCache[index]; ok {
+		c.localCache[index] = answer ^ delta
+	}
+}
+
+// isBackupOf reports whether backupHints[j] is a backup hint of chunkId.
+func (c *ClientState) isBackupOf(j uint64, chunkId uint64) bool {
+	return c.backupStart[chunkId] <= j && j < c.backupStart[chunkId+1]
+}
+
+// newQuery builds the query for x from the hitId-th primary hint and tracks it for RecoverAnswerByID.
+func (c *ClientState) newQuery(x uint64, hitId uint64) ClientQuery {
+	return c.track(c.buildQuery(x, hitId))
+}
+
+// buildQuery is newQuery without the tracking.
+func (c *ClientState) buildQuery(x uint64, hitId uint64) ClientQuery {
+	offsetVec := make([]uint64, c.ChunkNum)
+	for i := uint64(0); i < c.ChunkNum; i++ {
+		offsetVec[i] = c.sentOffset(&c.primaryHints[hitId], i)
+	}
+	return ClientQuery{x, c.chunkOf(x), hitId, offsetVec, false, c.primaryHints[hitId].key, 0, c.rangeStart, ""}
+}
+
+// AllOffsets returns the offset vectors of the primary hints hitIds, the same as the queries built on them hold
+// before Prepare punctures them. It evaluates the PRF of every distinct hint in one pass with a single key
+// expansion, reuses the offset cache where it is filled and puts all vectors in one allocation, so it is cheaper
+// than building the queries one by one when preparing a batch. Repeated hitIds share a vector.
+func (c *ClientState) AllOffsets(hitIds []uint64) [][]uint64 {
+	vecs := make([][]uint64, len(hitIds))
+	backing := make([]uint64, uint64(len(hitIds))*c.ChunkNum)
+	seen := make(map[uint64][]uint64, len(hitIds))
+	for k, hitId := range hitIds {
+		if vec, ok := seen[hitId]; ok {
+			vecs[k] = vec
+			continue
+		}
+		hint := &c.primaryHints[hitId]
+		vec := backing[uint64(k)*c.ChunkNum : uint64(k+1)*c.ChunkNum]
+		if c.config.Boundaries != nil {
+			for i := range vec {
+				vec[i] = c.sentOffset(hint, uint64(i))
+			}
+		} else if hint.offsets != nil {
+			copy(vec, hint.offsets)
+		} else {
+			if c.statsEnabled {
+				c.stats.PRFEvals += c.ChunkNum
+			}
+			if c.config.PRF == PRFAES {
+				util.PRFEvalRange(&hint.key, vec)
+			} else {
+				for i := range vec {
+					vec[i] = c.evalPRF(&hint.key, uint64(i))
+				}
+			}
+			for i := range vec {
+				vec[i] %= c.ChunkSize
+			}
+		}
+		if hint.isProgrammed && c.config.Boundaries == nil {
+			vec[hint.programmedPoint/c.ChunkSize] = hint.programmedPoint % c.ChunkSize
+		}
+		vecs[k] = vec
+		seen[hitId] = vec
+	}
+	return vecs
+}
+
+// findHit returns the id of the first primary hint containing x, or noHit.
+func (c *ClientState) findHit(x uint64) uint64 {
+	chunkId := c.chunkOf(x)
+	for i := uint64(0); i < c.config.M1; i++ {
+		if c.Elem(&c.primaryHints[i], chunkId) == x {
+			return i
+		}
+	}
+	return noHit
+}
+
+// TryRandomQuery samples a random index that is not in the local cache and builds its query.
+// It returns ErrNoHint if no primary hint contains the sampled index; the caller can resample
+// or send a dummy query instead. It returns ErrCacheSaturated if less than one in cacheSaturation
+// indices is not cached; SetCacheCapacity or RotateKeys without keepCache free the cache.
+func (c *ClientState) TryRandomQuery() (ClientQuery, error) {
+	if c.DBSize == 0 {
+		return ClientQuery{}, ErrEmptyDatabase
+	}
+	c.advanceEpoch()
+	x, err := c.sampleUncached()
+	if err != nil {
+		return ClientQuery{}, err
+	}
+
+	hitId := c.findHit(x)
+	if hitId == noHit {
+		return ClientQuery{}, ErrNoHint
+	}
+
+	return c.newQuery(x, hitId), nil
+}
+
+// sampleUncached returns a uniformly random index that is not in the local cache.
+func (c *ClientState) sampleUncached() (uint64, error) {
+	if uncached := c.DBSize - uint64(len(c.localCache)); uncached*cacheSaturation < c.DBSize {
+		return 0, fmt.Errorf("%d of %d indices are not cached: %w", uncached, c.DBSize, ErrCacheSaturated)
+	}
+	for attempt := 0; attempt < sampleAttempts; attempt++ {
+		x := c.rng.Uint64() % c.DBSize
+		if _, ok := c.localCache[x]; !ok {
+			return x, nil
+		}
+	}
+	return 0, fmt.Errorf("no uncached index in %d samples: %w", sampleAttempts, ErrCacheSaturated)
+}
+
+// RandomQuery is like TryRandomQuery but panics if no primary hint is found or the cache is saturated.
+func (c *ClientState) RandomQuery() ClientQuery {
+	query, err := c.TryRandomQuery()
+	if err != nil {
+		c.logf("piano: RandomQuery: %v", err)
+		panic(err)
+	}
+	return query
+}
+
+// Cached returns the answer for index if it is in the local cache. Reading a cached index is free:
+// it sends nothing to the server and consumes no hint.
+func (c *ClientState) Cached(index uint64) (uint64, bool) {
+	local, err := c.localIndex(index)
+	if err != nil {
+		return 0, false
+	}
+	return c.cacheGet(local)
+}
+
+// CanServeLocally reports whether ServeLocally has the answer for index, without touching the cache order.
+func (c *ClientState) CanServeLocally(index uint64) bool {
+	local, err := c.localIndex(index)
+	if err != nil {
+		return false
+	}
+	if _, ok := c.localCache[local]; ok {
+		return true
+	}
+	return c.ChunkNum == 1 && c.findHit(local) != noHit
+}
+
+// ServeLocally returns the answer for index without a server round-trip or a backup hint, if the state has it:
+// from the local cache, or from a primary hint that contains index and no other entry. Every hint spans all
+// chunks, so the latter only happens for a database of a single chunk, where a hint programmed at index or
+// landing on it holds the entry itself as its parity.
+func (c *ClientState) ServeLocally(index uint64) (uint64, bool) {
+	local, err := c.localIndex(index)
+	if err != nil {
+		return 0, false
+	}
+	if answer, ok := c.cacheGet(local); ok {
+		return answer, true
+	}
+	if c.ChunkNum == 1 {
+		if hitId := c.findHit(local); hitId != noHit {
+			return c.primaryHints[hitId].parity, true
+		}
+	}
+	return 0, false
+}
+
+// ExportCache returns a copy of the local cache, keyed by index. Unlike Save it leaves out the hints, so it is
+// cheap to persist; ImportCache puts the answers into a new state after a restart.
+func (c *ClientState) ExportCache() map[uint64]uint64 {
+	cache := make(map[uint64]uint64, len(c.localCache))
+	for x, answer := range c.localCache {
+		cache[c.rangeStart+x] = answer
+	}
+	return cache
+}
+
+// ImportCache adds the answers of cache, as returned by ExportCache, to the local cache, so that Retrieve and
+// Cached serve them without a query and QueryIndex returns ErrAlreadyCached for them. The answers must be from
+// the Version of the database the hints are for. It fails without importing anything if an index is out of
+// range, and imports nothing if the cache is disabled; with a capacity, the excess answers are evicted.
+func (c *ClientState) ImportCache(cache map[uint64]uint64) error {
+	for x := range cache {
+		if _, err := c.localIndex(x); err != nil {
+			return err
+		}
+	}
+	for x, answer := range cache {
+		c.cachePut(x-c.rangeStart, answer)
+	}
+	return nil
+}
+
+// QueryIndex builds the query for a specific index. It returns ErrAlreadyCached for a cached index, and
+// ErrHintsExhausted if the chunk of the index has no backup hints left; the other chunks can still be queried.
+// If no primary hint covers target, it returns a dummy query with random offsets,
+// so that the server sees the same distribution either way. The answer to a dummy
+// query is meaningless; check IsDummy and query again later.
+func (c *ClientState) QueryIndex(target uint64) (ClientQuery, error) {
+	local, err := c.localIndex(target)
+	if err != nil {
+		return ClientQuery{}, err
+	}
+	return c.queryIndex(local)
+}
+
+// localIndex returns index relative to the range of the state.
+func (c *ClientState) localIndex(index uint64) (uint64, error) {
+	if c.DBSize == 0 {
+		return 0, fmt.Errorf("index %d: %w", index, ErrEmptyDatabase)
+	}
+	if index < c.rangeStart || index-c.rangeStart >= c.DBSize {
+		if c.rangeStart == 0 {
+			return 0, fmt.Errorf("index %d out of range, DBSize is %d", index, c.DBSize)
+		}
+		return 0, fmt.Errorf("index %d outside the range [%d, %d) of the client", index, c.rangeStart, c.rangeStart+c.DBSize)
+	}
+	return index - c.rangeStart, nil
+}
+
+// queryIndex is QueryIndex for an index relative to the range of the state.
+func (c *ClientState) queryIndex(target uint64) (ClientQuery, error) {
+	c.advanceEpoch()
+	if _, ok := c.localCache[target]; ok {
+		return ClientQuery{}, fmt.Errorf("index %d: %w", target, ErrAlreadyCached)
+	}
+	if name, pool := c.poolFor(target); pool != c {
+		return pool.poolQuery(name, target, c.version)
+	}
+	if !c.twoServer && c.ChunkHintsRemaining(c.chunkOf(target)) == 0 {
+		return ClientQuery{}, fmt.Errorf("index %d: %w", target, ErrHintsExhausted)
+	}
+
+	if hitId := c.findHit(target); hitId != noHit {
+		return c.newQuery(target, hitId), nil
+	}
+
+	// no hint hits the target, fall back to a throwaway query
+	offsetVec := make([]uint64, c.ChunkNum)
+	for i := uint64(0); i < c.ChunkNum; i++ {
+		offsetVec[i] = c.rng.Uint64() % c.ChunkSize
+	}
+	return ClientQuery{target, c.chunkOf(target), noHit, offsetVec, true, util.PrfKey{}, 0, c.rangeStart, ""}, nil
+}
+
+// Index returns the index this query retrieves.
+func (c ClientQuery) Index() uint64 {
+	return c.base + c.index
+}
+
+// ChunkID returns the chunk of the queried index, which is the chunk punctured from the offset vector.
+func (c ClientQuery) ChunkID() uint64 {
+	return c.chunkId
+}
+
+// HitID returns the primary hint the query is built on, the index of its parity in ClientState.Hints.
+func (c ClientQuery) HitID() uint64 {
+	return c.hitId
+}
+
+// IsDummy reports whether this is a throwaway query that cannot recover an answer.
+func (c ClientQuery) IsDummy() bool {
+	return c.dummy
+}
+
+// Prepare returns the punctured offset vector that is sent to the server.
+// The query's own offset vector is not modified, so Prepare can be called more than once.
+func (c ClientQuery) Prepare() []uint64 {
+	punctOffsetVec := make([]uint64, len(c.offsetVec)-1)
+	copy(punctOffsetVec[:c.chunkId], c.offsetVec[:c.chunkId])
+	copy(punctOffsetVec[c.chunkId:], c.offsetVec[c.chunkId+1:])
+	return punctOffsetVec
+}
+
+// PreparePacked is like Prepare, but packs every offset into util.OffsetBits(ChunkSize) bits.
+// Server.Process accepts both forms.
+func (c *ClientState) PreparePacked(clientQuery ClientQuery) []uint64 {
+	return util.PackOffsets(clientQuery.Prepare(), util.OffsetBits(c.ChunkSize))
+}
+
+// RecoverAnswer recovers the queried entry from the server's parities and refreshes the consumed hint.
+// A dummy query leaves the state untouched and returns ErrNoHint, a query whose hint was consumed in the
+// meantime returns ErrStaleQuery.
+// If the chunk has no backup hints left, it returns ErrHintsExhausted and the state is unchanged.
+// A response without exactly ChunkNum parities returns ErrMalformedResponse.
+func (c *ClientState) RecoverAnswer(clientQuery ClientQuery, serverParities []uint64) (uint64, error) {
+	if clientQuery.pool != "" {
+		return c.recoverPool(clientQuery, serverParities)
+	}
+	c.countExchange(clientQuery, serverParities)
+	if err := c.checkRecoverable(clientQuery, len(serverParities)); err != nil {
+		return 0, err
+	}
+
+	hitId := clientQuery.hitId
+	answer := Recover(clientQuery.chunkId, c.primaryHints[hitId].parity, serverParities)
+
+	// update the local cache
+	c.cachePut(clientQuery.index, answer)
+
+	// refresh the hint
+	c.refreshHint(clientQuery)
+	c.primaryHints[hitId].parity ^= answer
+	c.countEpochQuery()
+
+	return answer, nil
+}
+
+// Recover returns the entry a query of chunkId retrieves from the parities of the server, the guesses for every
+// chunk being the punctured one, and primaryParity, the parity of the primary hint of the query before it is
+// consumed: the guess for chunkId leaves out exactly the queried entry of the set. Unlike RecoverAnswer, it does
+// no checks and does not refresh the hint, so it suits custom recovery, e.g. of the parities of several servers
+// (see RobustClientState.RecoverAnswerRobust). It panics if parities has no entry for chunkId.
+func Recover(chunkId uint64, primaryParity uint64, parities []uint64) uint64 {
+	return parities[chunkId] ^ primaryParity
+}
+
+// Version returns the Server.Version the hints were computed for.
+func (c *ClientState) Version() uint64 {
+	return c.version
+}
+
+// RecoverAnswerVersioned is like RecoverAnswer for parities from Server.ProcessVersioned. If version is not the
+// Version of the state, it returns ErrStaleHints and the state is unchanged.
+func (c *ClientState) RecoverAnswerVersioned(clientQuery ClientQuery, serverParities []uint64, version uint64) (uint64, error) {
+	if version != c.version {
+		return 0, fmt.Errorf("server version %d, hints of version %d: %w", version, c.version, ErrStaleHints)
+	}
+	return c.RecoverAnswer(clientQuery, serverParities)
+}
+
+// SetCacheCapacity bounds the local cache to capacity entries, evicting the least recently used ones.
+// A capacity of 0 makes the cache unbounded. Note that an evicted index is no longer free to read:
+// retrieving it again costs a query and a backup hint.
+func (c *ClientState) SetCacheCapacity(capacity int) {
+	c.cacheCapacity = capacity
+	c.cacheOrder = nil
+	c.cacheElems = nil
+	if capacity <= 0 {
+		return
+	}
+	c.cacheOrder = list.New()
+	c.cacheElems = make(map[uint64]*list.Element)
+	for x := range c.localCache {
+		c.cacheElems[x] = c.cacheOrder.PushFront(x)
+	}
+	c.evict()
+}
+
+// cachePut stores an answer in the local cache and evicts entries beyond the capacity, unless the cache is disabled.
+func (c *ClientState) cachePut(x uint64, answer uint64) {
+	if c.config.DisableCache {
+		return
+	}
+	c.localCache[x] = answer
+	if c.cacheCapacity <= 0 {
+		return
+	}
+	if e, ok := c.cacheElems[x]; ok {
+		c.cacheOrder.MoveToFront(e)
+	} else {
+		c.cacheElems[x] = c.cacheOrder.PushFront(x)
+	}
+	c.evict()
+}
+
+// cacheGet looks up the local cache and marks the entry as recently used.
+func (c *ClientState) cacheGet(x uint64) (uint64, bool) {
+	answer, ok := c.localCache[x]
+	if ok && c.cacheCapacity > 0 {
+		c.cacheOrder.MoveToFront(c.cacheElems[x])
+	}
+	return answer, ok
+}
+
+func (c *ClientState) evict() {
+	for c.cacheOrder.Len() > c.cacheCapacity {
+		x := c.cacheOrder.Remove(c.cacheOrder.Back()).(uint64)
+		delete(c.cacheElems, x)
+		delete(c.localCache, x)
+	}
+}
+
+// Clone returns an independent deep copy of the state, so that two query sessions can start from the same
+// hints without running the setup phase twice. The clone's random number generator is seeded from c's.
+// Streaming is not enabled on the clone.
+func (c *ClientState) Clone() *ClientState {
+	clone := *c
+	clone.streaming = nil
+	clone.scratch = nil
+	clone.rng = rand.New(rand.NewSource(c.rng.Int63()))
+	// the cached offsets of a hint are never modified once filled, so they can be shared
+	clone.primaryHints = append([]LocalHint(nil), c.primaryHints...)
+	clone.backupHints = append([]LocalHint(nil), c.backupHints...)
+	clone.consumedHintNum = append([]uint64(nil), c.consumedHintNum...)
+	clone.localCache = make(map[uint64]uint64, len(c.localCache))
+	for x, answer := range c.localCache {
+		clone.localCache[x] = answer
+	}
+	clone.stats.HintsConsumed = append([]uint64(nil), c.stats.HintsConsumed...)
+	clone.pending = make(map[uint64]ClientQuery, len(c.pending))
+	for id, query := range c.pending {
+		clone.pending[id] = query
+	}
+	clone.hintQueries = make(map[uint64][]uint64, len(c.hintQueries))
+	for hitId, ids := range c.hintQueries {
+		clone.hintQueries[hitId] = append([]uint64(nil), ids...)
+	}
+	clone.pendingOrder = append([]uint64(nil), c.pendingOrder...)
+
+	clone.cacheOrder = nil
+	clone.cacheElems = nil
+	if c.cacheCapacity > 0 {
+		clone.cacheOrder = list.New()
+		clone.cacheElems = make(map[uint64]*list.Element)
+		for e := c.cacheOrder.Front(); e != nil; e = e.Next() {
+			x := e.Value.(uint64)
+			clone.cacheElems[x] = clone.cacheOrder.PushBack(x)
+		}
+	}
+	if c.pools != nil {
+		clone.pools = make(map[string]*ClientState, len(c.pools))
+		for name, pool := range c.pools {
+			clone.pools[name] = pool.Clone()
+		}
+	}
+	return &clone
+}
+
+// Reset clears the local cache. It fails, and leaves the state as it is, once a backup hint has been consumed:
+// zeroing the count would hand the consumed backup hints out again, so the server could link the next queries
+// to the earlier ones. Call RefreshHints to replace the consumed backup hints of a state in use.
+func (c *ClientState) Reset() error {
+	for chunkId, num := range c.consumedHintNum {
+		if num != 0 {
+			return fmt.Errorf("reset: %d backup hints of chunk %d are consumed, refresh the hints instead", num, chunkId)
+		}
+	}
+	c.clearCache()
+	return nil
+}
+
+// clearCache drops every entry of the local cache.
+func (c *ClientState) clearCache() {
+	c.localCache = make(map[uint64]uint64)
+	c.SetCacheCapacity(c.cacheCapacity)
+}
+
+// FailureMode selects what Retrieve does when the chunk of an index has no backup hints left.
+type FailureMode int
+
+const (
+	// FailError returns ErrHintsExhausted. This is the default.
+	FailError FailureMode = iota
+	// FailDirect reads the entry with a plaintext Query instead. This reveals the index to the server.
+	FailDirect
+	// FailRefresh replaces the consumed backup hints with RefreshHints and queries again. The server has to be a
+	// Server or stream its chunks with StreamChunks; otherwise Retrieve returns ErrHintsExhausted.
+	FailRefresh
+)
+
+// SetFailureMode sets what Retrieve does when backup hints run out. RecoverAnswer does not talk to the
+// server, so it always returns ErrHintsExhausted.
+func (c *ClientState) SetFailureMode(mode FailureMode) {
+	c.failureMode = mode
+}
+
+// Retrieve privately reads the entry at index from srv, or from the local cache if it is there.
+// If no primary hint contains index, the dummy query is still sent, so the server sees the same
+// traffic, and a random query is spent to replace a primary hint before trying again. After
+// retrieveAttempts failed attempts it returns an error wrapping ErrNoHint. ErrHintsExhausted is
+// returned right away, since retrying does not bring back backup hints, unless SetFailureMode
+// chose FailDirect or FailRefresh.
+func (c *ClientState) Retrieve(index uint64, srv PIRServer) (uint64, error) {
+	local, err := c.localIndex(index)
+	if err != nil {
+		return 0, err
+	}
+	if answer, ok := c.cacheGet(local); ok {
+		return answer, nil
+	}
+
+	_, pool := c.poolFor(local)
+	for attempt := 0; attempt < retrieveAttempts; attempt++ {
+		query, err := c.queryIndex(local)
+		if errors.Is(err, ErrHintsExhausted) {
+			chunkId := c.chunkOf(local)
+			switch c.failureMode {
+			case FailDirect:
+				c.logf("piano: chunk %d has no backup hints left, reading index %d in plaintext", chunkId, index)
+				answer := srv.Query(local)
+				c.cachePut(local, answer)
+				return answer, nil
+			case FailRefresh:
+				c.logf("piano: chunk %d has no backup hints left, refreshing them", chunkId)
+				// replace all consumed backup hints
+				if err := pool.refreshFrom(srv); err != nil {
+					return 0, fmt.Errorf("retrieve index %d: %v: %w", index, err, ErrHintsExhausted)
+				}
+				continue
+			}
+			return 0, fmt.Errorf("retrieve index %d: %w", index, ErrHintsExhausted)
+		}
+		if err != nil {
+			return 0, err
+		}
+		parities, version := c.process(srv, query.Prepare())
+		if version != c.version {
+			return 0, fmt.Errorf("retrieve index %d: server version %d, hints of version %d: %w", index, version, c.version, ErrStaleHints)
+		}
+		if !query.IsDummy() {
+			answer, err := c.RecoverAnswer(query, parities)
+			if err != nil {
+				return 0, fmt.Errorf("retrieve index %d: %w", index, err)
+			}
+			return answer, nil
+		}
+
+		c.countExchange(query, parities)
+		c.logf("piano: no primary hint contains index %d, attempt %d of %d", index, attempt+1, retrieveAttempts)
+
+		// no primary hint contains index, consuming a random query replaces one
+		if random, err := pool.TryRandomQuery(); err == nil {
+			parities, _ := c.process(srv, random.Prepare())
+			pool.RecoverAnswer(random, parities)
+		}
+	}
+	return 0, fmt.Errorf("retrieve index %d: %w after %d attempts", index, ErrNoHint, retrieveAttempts)
+}
+
+// process sends offsetVec to srv and returns the parities and the version of the database they were computed
+// from. If srv has ProcessVersioned, like Server, it reports the version; otherwise srv is assumed to be up to
+// date with the state. If srv has ProcessInto instead, the parities are written into the scratch buffer of the
+// state, which is overwritten by the next call.
+func (c *ClientState) process(srv PIRServer, offsetVec []uint64) ([]uint64, uint64) {
+	_, versioned := srv.(versionedServer)
+	into, ok := srv.(interface{ ProcessInto([]uint64, []uint64) })
+	if versioned || !ok {
+		return processVersion(srv, offsetVec, c.version)
+	}
+	if uint64(len(c.scratch)) != c.ChunkNum {
+		c.scratch = make([]uint64, c.ChunkNum)
+	}
+	into.ProcessInto(offsetVec, c.scratch)
+	return c.scratch, c.version
+}
+
+// versionedServer is a PIRServer that reports the version of its parities, like Server.
+type versionedServer interface {
+	ProcessVersioned([]uint64) ([]uint64, uint64)
+}
+
+// processVersion is process without the scratch buffer, so calls may run concurrently. A srv without
+// ProcessVersioned is assumed to be at version.
+func processVersion(srv PIRServer, offsetVec []uint64, version uint64) ([]uint64, uint64) {
+	if versioned, ok := srv.(versionedServer); ok {
+		return versioned.ProcessVersioned(offsetVec)
+	}
+	return srv.Process(offsetVec), version
+}
+
+// PrepareBatch returns the punctured offset vectors of all queries, to be sent in one round-trip.
+func (c *ClientState) PrepareBatch(queries []ClientQuery) [][]uint64 {
+	offsetVecs := make([][]uint64, len(queries))
+	for i, query := range queries {
+		offsetVecs[i] = query.Prepare()
+	}
+	return offsetVecs
+}
+
+// RecoverBatch recovers every query of a batch from the matching parities and returns the answers
+// with one error per query. A failed query does not affect the others. Two queries of a batch may
+// share a primary hint; only the first one of them is recovered and the other gets ErrStaleQuery.
+func (c *ClientState) RecoverBatch(queries []ClientQuery, serverParities [][]uint64) ([]uint64, []error) {
+	answers := make([]uint64, len(queries))
+	errs := make([]error, len(queries))
+	for i, query := range queries {
+		answers[i], errs[i] = c.RecoverAnswer(query, serverParities[i])
+	}
+	return answers, errs
+}
+
+// RecoverBatchResults is like RecoverBatch, but pairs every answer and error with the index of its query.
+func (c *ClientState) RecoverBatchResults(queries []ClientQuery, serverParities [][]uint64) []RetrieveResult {
+	answers, errs := c.RecoverBatch(queries, serverParities)
+	results := make([]RetrieveResult, len(queries))
+	for i, query := range queries {
+		results[i] = RetrieveResult{Index: query.Index(), Value: answers[i], Err: errs[i]}
+	}
+	return results
+}
+
+// ChunkHintsRemaining returns how many backup hints of chunkId are left, which is how many more queries
+// of that chunk can be recovered.
+func (c *ClientState) ChunkHintsRemaining(chunkId uint64) uint64 {
+	return c.backupStart[chunkId+1] - c.backupStart[chunkId] - c.consumedHintNum[chunkId]
+}
+
+// HintUtilization returns the share of consumed backup hints of every chunk. Chunks close to 1 are hot
+// spots; NewClientWithPerChunkBackups can give them more backup hints.
+func (c *ClientState) HintUtilization() []float64 {
+	utilization := make([]float64, c.ChunkNum)
+	for i := range utilization {
+		utilization[i] = float64(c.consumedHintNum[i]) / float64(c.backupStart[i+1]-c.backupStart[i])
+	}
+	return utilization
+}
+
+// RemainingQueries returns the minimum of ChunkHintsRemaining across chunks. That many more queries are
+// guaranteed to be recoverable whichever chunks they fall into; call RefreshHints or RotateKeys before it gets to 0.
+func (c *ClientState) RemainingQueries() uint64 {
+	remaining := ^uint64(0)
+	for chunkId := uint64(0); chunkId < c.ChunkNum; chunkId++ {
+		if r := c.ChunkHintsRemaining(chunkId); r < remaining {
+			remaining = r
+		}
+	}
+	return remaining
+}
+
+// checkRecoverable returns the error RecoverAnswer would fail with, if any, given the number of parities
+// in the server's response.
+func (c *ClientState) checkRecoverable(clientQuery ClientQuery, numParities int) error {
+	if clientQuery.dummy {
+		return ErrNoHint
+	}
+	if uint64(numParities) != c.ChunkNum {
+		return ErrMalformedResponse
+	}
+	// a refreshed hint takes over the key of a backup hint, so this also catches a hitId that was consumed and
+	// reprogrammed since the query was built; a query built after that uses the programmed point itself
+	if c.primaryHints[clientQuery.hitId].key != clientQuery.hintKey {
+		return ErrStaleQuery
+	}
+	if c.ChunkHintsRemaining(clientQuery.chunkId) == 0 {
+		return ErrHintsExhausted
+	}
+	return nil
+}
+
+// refreshHint replaces the consumed primary hint with the next backup hint of the chunk,
+// programmed at the queried index. It returns the id of the backup hint. The caller
+// is responsible for folding the answer into the new parity.
+func (c *ClientState) refreshHint(clientQuery ClientQuery) uint64 {
+	chunkId := clientQuery.chunkId
+	hitId := clientQuery.hitId
+	backupId := c.backupStart[chunkId] + c.consumedHintNum[chunkId]
+	c.primaryHints[hitId] = c.backupHints[backupId]
+	c.primaryHints[hitId].isProgrammed = true
+	c.primaryHints[hitId].programmedPoint = clientQuery.index
+	c.consumedHintNum[chunkId]++
+	if c.statsEnabled {
+		c.stats.HintsConsumed[chunkId]++
+	}
+	c.untrack(hitId)
+	return backupId
+}
+
+// savedHint is the exported form of LocalHint used by Save and LoadClientState.
+type savedHint struct {
+	Key             util.PrfKey
+	Parity          uint64
+	ProgrammedPoint uint64
+	IsProgrammed    bool
+}
+
+// savedClientState is the exported form of ClientState used by Save and LoadClientState.
+type savedClientState struct {
+	Config          Client
+	DBSize          uint64
+	ChunkSize       uint64
+	ChunkNum        uint64
+	PrimaryHints    []savedHint
+	BackupHints     []savedHint
+	LocalCache      map[uint64]uint64
+	ConsumedHintNum []uint64
+	Version         uint64
+}
+
+func saveHints(hints []LocalHint) []savedHint {
+	saved := make([]savedHint, len(hints))
+	for i, h := range hints {
+		saved[i] = savedHint{h.key, h.parity, h.programmedPoint, h.isProgrammed}
+	}
+	return saved
+}
+
+func loadHints(saved []savedHint) []LocalHint {
+	hints := make([]LocalHint, len(saved))
+	for i, h := range saved {
+		hints[i] = LocalHint{key: h.Key, parity: h.Parity, programmedPoint: h.ProgrammedPoint, isProgrammed: h.IsProgrammed}
+	}
+	return hints
+}
+
+// Save writes the hints, the local cache and the parameters to w with encoding/gob,
+// so that the setup phase does not have to be repeated after a restart. The cache capacity is not saved.
+func (c *ClientState) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(savedClientState{
+		Config:          c.config,
+		DBSize:          c.DBSize,
+		ChunkSize:       c.ChunkSize,
+		ChunkNum:        c.ChunkNum,
+		PrimaryHints:    saveHints(c.primaryHints),
+		BackupHints:     saveHints(c.backupHints),
+		LocalCache:      c.localCache,
+		ConsumedHintNum: c.consumedHintNum,
+		Version:         c.version,
+	})
+}
+
+// LoadClientState reads a ClientState written by Save. The random number generator is freshly seeded.
+func LoadClientState(r io.Reader) (*ClientState, error) {
+	var saved savedClientState
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, err
+	}
+	if saved.Config.PerChunkM2 != nil && uint64(len(saved.Config.PerChunkM2)) != saved.ChunkNum {
+		return nil, fmt.Errorf("malformed client state")
+	}
+	backupStart := saved.Config.backupStarts(saved.ChunkNum)
+	if uint64(len(saved.PrimaryHints)) != saved.Config.M1 ||
+		uint64(len(saved.BackupHints)) != backupStart[saved.ChunkNum] ||
+		uint64(len(saved.ConsumedHintNum)) != saved.ChunkNum {
+		return nil, fmt.Errorf("malformed client state")
+	}
+	if saved.LocalCache == nil {
+		saved.LocalCache = make(map[uint64]uint64)
+	}
+
+	return &ClientState{
+		config:          saved.Config,
+		DBSize:          saved.DBSize,
+		ChunkSize:       saved.ChunkSize,
+		ChunkNum:        saved.ChunkNum,
+		rangeStart:      saved.Config.RangeStart,
+		version:         saved.Version,
+		rng:             rand.New(rand.NewSource(time.Now().UnixNano())),
+		primaryHints:    loadHints(saved.PrimaryHints),
+		backupHints:     loadHints(saved.BackupHints),
+		backupStart:     backupStart,
+		localCache:      saved.LocalCache,
+		consumedHintNum: saved.ConsumedHintNum,
+	}, nil
+}
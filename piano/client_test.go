@@ -0,0 +1,1581 @@
+package piano
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"example.com/util"
+)
+
+func TestQueryIndex(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+
+	for _, x := range []uint64{0, 1, 99, 100, 5050, 9999} {
+		query, err := state.QueryIndex(x)
+		if err != nil {
+			t.Fatalf("QueryIndex(%d): %v", x, err)
+		}
+		if query.IsDummy() {
+			continue
+		}
+		answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+		if err != nil {
+			t.Fatalf("RecoverAnswer(%d): %v", x, err)
+		}
+		if answer != server.Query(x) {
+			t.Fatalf("QueryIndex(%d): got %d, want %d", x, answer, server.Query(x))
+		}
+		if _, err := state.QueryIndex(x); !errors.Is(err, ErrAlreadyCached) {
+			t.Fatalf("QueryIndex(%d): got %v, want ErrAlreadyCached", x, err)
+		}
+		if cached, ok := state.Cached(x); !ok || cached != answer {
+			t.Fatalf("Cached(%d) = %d, %v, want %d", x, cached, ok, answer)
+		}
+	}
+
+	if _, err := state.QueryIndex(server.DBSize); err == nil {
+		t.Fatalf("QueryIndex(%d): expected an error for an out of range index", server.DBSize)
+	}
+	if _, ok := state.Cached(server.DBSize - 2); ok {
+		t.Fatalf("Cached(%d): index was never queried", server.DBSize-2)
+	}
+}
+
+func TestProgrammedPoint(t *testing.T) {
+	server := NewServer(10000)
+	state := NewClient(server.DBSize).InitializeState(server)
+
+	// parity returns the XOR of the entries of hint in every chunk except skip.
+	parity := func(hint *LocalHint, skip uint64) uint64 {
+		var p uint64
+		for i := uint64(0); i < state.ChunkNum; i++ {
+			if i != skip {
+				p ^= server.Query(state.Elem(hint, i))
+			}
+		}
+		return p
+	}
+
+	x := uint64(4321)
+	chunkId := x / state.ChunkSize
+	for round := 0; round < 2; round++ {
+		query, err := state.QueryIndex(x)
+		if err != nil || query.IsDummy() {
+			t.Fatalf("QueryIndex(%d): %v, dummy %v", x, err, query.IsDummy())
+		}
+		backup := state.backupHints[state.backupStart[chunkId]+state.consumedHintNum[chunkId]]
+		if backup.parity != parity(&backup, chunkId) {
+			t.Fatalf("the backup hint parity does not cover every chunk but its own")
+		}
+
+		answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+		if err != nil || answer != server.Query(x) {
+			t.Fatalf("RecoverAnswer(%d): got %d, %v, want %d", x, answer, err, server.Query(x))
+		}
+
+		hint := &state.primaryHints[query.hitId]
+		if hint.key != backup.key || !hint.isProgrammed || hint.programmedPoint != x {
+			t.Fatalf("the hint was not replaced by the backup hint programmed at %d", x)
+		}
+		if got := state.Elem(hint, chunkId); got != x {
+			t.Fatalf("Elem in the programmed chunk: got %d, want %d", got, x)
+		}
+		for i := uint64(0); i < state.ChunkNum; i++ {
+			if i != chunkId && state.Elem(hint, i) != state.Elem(&backup, i) {
+				t.Fatalf("Elem in chunk %d differs from the backup hint", i)
+			}
+		}
+		if hint.parity != backup.parity^answer || hint.parity != parity(hint, noHit) {
+			t.Fatalf("the parity of the programmed hint is not the backup parity XOR the answer")
+		}
+
+		// next an index of another chunk that the programmed hint contains
+		x = state.Elem(hint, (chunkId+1)%state.ChunkNum)
+		chunkId = x / state.ChunkSize
+	}
+}
+
+func TestRecoverAnswerHintsExhausted(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	client.M2 = 1
+	state := client.InitializeState(server)
+
+	// the second query to the same chunk has no backup hint left
+	var queries []ClientQuery
+	for x := uint64(0); x < server.ChunkSize && len(queries) < 2; x++ {
+		query, err := state.QueryIndex(x)
+		if err != nil {
+			t.Fatalf("QueryIndex(%d): %v", x, err)
+		}
+		if !query.IsDummy() {
+			queries = append(queries, query)
+		}
+	}
+	if len(queries) < 2 {
+		t.Skip("not enough primary hints hit chunk 0")
+	}
+
+	if _, err := state.RecoverAnswer(queries[0], server.Process(queries[0].Prepare())); err != nil {
+		t.Fatalf("RecoverAnswer: %v", err)
+	}
+	if _, err := state.RecoverAnswer(queries[1], server.Process(queries[1].Prepare())); err != ErrHintsExhausted {
+		t.Fatalf("RecoverAnswer: got %v, want ErrHintsExhausted", err)
+	}
+	if _, ok := state.localCache[queries[1].Index()]; ok {
+		t.Fatalf("failed recovery should not update the local cache")
+	}
+	if state.consumedHintNum[0] != 1 {
+		t.Fatalf("failed recovery should not consume a backup hint")
+	}
+}
+
+func TestExhaustedChunk(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	client := NewClient(server.DBSize)
+	client.M2 = 3
+	state := client.InitializeStateWithSeed(server, 2)
+
+	// drain chunk 0
+	for x := uint64(0); state.ChunkHintsRemaining(0) > 0; x++ {
+		if x == server.ChunkSize {
+			t.Fatalf("chunk 0 still has %d backup hints after querying all of it", state.ChunkHintsRemaining(0))
+		}
+		if _, err := state.Retrieve(x, server); err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+	}
+	x := server.ChunkSize - 1
+	if _, err := state.QueryIndex(x); !errors.Is(err, ErrHintsExhausted) {
+		t.Fatalf("QueryIndex(%d) in the drained chunk: got %v, want ErrHintsExhausted", x, err)
+	}
+	if _, err := state.Retrieve(x, server); !errors.Is(err, ErrHintsExhausted) {
+		t.Fatalf("Retrieve(%d) in the drained chunk: got %v, want ErrHintsExhausted", x, err)
+	}
+
+	// one index in each of the other chunks still works
+	var indices []uint64
+	for chunkId := uint64(1); chunkId < server.ChunkNum; chunkId++ {
+		indices = append(indices, chunkId*server.ChunkSize+chunkId%server.ChunkSize)
+	}
+	if err := VerifyAgainstPlaintext(state, server, indices); err != nil {
+		t.Fatalf("VerifyAgainstPlaintext: %v", err)
+	}
+}
+
+func TestRemainingQueries(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+	if got := state.RemainingQueries(); got != client.M2 {
+		t.Fatalf("RemainingQueries() = %d before querying, want M2 %d", got, client.M2)
+	}
+
+	// query chunk 0 only, so that it sets the minimum
+	consumed := uint64(0)
+	for x := uint64(0); x < server.ChunkSize && consumed < 5; x++ {
+		query, err := state.QueryIndex(x)
+		if err != nil || query.IsDummy() {
+			continue
+		}
+		if _, err := state.RecoverAnswer(query, server.Process(query.Prepare())); err != nil {
+			t.Fatalf("RecoverAnswer(%d): %v", x, err)
+		}
+		consumed++
+		if got := state.ChunkHintsRemaining(0); got != client.M2-consumed {
+			t.Fatalf("ChunkHintsRemaining(0) = %d after %d queries, want %d", got, consumed, client.M2-consumed)
+		}
+		if got := state.RemainingQueries(); got != client.M2-consumed {
+			t.Fatalf("RemainingQueries() = %d after %d queries, want %d", got, consumed, client.M2-consumed)
+		}
+	}
+	if got := state.ChunkHintsRemaining(1); got != client.M2 {
+		t.Fatalf("ChunkHintsRemaining(1) = %d, want M2 %d", got, client.M2)
+	}
+
+	state.RefreshHints(server, client.M2)
+	if got := state.RemainingQueries(); got != client.M2 {
+		t.Fatalf("RemainingQueries() = %d after RefreshHints, want M2 %d", got, client.M2)
+	}
+}
+
+func TestLocalHintFromBytes(t *testing.T) {
+	server := NewServer(10000)
+	state := NewClient(server.DBSize).InitializeState(server)
+	hint := state.primaryHints[0]
+
+	rebuilt, err := LocalHintFromBytes(hint.KeyBytes(), hint.parity)
+	if err != nil {
+		t.Fatalf("LocalHintFromBytes: %v", err)
+	}
+	if rebuilt.key != hint.key || rebuilt.parity != hint.parity {
+		t.Fatalf("rebuilt hint differs from the original")
+	}
+	for i := uint64(0); i < server.ChunkNum; i++ {
+		if state.Elem(&rebuilt, i) != state.Elem(&hint, i) {
+			t.Fatalf("chunk %d: rebuilt hint has element %d, want %d", i, state.Elem(&rebuilt, i), state.Elem(&hint, i))
+		}
+	}
+
+	// the layout of the key is fixed, so a hint can be rebuilt from bytes produced elsewhere
+	keyBytes := make([]byte, 16)
+	for i := range keyBytes {
+		keyBytes[i] = byte(i)
+	}
+	rebuilt, err = LocalHintFromBytes(keyBytes, 0)
+	if err != nil {
+		t.Fatalf("LocalHintFromBytes: %v", err)
+	}
+	if !bytes.Equal(rebuilt.KeyBytes(), keyBytes) {
+		t.Fatalf("KeyBytes() = %v, want %v", rebuilt.KeyBytes(), keyBytes)
+	}
+	if _, err := LocalHintFromBytes(keyBytes[:15], 0); err == nil {
+		t.Fatalf("LocalHintFromBytes: expected an error for a 15-byte key")
+	}
+}
+
+func TestPerChunkBackups(t *testing.T) {
+	server := NewServer(10000)
+	defaults := NewClient(server.DBSize)
+	backups := make([]uint64, server.ChunkNum)
+	for i := range backups {
+		backups[i] = 4
+	}
+	backups[0] = 40
+	client, err := NewClientWithPerChunkBackups(defaults.Q, defaults.M1, backups)
+	if err != nil {
+		t.Fatalf("NewClientWithPerChunkBackups: %v", err)
+	}
+	state := client.InitializeState(server)
+
+	// most queries go to the hot chunk 0, a few to chunk 1
+	for _, x := range []uint64{server.ChunkSize, server.ChunkSize + 1} {
+		if _, err := state.Retrieve(x, server); err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+	}
+	for x := uint64(0); x < 30; x++ {
+		answer, err := state.Retrieve(x, server)
+		if err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+		if answer != server.Query(x) {
+			t.Fatalf("index %d: got %d, want %d", x, answer, server.Query(x))
+		}
+	}
+
+	utilization := state.HintUtilization()
+	for i, u := range utilization {
+		if want := float64(state.consumedHintNum[i]) / float64(backups[i]); u != want {
+			t.Fatalf("chunk %d: utilization %v, want %v", i, u, want)
+		}
+	}
+	if utilization[0] < 0.75 || utilization[1] < 0.5 || state.ChunkHintsRemaining(0) != 40-state.consumedHintNum[0] {
+		t.Fatalf("utilization of chunks 0 and 1: %v %v", utilization[0], utilization[1])
+	}
+	for i := 2; i < len(utilization); i++ {
+		if utilization[i] > utilization[0] {
+			t.Fatalf("chunk %d is hotter than chunk 0: %v", i, utilization)
+		}
+	}
+
+	if _, err := NewClientWithPerChunkBackups(defaults.Q, defaults.M1, []uint64{1, 0}); err == nil {
+		t.Fatalf("NewClientWithPerChunkBackups: expected an error for a chunk without backup hints")
+	}
+}
+
+func TestTryRandomQuery(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	client.M1 = 1
+	state := client.InitializeState(server)
+
+	// with a single primary hint almost every index is missed
+	misses := 0
+	for i := 0; i < 100; i++ {
+		query, err := state.TryRandomQuery()
+		if err == ErrNoHint {
+			misses++
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TryRandomQuery: %v", err)
+		}
+		if state.Elem(&state.primaryHints[query.hitId], query.chunkId) != query.Index() {
+			t.Fatalf("hint %d does not contain index %d", query.hitId, query.Index())
+		}
+	}
+	if misses == 0 {
+		t.Fatalf("expected ErrNoHint with a single primary hint")
+	}
+
+	dummy := ClientQuery{dummy: true}
+	if _, err := state.RecoverAnswer(dummy, nil); err != ErrNoHint {
+		t.Fatalf("RecoverAnswer(dummy): got %v, want ErrNoHint", err)
+	}
+}
+
+func TestCacheSaturated(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	state := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+	// fill 99% of the cache directly, retrieving that many indices would exhaust the backup hints
+	for x := uint64(0); x < server.DBSize*99/100; x++ {
+		state.localCache[x] = server.Query(x)
+	}
+	if _, err := state.TryRandomQuery(); !errors.Is(err, ErrCacheSaturated) {
+		t.Fatalf("TryRandomQuery: got %v, want ErrCacheSaturated", err)
+	}
+	if _, err := state.RandomQueryConstantTime(); !errors.Is(err, ErrCacheSaturated) {
+		t.Fatalf("RandomQueryConstantTime: got %v, want ErrCacheSaturated", err)
+	}
+
+	// with 10% left, the uncached indices are still found
+	for x := server.DBSize * 9 / 10; x < server.DBSize*99/100; x++ {
+		delete(state.localCache, x)
+	}
+	for i := 0; i < 20; i++ {
+		query, err := state.TryRandomQuery()
+		if errors.Is(err, ErrNoHint) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TryRandomQuery with 10%% uncached: %v", err)
+		}
+		if _, ok := state.localCache[query.index]; ok {
+			t.Fatalf("TryRandomQuery sampled the cached index %d", query.index)
+		}
+	}
+}
+
+func TestSaveLoadClientState(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+
+	// consume some backup hints before saving
+	for q := 0; q < 50; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		if _, err := state.RecoverAnswer(query, server.Process(query.Prepare())); err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := state.Save(&buf); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := LoadClientState(&buf)
+	if err != nil {
+		t.Fatalf("LoadClientState: %v", err)
+	}
+	if !reflect.DeepEqual(state.primaryHints, loaded.primaryHints) ||
+		!reflect.DeepEqual(state.backupHints, loaded.backupHints) ||
+		!reflect.DeepEqual(state.localCache, loaded.localCache) ||
+		!reflect.DeepEqual(state.consumedHintNum, loaded.consumedHintNum) {
+		t.Fatalf("loaded state differs from the saved one")
+	}
+
+	for q := 0; q < 200; q++ {
+		query, err := loaded.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		answer, err := loaded.RecoverAnswer(query, server.Process(query.Prepare()))
+		if err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		if answer != server.Query(query.Index()) {
+			t.Fatalf("index %d: got %d, want %d", query.Index(), answer, server.Query(query.Index()))
+		}
+	}
+
+	if _, err := LoadClientState(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Fatalf("LoadClientState: expected an error for malformed input")
+	}
+}
+
+func TestSeededRunsAreReproducible(t *testing.T) {
+	run := func() []uint64 {
+		server := NewServerWithSeed(10000, 42)
+		client := NewClient(server.DBSize)
+		state := client.InitializeStateWithSeed(server, 7)
+		var answers []uint64
+		for q := 0; q < 50; q++ {
+			query, err := state.TryRandomQuery()
+			if err != nil {
+				continue
+			}
+			answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+			if err != nil {
+				t.Fatalf("RecoverAnswer: %v", err)
+			}
+			answers = append(answers, query.Index(), answer)
+		}
+		return answers
+	}
+
+	if !reflect.DeepEqual(run(), run()) {
+		t.Fatalf("runs with the same seeds differ")
+	}
+	if reflect.DeepEqual(NewServerWithSeed(10000, 1).DB, NewServerWithSeed(10000, 2).DB) {
+		t.Fatalf("different seeds give the same database")
+	}
+}
+
+func TestPreparePunctures(t *testing.T) {
+	offsetVec := []uint64{10, 11, 12, 13, 14}
+	for _, chunkId := range []uint64{0, 2, uint64(len(offsetVec) - 1)} {
+		query := ClientQuery{chunkId: chunkId, offsetVec: append([]uint64{}, offsetVec...)}
+		want := append(append([]uint64{}, offsetVec[:chunkId]...), offsetVec[chunkId+1:]...)
+		for i := 0; i < 2; i++ {
+			if got := query.Prepare(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("chunkId %d: Prepare() = %v, want %v", chunkId, got, want)
+			}
+		}
+		if !reflect.DeepEqual(query.offsetVec, offsetVec) {
+			t.Fatalf("chunkId %d: Prepare modified the offset vector to %v", chunkId, query.offsetVec)
+		}
+	}
+}
+
+func TestPreparePacked(t *testing.T) {
+	server := NewServer(10000)
+	state := NewClient(server.DBSize).InitializeState(server)
+	for q := 0; q < 100; q++ {
+		query := state.RandomQuery()
+		packed := state.PreparePacked(query)
+		if len(packed) >= len(query.Prepare())/2+1 {
+			t.Fatalf("packed %d offsets into %d words", len(query.Prepare()), len(packed))
+		}
+		answer, err := state.RecoverAnswer(query, server.Process(packed))
+		if err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		if answer != server.Query(query.Index()) {
+			t.Fatalf("wrong answer for index %d", query.Index())
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+
+	var queries []ClientQuery
+	for len(queries) < 50 {
+		query, err := state.TryRandomQuery()
+		if err == nil {
+			queries = append(queries, query)
+		}
+	}
+	// force two queries to share a primary hint
+	shared := state.newQuery(state.Elem(&state.primaryHints[queries[0].hitId], (queries[0].chunkId+1)%state.ChunkNum), queries[0].hitId)
+	queries = append(queries, shared)
+
+	answers, errs := state.RecoverBatch(queries, server.ProcessBatch(state.PrepareBatch(queries)))
+	for i, query := range queries {
+		if i == len(queries)-1 {
+			if errs[i] != ErrStaleQuery {
+				t.Fatalf("query sharing a hint: got %v, want ErrStaleQuery", errs[i])
+			}
+			continue
+		}
+		if errs[i] == ErrStaleQuery {
+			continue
+		}
+		if errs[i] != nil {
+			t.Fatalf("query %d: %v", i, errs[i])
+		}
+		if answers[i] != server.Query(query.Index()) {
+			t.Fatalf("index %d: got %d, want %d", query.Index(), answers[i], server.Query(query.Index()))
+		}
+	}
+}
+
+func TestCacheCapacity(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+	state.SetCacheCapacity(10)
+
+	var last uint64
+	for q := 0; q < 300; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		if _, err := state.RecoverAnswer(query, server.Process(query.Prepare())); err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		last = query.Index()
+		if len(state.localCache) > 10 || state.cacheOrder.Len() != len(state.localCache) {
+			t.Fatalf("cache has %d entries, capacity is 10", len(state.localCache))
+		}
+	}
+	if state.localCache[last] != server.Query(last) {
+		t.Fatalf("the most recent answer was evicted")
+	}
+
+	// the queries consumed backup hints, Reset must not hand them out again
+	consumed := append([]uint64(nil), state.consumedHintNum...)
+	if err := state.Reset(); err == nil {
+		t.Fatalf("Reset succeeded after backup hints were consumed")
+	}
+	if len(state.localCache) == 0 {
+		t.Fatalf("a failed Reset cleared the cache")
+	}
+	for chunkId, num := range state.consumedHintNum {
+		if num != consumed[chunkId] {
+			t.Fatalf("a failed Reset changed the consumed hints of chunk %d from %d to %d", chunkId, consumed[chunkId], num)
+		}
+	}
+
+	fresh := client.InitializeState(server)
+	fresh.SetCacheCapacity(10)
+	for _, x := range []uint64{1, 2, 3} {
+		fresh.cachePut(x, server.Query(x))
+	}
+	if err := fresh.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if len(fresh.localCache) != 0 || fresh.cacheOrder.Len() != 0 {
+		t.Fatalf("Reset left %d cache entries", len(fresh.localCache))
+	}
+}
+
+// countingServer counts the Process calls sent to a PIRServer.
+type countingServer struct {
+	PIRServer
+	calls int
+}
+
+func (s *countingServer) Process(offsetVec []uint64) []uint64 {
+	s.calls++
+	return s.PIRServer.Process(offsetVec)
+}
+
+func TestExportImportCache(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	client := NewClient(server.DBSize)
+	state := client.InitializeStateWithSeed(server, 2)
+	indices := []uint64{3, 777, 5000, 9999}
+	for _, x := range indices {
+		if _, err := state.Retrieve(x, server); err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+	}
+	cache := state.ExportCache()
+	if len(cache) != len(indices) {
+		t.Fatalf("ExportCache has %d entries, want %d", len(cache), len(indices))
+	}
+
+	// a restarted client with fresh hints
+	restarted := client.InitializeStateWithSeed(server, 3)
+	if err := restarted.ImportCache(map[uint64]uint64{server.DBSize: 0}); err == nil {
+		t.Fatalf("ImportCache: expected an error for an index out of range")
+	}
+	if err := restarted.ImportCache(cache); err != nil {
+		t.Fatalf("ImportCache: %v", err)
+	}
+	srv := &countingServer{PIRServer: server}
+	for _, x := range indices {
+		if _, err := restarted.QueryIndex(x); !errors.Is(err, ErrAlreadyCached) {
+			t.Fatalf("QueryIndex(%d): got %v, want ErrAlreadyCached", x, err)
+		}
+		if answer, err := restarted.Retrieve(x, srv); err != nil || answer != server.Query(x) {
+			t.Fatalf("Retrieve(%d) = %d, %v, want %d", x, answer, err, server.Query(x))
+		}
+	}
+	if srv.calls != 0 {
+		t.Fatalf("the imported answers made %d server calls", srv.calls)
+	}
+	for i := 0; i < 100; i++ {
+		if _, ok := cache[restarted.RandomQuery().Index()]; ok {
+			t.Fatalf("RandomQuery sampled a cached index")
+		}
+	}
+}
+
+func TestRetrieve(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+	srv := &countingServer{PIRServer: server}
+
+	for _, x := range []uint64{3, 4242, 9999} {
+		answer, err := state.Retrieve(x, srv)
+		if err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+		if answer != server.Query(x) {
+			t.Fatalf("Retrieve(%d): got %d, want %d", x, answer, server.Query(x))
+		}
+
+		// a second read is served from the local cache
+		calls := srv.calls
+		if answer, err := state.Retrieve(x, srv); err != nil || answer != server.Query(x) || srv.calls != calls {
+			t.Fatalf("Retrieve(%d) again: got %d, %v after %d server calls", x, answer, err, srv.calls-calls)
+		}
+	}
+
+	// with a single primary hint almost no index is covered
+	client.M1 = 1
+	state = client.InitializeState(server)
+	x := (state.Elem(&state.primaryHints[0], 0) + 1) % server.ChunkSize
+	if _, err := state.Retrieve(x, srv); err != nil && !errors.Is(err, ErrNoHint) {
+		t.Fatalf("Retrieve(%d): got %v, want ErrNoHint", x, err)
+	}
+}
+
+// plaintextCountingServer counts the plaintext Query calls sent to a PIRServer.
+type plaintextCountingServer struct {
+	PIRServer
+	queries map[uint64]int
+}
+
+func (s *plaintextCountingServer) Query(x uint64) uint64 {
+	s.queries[x]++
+	return s.PIRServer.Query(x)
+}
+
+// StreamChunks streams the chunks of the wrapped Server, which FailRefresh folds into fresh backup hints.
+func (s *plaintextCountingServer) StreamChunks() <-chan []uint64 {
+	return s.PIRServer.(Server).StreamChunks()
+}
+
+func TestDisableCache(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	client.DisableCache = true
+	state := client.InitializeState(server)
+	srv := &countingServer{PIRServer: server}
+
+	x := uint64(777)
+	for q := 1; q <= 3; q++ {
+		answer, err := state.Retrieve(x, srv)
+		if err != nil || answer != server.Query(x) {
+			t.Fatalf("Retrieve(%d): got %d, %v, want %d", x, answer, err, server.Query(x))
+		}
+		if srv.calls < q {
+			t.Fatalf("%d Retrieve calls sent %d queries", q, srv.calls)
+		}
+		if _, ok := state.Cached(x); ok {
+			t.Fatalf("index %d is cached with the cache disabled", x)
+		}
+	}
+	if _, err := state.QueryIndex(x); err != nil {
+		t.Fatalf("QueryIndex(%d) of a retrieved index: %v", x, err)
+	}
+	if used := state.consumedHintNum[x/state.ChunkSize]; used < 3 {
+		t.Fatalf("3 retrievals consumed %d backup hints", used)
+	}
+}
+
+func TestFailureMode(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	client.M2 = 2
+
+	for _, mode := range []FailureMode{FailError, FailDirect, FailRefresh} {
+		state := client.InitializeState(server)
+		state.SetFailureMode(mode)
+		srv := &plaintextCountingServer{server, make(map[uint64]int)}
+
+		// chunk 0 runs out of backup hints after 2 queries
+		var exhausted error
+		direct := 0
+		for x := uint64(0); x < 10; x++ {
+			answer, err := state.Retrieve(x, srv)
+			if errors.Is(err, ErrHintsExhausted) {
+				exhausted = err
+				continue
+			}
+			if err != nil {
+				t.Fatalf("mode %d: Retrieve(%d): %v", mode, x, err)
+			}
+			if answer != server.Query(x) {
+				t.Fatalf("mode %d: index %d got %d, want %d", mode, x, answer, server.Query(x))
+			}
+			direct += srv.queries[x]
+		}
+
+		switch mode {
+		case FailError:
+			if exhausted == nil {
+				t.Fatalf("FailError: expected ErrHintsExhausted")
+			}
+		case FailDirect:
+			if exhausted != nil || direct == 0 {
+				t.Fatalf("FailDirect: got %v after %d plaintext queries of the retrieved indices", exhausted, direct)
+			}
+		case FailRefresh:
+			// the refreshed hints come from streamed chunks: a plaintext query of their entries reveals their sets
+			if exhausted != nil || len(srv.queries) != 0 {
+				t.Fatalf("FailRefresh: got %v after plaintext queries of %d indices", exhausted, len(srv.queries))
+			}
+		}
+	}
+}
+
+func TestRefreshHints(t *testing.T) {
+	server := NewServer(4096)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+	state.SetCacheCapacity(500)
+
+	for q := uint64(0); q < 5*client.Q; q++ {
+		if q%(client.Q/4) == 0 {
+			if err := state.RefreshHints(server, client.M2); err != nil {
+				t.Fatalf("RefreshHints: %v", err)
+			}
+		}
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+		if err != nil {
+			t.Fatalf("query %d: %v", q, err)
+		}
+		if answer != server.Query(query.Index()) {
+			t.Fatalf("query %d: index %d got %d, want %d", q, query.Index(), answer, server.Query(query.Index()))
+		}
+	}
+
+	// a stream that ends early leaves the consumed hints consumed, a full one refreshes them
+	consumed := append([]uint64(nil), state.consumedHintNum...)
+	short := make(chan []uint64, 1)
+	short <- server.DB[:server.ChunkSize]
+	close(short)
+	if err := state.RefreshHintsFromStream(short, client.M2); err == nil {
+		t.Fatalf("RefreshHintsFromStream of a single chunk succeeded")
+	}
+	if !reflect.DeepEqual(state.consumedHintNum, consumed) {
+		t.Fatalf("a failed RefreshHintsFromStream changed the consumed hints")
+	}
+	if err := state.RefreshHintsFromStream(server.StreamChunks(), client.M2); err != nil {
+		t.Fatalf("RefreshHintsFromStream: %v", err)
+	}
+	if got := state.RemainingQueries(); got != client.M2 {
+		t.Fatalf("RemainingQueries() = %d after RefreshHintsFromStream, want M2 %d", got, client.M2)
+	}
+	for q := 0; q < 100; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		if answer, err := state.RecoverAnswer(query, server.Process(query.Prepare())); err != nil || answer != server.Query(query.Index()) {
+			t.Fatalf("after RefreshHintsFromStream: index %d got %d, %v, want %d", query.Index(), answer, err, server.Query(query.Index()))
+		}
+	}
+}
+
+func TestRotateKeys(t *testing.T) {
+	server := NewServer(4096)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+
+	recover := func() uint64 {
+		query := state.RandomQuery()
+		answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+		if err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		if answer != server.Query(query.Index()) {
+			t.Fatalf("index %d got %d, want %d", query.Index(), answer, server.Query(query.Index()))
+		}
+		return query.Index()
+	}
+	for q := 0; q < 10; q++ {
+		recover()
+	}
+
+	oldKeys := make(map[util.PrfKey]bool)
+	for _, hint := range append(append([]LocalHint(nil), state.primaryHints...), state.backupHints...) {
+		oldKeys[hint.key] = true
+	}
+	x := recover()
+	state.RotateKeys(server, true)
+	for _, hint := range append(append([]LocalHint(nil), state.primaryHints...), state.backupHints...) {
+		if oldKeys[hint.key] {
+			t.Fatalf("hint key %v survived the rotation", hint.key)
+		}
+	}
+	if answer, ok := state.Cached(x); !ok || answer != server.Query(x) {
+		t.Fatalf("Cached(%d) = %d, %v after rotating with keepCache", x, answer, ok)
+	}
+	for q := 0; q < 10; q++ {
+		recover()
+	}
+
+	state.RotateKeys(server, false)
+	if _, ok := state.Cached(x); ok {
+		t.Fatalf("index %d still cached after rotating without keepCache", x)
+	}
+	for q := 0; q < 10; q++ {
+		recover()
+	}
+}
+
+func TestRebindServer(t *testing.T) {
+	first := NewServerWithSeed(10000, 1)
+	second := NewServerWithSeed(10000, 2)
+	state := NewClient(first.DBSize).InitializeState(first)
+	if err := VerifyAgainstPlaintext(state, first, []uint64{1, 2, 3, 5000}); err != nil {
+		t.Fatalf("first server: %v", err)
+	}
+
+	keys := make([]util.PrfKey, len(state.primaryHints))
+	for j, hint := range state.primaryHints {
+		keys[j] = hint.key
+	}
+	if err := state.RebindServer(second); err != nil {
+		t.Fatalf("RebindServer: %v", err)
+	}
+	for j, hint := range state.primaryHints {
+		if hint.key != keys[j] {
+			t.Fatalf("primary hint %d got a new key", j)
+		}
+	}
+	// 5000 is no longer cached and its programmed hint now holds the entry of the second server
+	if err := VerifyAgainstPlaintext(state, second, []uint64{5000, 4, 5001, 9999}); err != nil {
+		t.Fatalf("second server: %v", err)
+	}
+
+	if err := state.RebindServer(first); err != nil {
+		t.Fatalf("RebindServer: %v", err)
+	}
+	if err := VerifyAgainstPlaintext(state, first, []uint64{2, 6, 5002}); err != nil {
+		t.Fatalf("first server again: %v", err)
+	}
+
+	if err := state.RebindServer(NewServer(10001)); err == nil {
+		t.Fatalf("RebindServer: expected an error for a different DBSize")
+	}
+}
+
+func TestEstimateClientMemory(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	estimate := client.EstimateClientMemory(server.DBSize)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	state := client.InitializeState(server)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	retained := after.HeapAlloc - before.HeapAlloc
+
+	// the setup allocates everything but the local cache
+	if setup := estimate - 16*client.Q; retained < setup/2 || retained > 2*setup {
+		t.Fatalf("setup retained %d bytes, estimated %d", retained, setup)
+	}
+	if hints := uint64(len(state.primaryHints)+len(state.backupHints)) * uint64(unsafe.Sizeof(LocalHint{})); estimate < hints {
+		t.Fatalf("estimate %d is below the %d bytes of hints", estimate, hints)
+	}
+
+	if got, want := server.EstimateServerMemory(), 8*server.ChunkSize*server.ChunkNum; got < want || got > want+1024 {
+		t.Fatalf("EstimateServerMemory() = %d, want about %d", got, want)
+	}
+}
+
+func TestApplyUpdate(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+
+	// retrieve some indices first, so that their hints are programmed and they are cached
+	var programmed []uint64
+	for x := uint64(0); x < 10; x++ {
+		if _, err := state.Retrieve(x, server); err == nil {
+			programmed = append(programmed, x)
+		}
+	}
+
+	updated := map[uint64]bool{}
+	for i, x := range append(programmed, 500, 5000, 9999) {
+		state.ApplyUpdate(x, server.Update(x, uint64(i)+12345))
+		updated[x] = true
+	}
+	// the hints programmed at the updated points are now used for other indices of their chunks
+	for x := uint64(0); x < 300; x++ {
+		answer, err := state.Retrieve(x, server)
+		if err != nil {
+			continue
+		}
+		if answer != server.Query(x) {
+			t.Fatalf("index %d (updated %v): got %d, want %d", x, updated[x], answer, server.Query(x))
+		}
+	}
+	for _, x := range []uint64{500, 5000, 9999} {
+		if answer, err := state.Retrieve(x, server); err == nil && answer != server.Query(x) {
+			t.Fatalf("index %d: got %d, want %d", x, answer, server.Query(x))
+		}
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	state := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+	if state.Version() != server.Version {
+		t.Fatalf("the state has version %d, the server %d", state.Version(), server.Version)
+	}
+
+	delta := server.Update(1234, 42)
+	if server.Version != 1 {
+		t.Fatalf("Update: got version %d, want 1", server.Version)
+	}
+	if _, err := state.Retrieve(1234, server); !errors.Is(err, ErrStaleHints) {
+		t.Fatalf("Retrieve after a missed update: got %v, want ErrStaleHints", err)
+	}
+	query, err := state.QueryIndex(5678)
+	if err != nil || query.IsDummy() {
+		t.Fatalf("QueryIndex: %v", err)
+	}
+	parities, version := server.ProcessVersioned(query.Prepare())
+	if _, err := state.RecoverAnswerVersioned(query, parities, version); !errors.Is(err, ErrStaleHints) {
+		t.Fatalf("RecoverAnswerVersioned after a missed update: got %v, want ErrStaleHints", err)
+	}
+
+	state.ApplyUpdate(1234, delta)
+	if answer, err := state.RecoverAnswerVersioned(query, parities, version); err != nil || answer != server.Query(5678) {
+		t.Fatalf("RecoverAnswerVersioned: got %d, %v, want %d", answer, err, server.Query(5678))
+	}
+	if err := VerifyAgainstPlaintext(state, server, []uint64{1234, 9999}); err != nil {
+		t.Fatalf("VerifyAgainstPlaintext: %v", err)
+	}
+
+	server.Append([]uint64{7})
+	if _, err := state.Retrieve(0, server); !errors.Is(err, ErrStaleHints) {
+		t.Fatalf("Retrieve after Append: got %v, want ErrStaleHints", err)
+	}
+	if state = NewClient(server.DBSize).InitializeState(server); state.Version() != 2 {
+		t.Fatalf("the state has version %d after setup, want 2", state.Version())
+	}
+}
+
+func TestParams(t *testing.T) {
+	if _, err := NewServerWithParams(10000, 0); err == nil {
+		t.Fatalf("NewServerWithParams: expected an error for chunk size 0")
+	}
+	if _, err := NewServerWithParams(10000, 10001); err == nil {
+		t.Fatalf("NewServerWithParams: expected an error for a chunk size above DBSize")
+	}
+	if _, err := NewClientWithParams(10, 0, 1); err == nil {
+		t.Fatalf("NewClientWithParams: expected an error for M1 0")
+	}
+	if _, err := NewClientWithParams(10, 1, 0); err == nil {
+		t.Fatalf("NewClientWithParams: expected an error for M2 0")
+	}
+
+	server, err := NewServerWithParams(10000, 250)
+	if err != nil {
+		t.Fatalf("NewServerWithParams: %v", err)
+	}
+	if server.ChunkNum != 40 || uint64(len(server.DB)) != 10000 {
+		t.Fatalf("got ChunkNum %d and %d entries, want 40 and 10000", server.ChunkNum, len(server.DB))
+	}
+	client, err := NewClientWithParams(100, 4000, 2)
+	if err != nil {
+		t.Fatalf("NewClientWithParams: %v", err)
+	}
+	state := client.InitializeState(server)
+
+	// the third query to chunk 0 runs out of backup hints
+	exhausted := false
+	for x := uint64(0); x < server.ChunkSize && !exhausted; x++ {
+		query, err := state.QueryIndex(x)
+		if errors.Is(err, ErrHintsExhausted) {
+			exhausted = true
+			if state.consumedHintNum[0] != 2 {
+				t.Fatalf("exhausted after %d backup hints, want 2", state.consumedHintNum[0])
+			}
+			continue
+		}
+		if err != nil || query.IsDummy() {
+			continue
+		}
+		answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+		switch {
+		case err == ErrHintsExhausted:
+			exhausted = true
+			if state.consumedHintNum[0] != 2 {
+				t.Fatalf("exhausted after %d backup hints, want 2", state.consumedHintNum[0])
+			}
+		case err != nil:
+			t.Fatalf("RecoverAnswer(%d): %v", x, err)
+		case answer != server.Query(x):
+			t.Fatalf("index %d: got %d, want %d", x, answer, server.Query(x))
+		}
+	}
+	if !exhausted {
+		t.Fatalf("expected ErrHintsExhausted with M2 = 2")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, DBSize := range []uint64{100, 10000, 1000000} {
+		if err := NewClient(DBSize).Validate(DBSize); err != nil {
+			t.Fatalf("default parameters for DBSize %d: %v", DBSize, err)
+		}
+	}
+	good := NewClient(10000)
+	for _, c := range []Client{
+		{Q: good.Q, M1: 0, M2: good.M2},
+		{Q: good.Q, M1: good.M1, M2: 0},
+		{Q: good.Q, M1: 10, M2: good.M2}, // almost every query misses
+		{Q: good.Q, M1: good.M1, M2: 2},  // ~9 queries per chunk
+		{Q: 100 * good.Q, M1: good.M1, M2: good.M2},
+		{Q: good.Q, M1: good.M1, PerChunkM2: make([]uint64, 99)},
+	} {
+		if err := c.Validate(10000); err == nil {
+			t.Fatalf("Validate accepted Q %d, M1 %d, M2 %d", c.Q, c.M1, c.M2)
+		}
+	}
+	if err := (Client{Q: 3, M1: 1, M2: 3}).Validate(1); err != nil {
+		t.Fatalf("Validate for a single entry: %v", err)
+	}
+}
+
+func TestFailureProbability(t *testing.T) {
+	server := NewServerWithSeed(400, 1)
+	rng := rand.New(rand.NewSource(2))
+
+	// per query: the fraction of indices that no primary hint covers
+	const M1 = 40
+	noHint, _ := FailureProbability(server.DBSize, server.ChunkSize, server.ChunkNum, 1, M1, 1)
+	misses, total := 0, 0
+	for seed := int64(0); seed < 20; seed++ {
+		state := Client{Q: 1, M1: M1, M2: 1}.InitializeStateWithSeed(server, seed)
+		for x := uint64(0); x < server.DBSize; x++ {
+			query, err := state.QueryIndex(x)
+			if err != nil {
+				t.Fatalf("QueryIndex: %v", err)
+			}
+			if query.IsDummy() {
+				misses++
+			}
+			total++
+		}
+	}
+	if got := float64(misses) / float64(total); math.Abs(got-noHint) > 0.02 {
+		t.Fatalf("empirical no-hint rate %.3f, analysis %.3f", got, noHint)
+	}
+
+	// Q distinct queries with few backup hints. The analysis is a union bound over the chunks and assumes
+	// independent queries, so it is above the empirical rate, but not by much.
+	client := Client{Q: 40, M1: 200, M2: 5}
+	_, exhaust := FailureProbability(server.DBSize, server.ChunkSize, server.ChunkNum, client.Q, client.M1, client.M2)
+	const trials = 1000
+	exhausted := 0
+	for trial := 0; trial < trials; trial++ {
+		state := client.InitializeStateWithSeed(server, rng.Int63())
+		for _, x := range rng.Perm(int(server.DBSize))[:client.Q] {
+			if _, err := state.Retrieve(uint64(x), server); errors.Is(err, ErrHintsExhausted) {
+				exhausted++
+				break
+			}
+		}
+	}
+	if got := float64(exhausted) / trials; got > exhaust || got < exhaust/2 {
+		t.Fatalf("empirical exhaustion rate %.3f, analysis %.3f", got, exhaust)
+	}
+}
+
+func TestNewClientForRange(t *testing.T) {
+	server := NewServer(100000)
+	const start, end = 40000, 50000
+	client, err := NewClientForRange(start, end)
+	if err != nil {
+		t.Fatalf("NewClientForRange: %v", err)
+	}
+	if want := NewClient(end - start); client.M1 != want.M1 || client.Q != want.Q {
+		t.Fatalf("got M1 %d, Q %d, want the defaults for the window, M1 %d, Q %d", client.M1, client.Q, want.M1, want.Q)
+	}
+	state := client.InitializeState(server)
+	if state.DBSize != end-start {
+		t.Fatalf("the state covers %d entries, want %d", state.DBSize, end-start)
+	}
+	window, err := server.Window(start, end)
+	if err != nil {
+		t.Fatalf("Window: %v", err)
+	}
+
+	indices := []uint64{start, start + 1, 45678, end - 1}
+	for _, x := range indices {
+		answer, err := state.Retrieve(x, window)
+		if err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+		if answer != server.Query(x) {
+			t.Fatalf("index %d: got %d, want %d", x, answer, server.Query(x))
+		}
+		if cached, ok := state.Cached(x); !ok || cached != answer {
+			t.Fatalf("Cached(%d) = %d, %v", x, cached, ok)
+		}
+	}
+	query, err := state.TryRandomQuery()
+	for err != nil {
+		query, err = state.TryRandomQuery()
+	}
+	if x := query.Index(); x < start || x >= end {
+		t.Fatalf("random query of index %d outside the window", x)
+	}
+
+	for _, x := range []uint64{0, start - 1, end, 99999} {
+		if _, err := state.Retrieve(x, window); err == nil {
+			t.Fatalf("Retrieve(%d) outside the window succeeded", x)
+		}
+		if _, err := state.QueryIndex(x); err == nil {
+			t.Fatalf("QueryIndex(%d) outside the window succeeded", x)
+		}
+	}
+
+	if _, err := NewClientForRange(5, 5); err == nil {
+		t.Fatalf("NewClientForRange: expected an error for an empty range")
+	}
+	if _, err := server.Window(start, 200000); err == nil {
+		t.Fatalf("Window: expected an error for a window past the end")
+	}
+}
+
+func TestTinyDBSize(t *testing.T) {
+	for _, DBSize := range []uint64{1, 2, 3, 4} {
+		server := NewServerWithSeed(DBSize, int64(DBSize))
+		client := NewClient(DBSize)
+		if client.Q == 0 || client.M1 == 0 || client.M2 == 0 || server.ChunkNum == 0 {
+			t.Fatalf("DBSize %d: Q %d, M1 %d, M2 %d, ChunkNum %d", DBSize, client.Q, client.M1, client.M2, server.ChunkNum)
+		}
+		if err := client.Validate(DBSize); err != nil {
+			t.Fatalf("DBSize %d: Validate: %v", DBSize, err)
+		}
+
+		state := client.InitializeStateWithSeed(server, 1)
+		indices := make([]uint64, DBSize)
+		for x := range indices {
+			indices[x] = uint64(x)
+		}
+		if err := VerifyAgainstPlaintext(state, server, indices); err != nil {
+			t.Fatalf("DBSize %d: %v", DBSize, err)
+		}
+		// repeated indices come from the local cache
+		if err := VerifyAgainstPlaintext(state, server, indices); err != nil {
+			t.Fatalf("DBSize %d, cached: %v", DBSize, err)
+		}
+	}
+}
+
+func TestAllOffsets(t *testing.T) {
+	server := NewServer(10000)
+	state := NewClient(server.DBSize).InitializeState(server)
+	// program some of the primary hints
+	for q := 0; q < 50; q++ {
+		query := state.RandomQuery()
+		if _, err := state.RecoverAnswer(query, server.Process(query.Prepare())); err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+	}
+
+	hitIds := []uint64{0, 1, 2, 2, state.config.M1 - 1}
+	for j := range state.primaryHints {
+		if state.primaryHints[j].isProgrammed {
+			hitIds = append(hitIds, uint64(j))
+		}
+	}
+	for _, cacheOffsets := range []bool{false, true} {
+		state.SetOffsetCache(cacheOffsets)
+		for k, vec := range state.AllOffsets(hitIds) {
+			if want := state.newQuery(0, hitIds[k]).offsetVec; !reflect.DeepEqual(vec, want) {
+				t.Fatalf("offset cache %v, hint %d: AllOffsets differs from the query", cacheOffsets, hitIds[k])
+			}
+		}
+	}
+}
+
+func TestOffsetCache(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+
+	for _, hints := range [][]LocalHint{state.primaryHints, state.backupHints[:100]} {
+		for j := range hints {
+			uncached := make([]uint64, state.ChunkNum)
+			for i := uint64(0); i < state.ChunkNum; i++ {
+				uncached[i] = state.Elem(&hints[j], i)
+			}
+			state.SetOffsetCache(true)
+			for i := uint64(0); i < state.ChunkNum; i++ {
+				if got := state.Elem(&hints[j], i); got != uncached[i] {
+					t.Fatalf("hint %d chunk %d: cached %d, uncached %d", j, i, got, uncached[i])
+				}
+			}
+			state.SetOffsetCache(false)
+		}
+	}
+
+	state.SetOffsetCache(true)
+	if err := VerifyAgainstPlaintext(state, server, []uint64{1, 2, 3, 5000, 9999}); err != nil {
+		t.Fatalf("VerifyAgainstPlaintext with the offset cache: %v", err)
+	}
+}
+
+func benchmarkQuery(b *testing.B, cacheOffsets bool) {
+	server := NewServerWithSeed(100000, 1)
+	client := NewClient(server.DBSize)
+	state := client.InitializeStateWithSeed(server, 2)
+	state.SetOffsetCache(cacheOffsets)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		query.Prepare()
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	benchmarkQuery(b, false)
+}
+
+func BenchmarkQueryOffsetCache(b *testing.B) {
+	benchmarkQuery(b, true)
+}
+
+// cancelAfterCtx is canceled after its Err method was called n times.
+type cancelAfterCtx struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfterCtx) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestInitializeStateContext(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+
+	ctx := &cancelAfterCtx{context.Background(), int(server.ChunkNum / 2)}
+	if state, err := client.InitializeStateContext(ctx, server); err != context.Canceled || state != nil {
+		t.Fatalf("InitializeStateContext: got %v, want context.Canceled", err)
+	}
+	if ctx.n != -1 {
+		t.Fatalf("setup went on for %d chunks after the cancellation", -1-ctx.n)
+	}
+
+	state, err := client.InitializeStateContext(context.Background(), server)
+	if err != nil {
+		t.Fatalf("InitializeStateContext: %v", err)
+	}
+	if err := VerifyAgainstPlaintext(state, server, []uint64{0, 1, 2}); err != nil {
+		t.Fatalf("VerifyAgainstPlaintext: %v", err)
+	}
+
+	offsetVecs := [][]uint64{randomOffsetVec(server, 1), randomOffsetVec(server, 2)}
+	if _, err := server.ProcessBatchContext(&cancelAfterCtx{context.Background(), 1}, offsetVecs); err != context.Canceled {
+		t.Fatalf("ProcessBatchContext: got %v, want context.Canceled", err)
+	}
+}
+
+func TestInitializeStateStreaming(t *testing.T) {
+	server := NewServerWithSeed(10001, 3)
+	raw := make([]byte, 8*server.DBSize)
+	for i := uint64(0); i < server.DBSize; i++ {
+		binary.LittleEndian.PutUint64(raw[8*i:], server.DB[i])
+	}
+
+	client := NewClient(server.DBSize)
+	want := client.InitializeStateWithSeed(server, 4)
+	got, err := client.InitializeStateStreamingWithSeed(bytes.NewReader(raw), server.DBSize, 4)
+	if err != nil {
+		t.Fatalf("InitializeStateStreamingWithSeed: %v", err)
+	}
+	if !reflect.DeepEqual(got.primaryHints, want.primaryHints) || !reflect.DeepEqual(got.backupHints, want.backupHints) {
+		t.Fatalf("streaming setup gives different hints")
+	}
+
+	if _, err := client.InitializeStateStreaming(bytes.NewReader(raw[:800]), server.DBSize); err == nil {
+		t.Fatalf("InitializeStateStreaming: expected an error for short input")
+	}
+}
+
+func TestInitializeStateParallel(t *testing.T) {
+	server := NewServerWithSeed(10007, 1)
+	layout, err := NewServerWithBoundaries([]uint64{0, 50, 100, 200, 300, 400})
+	if err != nil {
+		t.Fatalf("NewServerWithBoundaries: %v", err)
+	}
+	layoutClient, err := NewClientWithBoundaries(layout.Boundaries)
+	if err != nil {
+		t.Fatalf("NewClientWithBoundaries: %v", err)
+	}
+	for _, tc := range []struct {
+		server Server
+		client Client
+	}{
+		{server, NewClient(server.DBSize)},
+		{layout, layoutClient},
+	} {
+		serial := tc.client.InitializeStateWithSeed(tc.server, 2)
+		for _, workers := range []int{0, 2, 3, 8, 100000} {
+			parallel := tc.client.InitializeStateParallelWithSeed(tc.server, workers, 2)
+			if !reflect.DeepEqual(parallel.primaryHints, serial.primaryHints) || !reflect.DeepEqual(parallel.backupHints, serial.backupHints) {
+				t.Fatalf("DBSize %d, %d workers: the hints differ from the serial setup", tc.server.DBSize, workers)
+			}
+		}
+	}
+}
+
+func TestInitializeStateFromStream(t *testing.T) {
+	server := NewServerWithSeed(10001, 3)
+	client := NewClient(server.DBSize)
+	want := client.InitializeStateWithSeed(server, 4)
+	got, err := client.InitializeStateFromStreamWithSeed(server.StreamChunks(), server.DBSize, 4)
+	if err != nil {
+		t.Fatalf("InitializeStateFromStreamWithSeed: %v", err)
+	}
+	if !reflect.DeepEqual(got.primaryHints, want.primaryHints) || !reflect.DeepEqual(got.backupHints, want.backupHints) {
+		t.Fatalf("setup from the stream gives different hints")
+	}
+
+	short := make(chan []uint64, 1)
+	short <- server.DB[:server.ChunkSize]
+	close(short)
+	if _, err := client.InitializeStateFromStream(short, server.DBSize); err == nil {
+		t.Fatalf("InitializeStateFromStream: expected an error for a closed stream")
+	}
+}
+
+func TestClone(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+	state.SetCacheCapacity(100)
+	if err := VerifyAgainstPlaintext(state, server, []uint64{7, 8}); err != nil {
+		t.Fatalf("VerifyAgainstPlaintext: %v", err)
+	}
+
+	clone := state.Clone()
+	if !reflect.DeepEqual(state.primaryHints, clone.primaryHints) || !reflect.DeepEqual(state.localCache, clone.localCache) {
+		t.Fatalf("clone differs from the original")
+	}
+
+	// diverging query sequences in the same chunk consume backup hints independently
+	if err := VerifyAgainstPlaintext(state, server, []uint64{10, 11, 12}); err != nil {
+		t.Fatalf("original: %v", err)
+	}
+	if err := VerifyAgainstPlaintext(clone, server, []uint64{20, 30, 40, 50, 60}); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	if state.consumedHintNum[0] == clone.consumedHintNum[0] {
+		t.Fatalf("original and clone share the consumed hint count %d", state.consumedHintNum[0])
+	}
+	if _, ok := state.localCache[20]; ok {
+		t.Fatalf("the clone's answer leaked into the original cache")
+	}
+	if err := VerifyAgainstPlaintext(state, server, []uint64{20, 30}); err != nil {
+		t.Fatalf("original after the clone queried: %v", err)
+	}
+}
+
+func TestRecoverAnswerMalformedResponse(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+
+	var query ClientQuery
+	for {
+		var err error
+		if query, err = state.TryRandomQuery(); err == nil {
+			break
+		}
+	}
+	parities := server.Process(query.Prepare())
+	for _, bad := range [][]uint64{nil, parities[:len(parities)-1], append(parities, 0)} {
+		if _, err := state.RecoverAnswer(query, bad); err != ErrMalformedResponse {
+			t.Fatalf("%d parities: got %v, want ErrMalformedResponse", len(bad), err)
+		}
+	}
+	answer, err := state.RecoverAnswer(query, parities)
+	if err != nil || answer != server.Query(query.Index()) {
+		t.Fatalf("RecoverAnswer after malformed responses: got %d, %v", answer, err)
+	}
+}
+
+func TestServeLocally(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	state := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+
+	x := uint64(4321)
+	if state.CanServeLocally(x) {
+		t.Fatalf("CanServeLocally(%d) before retrieving it", x)
+	}
+	if _, ok := state.ServeLocally(x); ok {
+		t.Fatalf("ServeLocally(%d) before retrieving it", x)
+	}
+	if _, err := state.Retrieve(x, server); err != nil {
+		t.Fatalf("Retrieve(%d): %v", x, err)
+	}
+	if !state.CanServeLocally(x) {
+		t.Fatalf("CanServeLocally(%d) after retrieving it", x)
+	}
+	if answer, ok := state.ServeLocally(x); !ok || answer != server.Query(x) {
+		t.Fatalf("ServeLocally(%d) = %d, %v, want %d", x, answer, ok, server.Query(x))
+	}
+	if state.CanServeLocally(server.DBSize) {
+		t.Fatalf("CanServeLocally(%d) out of range", server.DBSize)
+	}
+
+	// without the cache, the hint programmed at x also spans the other chunks
+	client := NewClient(server.DBSize)
+	client.DisableCache = true
+	state = client.InitializeStateWithSeed(server, 2)
+	if _, err := state.Retrieve(x, server); err != nil {
+		t.Fatalf("Retrieve(%d): %v", x, err)
+	}
+	if hitId := state.findHit(x); hitId == noHit || !state.primaryHints[hitId].isProgrammed {
+		t.Fatalf("no hint is programmed at %d", x)
+	}
+	if state.CanServeLocally(x) {
+		t.Fatalf("CanServeLocally(%d) without the cache in %d chunks", x, state.ChunkNum)
+	}
+
+	// in a single chunk, the programmed hint is the entry itself
+	single, err := NewServerWithParams(100, 100)
+	if err != nil {
+		t.Fatalf("NewServerWithParams: %v", err)
+	}
+	client = NewClient(single.DBSize)
+	client.DisableCache = true
+	state = client.InitializeStateWithSeed(single, 2)
+	x = 42
+	if _, err := state.Retrieve(x, single); err != nil {
+		t.Fatalf("single chunk: Retrieve(%d): %v", x, err)
+	}
+	if !state.CanServeLocally(x) {
+		t.Fatalf("single chunk: CanServeLocally(%d) after retrieving it", x)
+	}
+	if answer, ok := state.ServeLocally(x); !ok || answer != single.Query(x) {
+		t.Fatalf("single chunk: ServeLocally(%d) = %d, %v, want %d", x, answer, ok, single.Query(x))
+	}
+}
+
+func TestProgrammedHintReuse(t *testing.T) {
+	// a single primary hint: every query after the first one reuses a hint that is programmed
+	server := NewServerWithSeed(10000, 1)
+	client, err := NewClientWithParams(200, 1, 20)
+	if err != nil {
+		t.Fatalf("NewClientWithParams: %v", err)
+	}
+	client.DisableCache = true
+	layout, err := NewServerWithBoundaries([]uint64{0, 50, 100, 200, 300, 400})
+	if err != nil {
+		t.Fatalf("NewServerWithBoundaries: %v", err)
+	}
+	layoutClient := client
+	layoutClient.Boundaries = layout.Boundaries
+
+	for _, tc := range []struct {
+		name   string
+		server Server
+		client Client
+		query  func(*ClientState) (ClientQuery, error)
+	}{
+		{"random", server, client, (*ClientState).TryRandomQuery},
+		{"constant time", server, client, (*ClientState).RandomQueryConstantTime},
+		{"boundaries", layout, layoutClient, (*ClientState).TryRandomQuery},
+	} {
+		state := tc.client.InitializeStateWithSeed(tc.server, 2)
+		var last ClientQuery
+		for queries := 0; queries < 50; {
+			query, err := tc.query(state)
+			if errors.Is(err, ErrNoHint) {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: query: %v", tc.name, err)
+			}
+			if queries > 0 && !state.primaryHints[query.hitId].isProgrammed {
+				t.Fatalf("%s: query %d does not reuse the programmed hint", tc.name, queries)
+			}
+			answer, err := state.RecoverAnswer(query, tc.server.Process(query.Prepare()))
+			if err != nil || answer != tc.server.Query(query.Index()) {
+				t.Fatalf("%s: query %d of index %d: got %d, %v, want %d", tc.name, queries, query.Index(), answer, err, tc.server.Query(query.Index()))
+			}
+			last = query
+			queries++
+		}
+
+		// the hint is programmed at the last index, which a new query of that index reuses
+		for k := 0; k < 3; k++ {
+			query, err := state.QueryIndex(last.Index())
+			if err != nil || query.IsDummy() {
+				t.Fatalf("%s: QueryIndex of the programmed point: %v", tc.name, err)
+			}
+			answer, err := state.RecoverAnswer(query, tc.server.Process(query.Prepare()))
+			if err != nil || answer != tc.server.Query(last.Index()) {
+				t.Fatalf("%s: programmed point %d: got %d, %v, want %d", tc.name, last.Index(), answer, err, tc.server.Query(last.Index()))
+			}
+		}
+
+		// two queries built on the same hint: the second one is stale once the first one reprogrammed it
+		first, err := state.QueryIndex(last.Index())
+		if err != nil {
+			t.Fatalf("%s: QueryIndex: %v", tc.name, err)
+		}
+		second, err := state.QueryIndex(last.Index())
+		if err != nil {
+			t.Fatalf("%s: QueryIndex: %v", tc.name, err)
+		}
+		if _, err := state.RecoverAnswer(first, tc.server.Process(first.Prepare())); err != nil {
+			t.Fatalf("%s: RecoverAnswer of the first query: %v", tc.name, err)
+		}
+		if _, err := state.RecoverAnswer(second, tc.server.Process(second.Prepare())); !errors.Is(err, ErrStaleQuery) {
+			t.Fatalf("%s: RecoverAnswer of the second query: got %v, want ErrStaleQuery", tc.name, err)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	// a set {3, 7, 12} of three chunks of 5 entries, queried at 7 in chunk 1
+	db := []uint64{0, 0, 0, 31, 0, 0, 0, 47, 0, 0, 0, 0, 12, 0, 0}
+	primaryParity := db[3] ^ db[7] ^ db[12]
+	// the i-th guess is the parity of the set without its element in chunk i
+	parities := []uint64{db[7] ^ db[12], db[3] ^ db[12], db[3] ^ db[7]}
+	for chunkId, want := range []uint64{db[3], db[7], db[12]} {
+		if got := Recover(uint64(chunkId), primaryParity, parities); got != want {
+			t.Fatalf("Recover(%d): got %d, want %d", chunkId, got, want)
+		}
+	}
+
+	// with the parities of a server and the hint of a real query
+	server := NewServerWithSeed(10000, 1)
+	state := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+	query, err := state.QueryIndex(4321)
+	if err != nil || query.IsDummy() {
+		t.Fatalf("QueryIndex: %v", err)
+	}
+	primaryParity = state.Hints()[query.HitID()].Parity
+	if got := Recover(query.ChunkID(), primaryParity, server.Process(query.Prepare())); got != server.Query(4321) {
+		t.Fatalf("Recover: got %d, want %d", got, server.Query(4321))
+	}
+}
@@ -0,0 +1,73 @@
+package piano
+
+import "fmt"
+
+// The constant-time variants below address a local timing side channel: an attacker who can time the
+// client's query generation (for example a co-resident process) learns from an early exit how far into
+// the primary hints the match was, and from the programmed-point branch in Elem whether a programmed hint
+// was involved. Both correlate with the queried index. The variants always scan all M1 hints and select
+// via masks instead of branches. They do not hide the local cache lookup, the final ErrNoHint outcome,
+// or memory access patterns, and they ignore the offset cache, whose lookups depend on the hint.
+
+// ctEq returns 1 if a == b and 0 otherwise, without branches.
+func ctEq(a uint64, b uint64) uint64 {
+	x := a ^ b
+	return ((x | -x) >> 63) ^ 1
+}
+
+// ctSelect returns a if mask is all ones and b if mask is 0.
+func ctSelect(mask uint64, a uint64, b uint64) uint64 {
+	return b ^ (mask & (a ^ b))
+}
+
+// b2u converts a bool to 0 or 1. Go does not promise that this compiles without a branch: go1.27.1 on amd64
+// emits a single MOVBLZX, check other compilers and targets with go build -gcflags=-S.
+func b2u(b bool) uint64 {
+	var x uint64
+	if b {
+		x = 1
+	}
+	return x
+}
+
+// elemConstantTime is Elem without the branch on the programmed point.
+func (c *ClientState) elemConstantTime(hint *LocalHint, chunkId uint64) uint64 {
+	prf := c.evalPRF(&hint.key, chunkId)%c.ChunkSize + chunkId*c.ChunkSize
+	programmed := b2u(hint.isProgrammed) & ctEq(hint.programmedPoint/c.ChunkSize, chunkId)
+	return ctSelect(-programmed, hint.programmedPoint, prf)
+}
+
+// RandomQueryConstantTime is like TryRandomQuery, but the hint lookup always scans all M1 primary hints
+// and picks the first match without data-dependent branches. It returns the same query as TryRandomQuery
+// would for the same random state. It fails for a database with chunk boundaries.
+func (c *ClientState) RandomQueryConstantTime() (ClientQuery, error) {
+	if c.DBSize == 0 {
+		return ClientQuery{}, ErrEmptyDatabase
+	}
+	if c.config.Boundaries != nil {
+		return ClientQuery{}, fmt.Errorf("constant-time queries need chunks of ChunkSize entries")
+	}
+	c.advanceEpoch()
+	x, err := c.sampleUncached()
+	if err != nil {
+		return ClientQuery{}, err
+	}
+
+	chunkId := x / c.ChunkSize
+	hitId := noHit
+	found := uint64(0)
+	for i := uint64(0); i < c.config.M1; i++ {
+		take := ctEq(c.elemConstantTime(&c.primaryHints[i], chunkId), x) &^ found
+		hitId = ctSelect(-take, i, hitId)
+		found |= take
+	}
+	if found == 0 {
+		return ClientQuery{}, ErrNoHint
+	}
+
+	offsetVec := make([]uint64, c.ChunkNum)
+	for i := uint64(0); i < c.ChunkNum; i++ {
+		offsetVec[i] = c.elemConstantTime(&c.primaryHints[hitId], i) % c.ChunkSize
+	}
+	return c.track(ClientQuery{x, chunkId, hitId, offsetVec, false, c.primaryHints[hitId].key, 0, c.rangeStart, ""}), nil
+}
@@ -0,0 +1,53 @@
+package piano
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCtHelpers(t *testing.T) {
+	for _, c := range [][2]uint64{{0, 0}, {1, 1}, {0, 1}, {^uint64(0), 0}, {1 << 63, 1 << 63}, {5, 1 << 63}} {
+		want := uint64(0)
+		if c[0] == c[1] {
+			want = 1
+		}
+		if got := ctEq(c[0], c[1]); got != want {
+			t.Fatalf("ctEq(%d, %d) = %d, want %d", c[0], c[1], got, want)
+		}
+	}
+	if ctSelect(^uint64(0), 1, 2) != 1 || ctSelect(0, 1, 2) != 2 {
+		t.Fatalf("ctSelect picks the wrong value")
+	}
+}
+
+func TestRandomQueryConstantTime(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	client := NewClient(server.DBSize)
+	state := client.InitializeStateWithSeed(server, 2)
+	ctState := client.InitializeStateWithSeed(server, 2)
+
+	for q := 0; q < 100; q++ {
+		query, err := state.TryRandomQuery()
+		ctQuery, ctErr := ctState.RandomQueryConstantTime()
+		if err != ctErr || !reflect.DeepEqual(query, ctQuery) {
+			t.Fatalf("query %d: constant-time query differs", q)
+		}
+		if err != nil {
+			continue
+		}
+		for i := uint64(0); i < state.ChunkNum; i++ {
+			if state.elemConstantTime(&state.primaryHints[query.hitId], i) != state.Elem(&state.primaryHints[query.hitId], i) {
+				t.Fatalf("elemConstantTime differs from Elem")
+			}
+		}
+		parities := server.Process(query.Prepare())
+		answer, err := state.RecoverAnswer(query, parities)
+		if err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		ctAnswer, err := ctState.RecoverAnswer(ctQuery, parities)
+		if err != nil || answer != ctAnswer || answer != server.Query(query.Index()) {
+			t.Fatalf("index %d: got %d and %d, want %d", query.Index(), answer, ctAnswer, server.Query(query.Index()))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package piano
+
+import "math"
+
+// CoverageReport estimates how well the primary hints of a ClientState cover the database, see
+// ClientState.CoverageReport.
+type CoverageReport struct {
+	// LiveHints is, for every chunk, the number of primary hints whose element in the chunk is pseudorandom,
+	// which is all of them but the ones programmed at a point of the chunk.
+	LiveHints []uint64
+	// HitProbability is, for every chunk, the probability that a uniformly random index of the chunk is
+	// contained in some primary hint; a query of an index that is not finds no hint (ErrNoHint).
+	HitProbability []float64
+}
+
+// Min returns the lowest HitProbability across chunks.
+func (r CoverageReport) Min() float64 {
+	lowest := 1.0
+	for _, p := range r.HitProbability {
+		if p < lowest {
+			lowest = p
+		}
+	}
+	return lowest
+}
+
+// CoverageReport estimates, for every chunk, the probability that a query of a random index of the chunk finds
+// a primary hint. Every live hint contains a given index with probability one over the size of its chunk,
+// independently of the others, so an under-provisioned M1 shows up as probabilities well below 1 before queries
+// start failing.
+// Refreshed hints are programmed at the queried index, so every query lowers the coverage of its chunk a bit.
+func (c *ClientState) CoverageReport() CoverageReport {
+	report := CoverageReport{
+		LiveHints:      make([]uint64, c.ChunkNum),
+		HitProbability: make([]float64, c.ChunkNum),
+	}
+	for chunkId := range report.LiveHints {
+		report.LiveHints[chunkId] = uint64(len(c.primaryHints))
+	}
+	for i := range c.primaryHints {
+		if hint := &c.primaryHints[i]; hint.isProgrammed {
+			report.LiveHints[c.chunkOf(hint.programmedPoint)]--
+		}
+	}
+	for chunkId, live := range report.LiveHints {
+		size := c.chunkLen(uint64(chunkId))
+		miss := math.Pow(1-1/float64(size), float64(live))
+		if size == 1 && live > 0 {
+			miss = 0
+		}
+		report.HitProbability[chunkId] = 1 - miss
+	}
+	return report
+}
+
+// CountHintCollisions returns, summed over the chunks, the number of primary hints whose element in a chunk is
+// already the element of another primary hint there. A colliding hint adds no coverage to that chunk. Random
+// elements collide too: M1 hints in chunks of ChunkSize entries give about M1 - ChunkSize(1-(1-1/ChunkSize)^M1)
+// collisions per chunk, so a count well above that points to a weak PRF. Computing it evaluates the PRF for
+// every hint and chunk.
+func (c *ClientState) CountHintCollisions() uint64 {
+	var collisions uint64
+	seen := make([]bool, c.ChunkSize)
+	for chunkId := uint64(0); chunkId < c.ChunkNum; chunkId++ {
+		start, size := c.chunkStart(chunkId), c.chunkLen(chunkId)
+		for k := range seen[:size] {
+			seen[k] = false
+		}
+		for i := range c.primaryHints {
+			offset := c.Elem(&c.primaryHints[i], chunkId) - start
+			if seen[offset] {
+				collisions++
+			}
+			seen[offset] = true
+		}
+	}
+	return collisions
+}
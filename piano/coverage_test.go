@@ -0,0 +1,99 @@
+package piano
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCoverageReport(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	// few primary hints, so that a large share of the indices is not covered
+	client, err := NewClientWithParams(100, server.ChunkSize, 20)
+	if err != nil {
+		t.Fatalf("NewClientWithParams: %v", err)
+	}
+	state := client.InitializeStateWithSeed(server, 2)
+
+	// the empirical share of the indices of every chunk that some primary hint contains
+	empirical := func() []float64 {
+		covered := make(map[uint64]bool)
+		for j := uint64(0); j < client.M1; j++ {
+			for _, x := range state.HintIndices(PrimaryHint, j) {
+				covered[x] = true
+			}
+		}
+		shares := make([]float64, server.ChunkNum)
+		for x := range covered {
+			shares[x/server.ChunkSize] += 1 / float64(server.ChunkSize)
+		}
+		return shares
+	}
+
+	report := state.CoverageReport()
+	want := 1 - math.Pow(1-1/float64(server.ChunkSize), float64(client.M1))
+	sum := 0.0
+	for chunkId, share := range empirical() {
+		if report.LiveHints[chunkId] != client.M1 || report.HitProbability[chunkId] != want {
+			t.Fatalf("chunk %d: %d live hints with hit probability %f, want %d and %f", chunkId, report.LiveHints[chunkId], report.HitProbability[chunkId], client.M1, want)
+		}
+		sum += share
+	}
+	if mean := sum / float64(server.ChunkNum); math.Abs(mean-want) > 0.02 {
+		t.Fatalf("empirical hit rate %f, the report estimates %f", mean, want)
+	}
+	if report.Min() != want {
+		t.Fatalf("Min() = %f, want %f", report.Min(), want)
+	}
+
+	// queries of chunk 0 program refreshed hints into it
+	queried := uint64(0)
+	for x := uint64(0); x < server.ChunkSize && queried < 10; x++ {
+		query, err := state.QueryIndex(x)
+		if err != nil || query.IsDummy() {
+			continue
+		}
+		if _, err := state.RecoverAnswer(query, server.Process(query.Prepare())); err != nil {
+			t.Fatalf("RecoverAnswer(%d): %v", x, err)
+		}
+		queried++
+	}
+	report = state.CoverageReport()
+	if report.LiveHints[0] != client.M1-queried {
+		t.Fatalf("chunk 0 has %d live hints after %d queries, want %d", report.LiveHints[0], queried, client.M1-queried)
+	}
+	if report.Min() != report.HitProbability[0] || report.Min() >= want {
+		t.Fatalf("Min() = %f after querying chunk 0, want HitProbability[0] %f below %f", report.Min(), report.HitProbability[0], want)
+	}
+}
+
+func TestCountHintCollisions(t *testing.T) {
+	// 10 entries per chunk and 50 primary hints: at least 40 of them collide in every chunk
+	server, err := NewServerWithParams(1000, 10)
+	if err != nil {
+		t.Fatalf("NewServerWithParams: %v", err)
+	}
+	client, err := NewClientWithParams(10, 50, 10)
+	if err != nil {
+		t.Fatalf("NewClientWithParams: %v", err)
+	}
+	state := client.InitializeStateWithSeed(server, 1)
+	if collisions := state.CountHintCollisions(); collisions < 40*server.ChunkNum || collisions >= 50*server.ChunkNum {
+		t.Fatalf("CountHintCollisions: got %d, want between %d and %d", collisions, 40*server.ChunkNum, 50*server.ChunkNum)
+	}
+
+	// as many primary hints as entries per chunk: the count is close to the one of uniformly random elements
+	server = NewServerWithSeed(10000, 2)
+	client, err = NewClientWithParams(100, server.ChunkSize, 10)
+	if err != nil {
+		t.Fatalf("NewClientWithParams: %v", err)
+	}
+	for _, prf := range []PRF{PRFAES, PRFSHA256} {
+		client.PRF = prf
+		state = client.InitializeStateWithSeed(server, 3)
+		size, m := float64(server.ChunkSize), float64(client.M1)
+		expected := float64(server.ChunkNum) * (m - size*(1-math.Pow(1-1/size, m)))
+		if collisions := float64(state.CountHintCollisions()); math.Abs(collisions-expected) > 0.05*expected {
+			t.Fatalf("CountHintCollisions with PRF %d: got %.0f, want about %.0f", prf, collisions, expected)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package piano
+
+import "fmt"
+
+// RunDemo runs the whole protocol on a random database with dbSize entries: the setup phase, then Q random
+// queries, each checked against the plaintext entry. It returns the number of queries answered correctly
+// and the first error.
+func RunDemo(dbSize uint64) (queries uint64, err error) {
+	// Suppose there's a public DB.
+	server := NewServer(dbSize)
+
+	// The following is the client side algorithm.
+	client := NewClient(dbSize)
+
+	//Setup Phase
+	state := client.InitializeState(server)
+
+	//Online Query Phase
+	for queries < client.Q {
+		// just do random query for now
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			return queries, err
+		}
+
+		//send the punctured offset vector to the server and get the parities
+		parities := server.Process(query.Prepare())
+		answer, err := state.RecoverAnswer(query, parities)
+		if err != nil {
+			return queries, err
+		}
+
+		// This verification only happens in this demo experiment.
+		if answer != server.Query(query.Index()) {
+			return queries, fmt.Errorf("answer for index %d is not correct", query.Index())
+		}
+		queries++
+	}
+	return queries, nil
+}
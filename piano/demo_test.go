@@ -0,0 +1,15 @@
+package piano
+
+import "testing"
+
+func TestRunDemo(t *testing.T) {
+	for _, dbSize := range []uint64{100, 1000, 10007} {
+		queries, err := RunDemo(dbSize)
+		if err != nil {
+			t.Fatalf("RunDemo(%d): %v after %d queries", dbSize, err, queries)
+		}
+		if want := NewClient(dbSize).Q; queries != want {
+			t.Fatalf("RunDemo(%d) made %d queries, want %d", dbSize, queries, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package piano
+
+import (
+	"fmt"
+	"math"
+)
+
+// DistributionReport is the result of AnalyzeQueryDistribution.
+type DistributionReport struct {
+	Trials    int       // number of queries analyzed
+	ChiSquare []float64 // chi-square statistic of every position of the punctured offset vector
+	Threshold float64   // statistics above it are flagged
+	Skewed    []int     // positions whose statistic is above Threshold
+}
+
+// Uniform reports whether no position was flagged.
+func (r DistributionReport) Uniform() bool {
+	return len(r.Skewed) == 0
+}
+
+// AnalyzeQueryDistribution makes trials random queries on a clone of clientState, so the state itself is not
+// used up, replacing the hint of every query like RecoverAnswer does, and checks that every position of the
+// punctured offset vectors the server sees is uniform over [0, ChunkSize) with a chi-square test. For
+// ChunkSize-1 degrees of freedom a position is flagged if its statistic is more than 6 standard deviations
+// above the mean. trials should be at least 5*ChunkSize. Queries that find no primary hint are retried; any
+// other error of TryRandomQuery, e.g. ErrCacheSaturated once most of the database is cached, is returned, since
+// the next queries would fail the same way.
+func AnalyzeQueryDistribution(clientState *ClientState, trials int) (DistributionReport, error) {
+	if clientState.DBSize == 0 {
+		return DistributionReport{}, fmt.Errorf("query distribution: %w", ErrEmptyDatabase)
+	}
+	state := clientState.Clone()
+	positions := state.ChunkNum - 1
+	counts := make([][]float64, positions)
+	for i := range counts {
+		counts[i] = make([]float64, state.ChunkSize)
+	}
+
+	for n := 0; n < trials; {
+		query, err := state.TryRandomQuery()
+		if err == ErrNoHint {
+			continue
+		}
+		if err != nil {
+			return DistributionReport{}, fmt.Errorf("query distribution after %d of %d trials: %w", n, trials, err)
+		}
+		for i, offset := range query.Prepare() {
+			counts[i][offset]++
+		}
+		n++
+
+		// replace the hint as RecoverAnswer would, so that the next queries see fresh hints; the parities
+		// of the clone are not kept up to date, since it never recovers an answer
+		if state.checkRecoverable(query, int(state.ChunkNum)) == nil {
+			state.refreshHint(query)
+		} else {
+			state = clientState.Clone()
+		}
+	}
+
+	df := float64(state.ChunkSize - 1)
+	report := DistributionReport{
+		Trials:    trials,
+		ChiSquare: make([]float64, positions),
+		Threshold: df + 6*math.Sqrt(2*df),
+	}
+	expected := float64(trials) / float64(state.ChunkSize)
+	for i := range counts {
+		for _, count := range counts[i] {
+			report.ChiSquare[i] += (count - expected) * (count - expected) / expected
+		}
+		if report.ChiSquare[i] > report.Threshold {
+			report.Skewed = append(report.Skewed, i)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,46 @@
+package piano
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAnalyzeQueryDistribution(t *testing.T) {
+	server := NewServer(10000)
+	state := NewClient(server.DBSize).InitializeState(server)
+	trials := int(20 * server.ChunkSize)
+
+	report, err := AnalyzeQueryDistribution(state, trials)
+	if err != nil {
+		t.Fatalf("AnalyzeQueryDistribution: %v", err)
+	}
+	if !report.Uniform() {
+		t.Fatalf("positions %v are skewed: %v", report.Skewed, report.ChiSquare)
+	}
+	if state.consumedHintNum[0] != 0 || len(state.localCache) != 0 {
+		t.Fatalf("AnalyzeQueryDistribution used up the state")
+	}
+
+	// with a single primary hint, and all backup hints alike, every query sends the same offsets
+	state.config.M1 = 1
+	state.primaryHints = state.primaryHints[:1]
+	for j := range state.backupHints {
+		state.backupHints[j].key = state.primaryHints[0].key
+	}
+	if report, err := AnalyzeQueryDistribution(state, int(5*server.ChunkSize)); err != nil || report.Uniform() {
+		t.Fatalf("offsets of a single hint are not flagged: %v", err)
+	}
+
+	if _, err := AnalyzeQueryDistribution(&ClientState{}, trials); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("AnalyzeQueryDistribution of an empty state: got %v, want ErrEmptyDatabase", err)
+	}
+
+	// a state with the whole database cached cannot make random queries
+	saturated := NewClient(server.DBSize).InitializeState(server)
+	if err := saturated.DownloadAll(server); err != nil {
+		t.Fatalf("DownloadAll: %v", err)
+	}
+	if _, err := AnalyzeQueryDistribution(saturated, trials); !errors.Is(err, ErrCacheSaturated) {
+		t.Fatalf("AnalyzeQueryDistribution of a saturated state: got %v, want ErrCacheSaturated", err)
+	}
+}
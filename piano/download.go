@@ -0,0 +1,37 @@
+package piano
+
+import "fmt"
+
+// ShouldDownloadAll reports whether a client of a database with dbSize entries is better off with DownloadAll
+// than with private queries. The setup phase streams the whole database to the client either way, so the only
+// cost of keeping it is the storage: it pays off while the entries take no more room than the hints of NewClient.
+func ShouldDownloadAll(dbSize uint64) bool {
+	if dbSize == 0 {
+		return false
+	}
+	return 8*dbSize <= NewClient(dbSize).EstimateClientMemory(dbSize)
+}
+
+// DownloadAll copies every entry of the state's database from s into the local cache, after which Retrieve and
+// Cached answer every index locally without contacting a server or consuming a hint. Reading the whole
+// database reveals nothing about the later reads. For a state from NewClientForRange only the window is copied.
+// It fails if s is of another Version than the hints, if the cache is disabled, or if its capacity is below
+// DBSize, since evicted entries would need private queries again.
+func (c *ClientState) DownloadAll(s Server) error {
+	if s.Version != c.version {
+		return fmt.Errorf("download: server version %d, hints of version %d: %w", s.Version, c.version, ErrStaleHints)
+	}
+	if end := c.rangeStart + c.DBSize; end > s.DBSize {
+		return fmt.Errorf("download: entries [%d, %d) out of range, DBSize is %d", c.rangeStart, end, s.DBSize)
+	}
+	if c.config.DisableCache {
+		return fmt.Errorf("download: the local cache is disabled")
+	}
+	if c.cacheCapacity > 0 && uint64(c.cacheCapacity) < c.DBSize {
+		return fmt.Errorf("download: cache capacity %d is below DBSize %d", c.cacheCapacity, c.DBSize)
+	}
+	for x := uint64(0); x < c.DBSize; x++ {
+		c.cachePut(x, s.Query(c.rangeStart+x))
+	}
+	return nil
+}
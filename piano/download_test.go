@@ -0,0 +1,48 @@
+package piano
+
+import "testing"
+
+func TestDownloadAll(t *testing.T) {
+	server := NewServerWithSeed(1000, 1)
+	if !ShouldDownloadAll(server.DBSize) {
+		t.Fatalf("ShouldDownloadAll(%d) = false", server.DBSize)
+	}
+	if ShouldDownloadAll(0) || ShouldDownloadAll(1<<30) {
+		t.Fatalf("ShouldDownloadAll is true for an empty or a large database")
+	}
+
+	client := NewClient(server.DBSize)
+	state := client.InitializeStateWithSeed(server, 2)
+	if err := state.DownloadAll(server); err != nil {
+		t.Fatalf("DownloadAll: %v", err)
+	}
+	srv := &countingServer{PIRServer: server}
+	for x := uint64(0); x < server.DBSize; x++ {
+		answer, err := state.Retrieve(x, srv)
+		if err != nil || answer != server.Query(x) {
+			t.Fatalf("Retrieve(%d): got %d, %v, want %d", x, answer, err, server.Query(x))
+		}
+	}
+	if srv.calls != 0 {
+		t.Fatalf("downloaded database made %d server calls", srv.calls)
+	}
+
+	// a window only downloads its own entries
+	client, _ = NewClientForRange(200, 300)
+	state = client.InitializeStateWithSeed(server, 3)
+	if err := state.DownloadAll(server); err != nil {
+		t.Fatalf("DownloadAll of a window: %v", err)
+	}
+	if len(state.ExportCache()) != 100 {
+		t.Fatalf("window cache has %d entries, want 100", len(state.ExportCache()))
+	}
+	if answer, ok := state.Cached(250); !ok || answer != server.Query(250) {
+		t.Fatalf("Cached(250): got %d, %v, want %d", answer, ok, server.Query(250))
+	}
+
+	state = NewClient(server.DBSize).InitializeStateWithSeed(server, 4)
+	state.SetCacheCapacity(10)
+	if err := state.DownloadAll(server); err == nil {
+		t.Fatalf("DownloadAll into a cache of 10 entries succeeded")
+	}
+}
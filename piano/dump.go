@@ -0,0 +1,42 @@
+package piano
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DumpState writes a human-readable listing of the state to w: the parameters, the consumed backup hints of
+// every chunk, every primary hint with its key, parity and programmed point, and the local cache sorted by
+// index. Two states set up with the same seed and queried the same way give identical dumps, so they can be
+// diffed to find where two runs diverge. Unlike Save it cannot be loaded again.
+func (c *ClientState) DumpState(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "DBSize %d ChunkSize %d ChunkNum %d Q %d M1 %d\n", c.DBSize, c.ChunkSize, c.ChunkNum, c.config.Q, c.config.M1)
+
+	fmt.Fprintf(b, "backup hints:\n")
+	for i := uint64(0); i < c.ChunkNum; i++ {
+		fmt.Fprintf(b, "  chunk %d: %d of %d consumed\n", i, c.consumedHintNum[i], c.backupStart[i+1]-c.backupStart[i])
+	}
+
+	fmt.Fprintf(b, "primary hints:\n")
+	for j, hint := range c.primaryHints {
+		fmt.Fprintf(b, "  %d: key %x parity %#016x", j, hint.key[:], hint.parity)
+		if hint.isProgrammed {
+			fmt.Fprintf(b, " programmed at %d", hint.programmedPoint)
+		}
+		fmt.Fprintf(b, "\n")
+	}
+
+	indices := make([]uint64, 0, len(c.localCache))
+	for x := range c.localCache {
+		indices = append(indices, x)
+	}
+	sort.Slice(indices, func(a, b int) bool { return indices[a] < indices[b] })
+	fmt.Fprintf(b, "cache: %d entries\n", len(indices))
+	for _, x := range indices {
+		fmt.Fprintf(b, "  %d: %#016x\n", x, c.localCache[x])
+	}
+	return b.Flush()
+}
@@ -0,0 +1,38 @@
+package piano
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDumpState(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	dump := func() string {
+		state := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+		if err := VerifyAgainstPlaintext(state, server, []uint64{42, 4242, 9999}); err != nil {
+			t.Fatalf("VerifyAgainstPlaintext: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := state.DumpState(&buf); err != nil {
+			t.Fatalf("DumpState: %v", err)
+		}
+		return buf.String()
+	}
+
+	first := dump()
+	if second := dump(); first != second {
+		t.Fatalf("the dumps of two runs with the same seed differ")
+	}
+	for _, want := range []string{
+		"chunk 42: 1 of",
+		"programmed at 4242",
+		"cache: 3 entries",
+		fmt.Sprintf("  9999: %#016x\n", server.Query(9999)),
+	} {
+		if !strings.Contains(first, want) {
+			t.Fatalf("the dump does not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package piano
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// FuzzPianoRetrieve privately retrieves the indices given by every two bytes of indices from a database
+// holding every eight bytes of data, and compares them to the plaintext entries. Up to Q retrievals are made,
+// so running out of backup hints is a failure.
+func FuzzPianoRetrieve(f *testing.F) {
+	data := make([]byte, 8*300)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	f.Add(data, int64(1), []byte{0, 0, 0, 1, 1, 43, 1, 0})
+	f.Add(data[:8*17], int64(2), []byte{0, 16, 0, 15, 0, 16})
+	f.Add(data[:8*2], int64(3), []byte{0, 0, 0, 1})
+
+	f.Fuzz(func(t *testing.T, data []byte, seed int64, indices []byte) {
+		if len(data) > 8*(1<<10) {
+			data = data[:8*(1<<10)]
+		}
+		entries := make([]uint64, len(data)/8)
+		if len(entries) == 0 {
+			return
+		}
+		for i := range entries {
+			entries[i] = binary.LittleEndian.Uint64(data[8*i:])
+		}
+		server := NewServerFromData(entries)
+		client := NewClient(server.DBSize)
+		state := client.InitializeStateWithSeed(server, seed)
+
+		for q := uint64(0); q < client.Q && 2*q+1 < uint64(len(indices)); q++ {
+			x := uint64(binary.BigEndian.Uint16(indices[2*q:])) % server.DBSize
+			answer, err := state.Retrieve(x, server)
+			if errors.Is(err, ErrNoHint) {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("DBSize %d, Q %d, M1 %d, M2 %d: retrieval %d of index %d: %v",
+					server.DBSize, client.Q, client.M1, client.M2, q, x, err)
+			}
+			if answer != entries[x] {
+				t.Fatalf("DBSize %d: index %d got %d, want %d", server.DBSize, x, answer, entries[x])
+			}
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package piano
+
+import "sort"
+
+// HintView is a read-only copy of a hint, see ClientState.Hints.
+type HintView struct {
+	ChunkOffsets    []uint64 // offset of the hint's element in every chunk
+	Parity          uint64
+	Programmed      bool
+	ProgrammedPoint uint64
+	Backup          bool   // a backup hint of chunk BackupChunk, whose offset in that chunk is not part of the set
+	BackupChunk     uint64 // only set for a backup hint
+}
+
+// Hints returns a view of the M1 primary hints followed by the backup hints of every chunk, including the
+// consumed ones. It evaluates the PRF of every hint for every chunk, so it is meant for debugging and analysis.
+func (c *ClientState) Hints() []HintView {
+	views := make([]HintView, 0, len(c.primaryHints)+len(c.backupHints))
+	for j := range c.primaryHints {
+		views = append(views, c.hintView(&c.primaryHints[j]))
+	}
+	for chunkId := uint64(0); chunkId < c.ChunkNum; chunkId++ {
+		for j := c.backupStart[chunkId]; j < c.backupStart[chunkId+1]; j++ {
+			view := c.hintView(&c.backupHints[j])
+			view.Backup = true
+			view.BackupChunk = chunkId
+			views = append(views, view)
+		}
+	}
+	return views
+}
+
+func (c *ClientState) hintView(hint *LocalHint) HintView {
+	view := HintView{
+		ChunkOffsets:    make([]uint64, c.ChunkNum),
+		Parity:          hint.parity,
+		Programmed:      hint.isProgrammed,
+		ProgrammedPoint: hint.programmedPoint,
+	}
+	for i := uint64(0); i < c.ChunkNum; i++ {
+		view.ChunkOffsets[i] = c.Elem(hint, i) - c.chunkStart(i)
+	}
+	return view
+}
+
+// HintKind selects the primary or the backup hints for HintIndices.
+type HintKind int
+
+const (
+	PrimaryHint HintKind = iota
+	BackupHint
+)
+
+// HintIndices returns the database indices of a hint in chunk order: one per chunk for the hintIndex-th of the
+// M1 primary hints, and one per chunk but its own for the hintIndex-th backup hint, counting the backup hints of
+// every chunk in turn as Hints does. A programmed primary hint holds its programmed point. An index can be at or
+// beyond DBSize in the padding of the last chunk. It returns nil if there is no such hint.
+func (c *ClientState) HintIndices(kind HintKind, hintIndex uint64) []uint64 {
+	var hint *LocalHint
+	skip := noHit
+	switch {
+	case kind == PrimaryHint && hintIndex < uint64(len(c.primaryHints)):
+		hint = &c.primaryHints[hintIndex]
+	case kind == BackupHint && hintIndex < uint64(len(c.backupHints)):
+		hint = &c.backupHints[hintIndex]
+		// the chunk the backup hint belongs to
+		skip = uint64(sort.Search(int(c.ChunkNum), func(i int) bool { return c.backupStart[i+1] > hintIndex }))
+	default:
+		return nil
+	}
+	indices := make([]uint64, 0, c.ChunkNum)
+	for i := uint64(0); i < c.ChunkNum; i++ {
+		if i != skip {
+			indices = append(indices, c.rangeStart+c.Elem(hint, i))
+		}
+	}
+	return indices
+}
@@ -0,0 +1,100 @@
+package piano
+
+import "testing"
+
+func TestHints(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+	x := uint64(4242)
+	if _, err := state.Retrieve(x, server); err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+
+	hints := state.Hints()
+	if uint64(len(hints)) != client.M1+client.M2*server.ChunkNum {
+		t.Fatalf("got %d hints, want %d", len(hints), client.M1+client.M2*server.ChunkNum)
+	}
+
+	// with the default parameters every index is in a primary hint with overwhelming probability
+	covered := make([]bool, server.DBSize)
+	programmed := 0
+	for _, hint := range hints {
+		if hint.Backup {
+			continue
+		}
+		var parity uint64
+		for i, offset := range hint.ChunkOffsets {
+			covered[uint64(i)*server.ChunkSize+offset] = true
+			parity ^= server.Query(uint64(i)*server.ChunkSize + offset)
+		}
+		if parity != hint.Parity {
+			t.Fatalf("the parity of a primary hint does not match its offsets")
+		}
+		if hint.Programmed {
+			programmed++
+			if hint.ProgrammedPoint != x || hint.ChunkOffsets[x/server.ChunkSize] != x%server.ChunkSize {
+				t.Fatalf("hint programmed at %d, want %d", hint.ProgrammedPoint, x)
+			}
+		}
+	}
+	if programmed != 1 {
+		t.Fatalf("%d programmed primary hints, want 1", programmed)
+	}
+	for i, ok := range covered {
+		if !ok {
+			t.Fatalf("index %d is in no primary hint", i)
+		}
+	}
+
+	last := hints[len(hints)-1]
+	if !last.Backup || last.BackupChunk != server.ChunkNum-1 {
+		t.Fatalf("the last hint is not a backup hint of the last chunk")
+	}
+}
+
+func TestHintIndices(t *testing.T) {
+	for _, DBSize := range []uint64{10000, 10007} {
+		server := NewServerWithSeed(DBSize, 1)
+		client := NewClient(server.DBSize)
+		state := client.InitializeStateWithSeed(server, 2)
+		if _, err := state.Retrieve(4242, server); err != nil {
+			t.Fatalf("Retrieve: %v", err)
+		}
+
+		hints := state.Hints()
+		for j, view := range hints {
+			kind, hintIndex := PrimaryHint, uint64(j)
+			if view.Backup {
+				kind, hintIndex = BackupHint, uint64(j)-client.M1
+			}
+			indices := state.HintIndices(kind, hintIndex)
+			want := server.ChunkNum
+			if view.Backup {
+				want--
+			}
+			if uint64(len(indices)) != want {
+				t.Fatalf("DBSize %d, hint %d: got %d indices, want %d", DBSize, j, len(indices), want)
+			}
+			seen := make(map[uint64]bool)
+			for _, x := range indices {
+				chunkId := x / server.ChunkSize
+				if seen[chunkId] || (view.Backup && chunkId == view.BackupChunk) {
+					t.Fatalf("DBSize %d, hint %d: chunk %d appears twice or is its own", DBSize, j, chunkId)
+				}
+				seen[chunkId] = true
+				if x != chunkId*server.ChunkSize+view.ChunkOffsets[chunkId] {
+					t.Fatalf("DBSize %d, hint %d: index %d differs from the view", DBSize, j, x)
+				}
+				// only the short last chunk has padding
+				if x >= server.DBSize && (DBSize == 10000 || chunkId != server.ChunkNum-1) {
+					t.Fatalf("DBSize %d, hint %d: index %d is out of range", DBSize, j, x)
+				}
+			}
+		}
+
+		if state.HintIndices(PrimaryHint, client.M1) != nil || state.HintIndices(BackupHint, uint64(len(hints))) != nil {
+			t.Fatalf("DBSize %d: HintIndices of a missing hint is not nil", DBSize)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package piano
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// The key-value layer stores every value at an index derived from its key by open addressing: a key is tried
+// at hash(key) mod DBSize and the following indices until a free one is found. The public Table records the
+// fingerprint of the key stored at every index, so a client holding it finds the index of a key locally and
+// only the retrieval of that index goes to the server.
+
+// KVServer is a Server whose entries are addressed by key.
+type KVServer struct {
+	Server
+	Table []uint64 // fingerprint of the key at every index, 0 for a free one
+}
+
+// fingerprint is the 64-bit FNV-1a hash of key, never 0.
+func fingerprint(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	if f := h.Sum64(); f != 0 {
+		return f
+	}
+	return 1
+}
+
+// NewKVServer stores values[i] under keys[i] in a database with DBSize entries.
+// It fails if there are more keys than entries or two keys have the same fingerprint.
+func NewKVServer(keys [][]byte, values []uint64, DBSize uint64) (KVServer, error) {
+	if len(keys) != len(values) {
+		return KVServer{}, fmt.Errorf("%d keys but %d values", len(keys), len(values))
+	}
+	if uint64(len(keys)) > DBSize {
+		return KVServer{}, fmt.Errorf("%d keys do not fit into DBSize %d", len(keys), DBSize)
+	}
+	s := KVServer{newPaddedServer(DBSize), make([]uint64, DBSize)}
+	for i, key := range keys {
+		f := fingerprint(key)
+		x := f % DBSize
+		for s.Table[x] != 0 {
+			if s.Table[x] == f {
+				return KVServer{}, fmt.Errorf("key %q collides with an earlier key", key)
+			}
+			x = (x + 1) % DBSize
+		}
+		s.Table[x] = f
+		s.DB[x] = values[i]
+	}
+	return s, nil
+}
+
+// lookup returns the index of key in table, or false if it is not there.
+func lookup(table []uint64, key []byte) (uint64, bool) {
+	f := fingerprint(key)
+	x := f % uint64(len(table))
+	for probe := 0; probe < len(table) && table[x] != 0; probe++ {
+		if table[x] == f {
+			return x, true
+		}
+		x = (x + 1) % uint64(len(table))
+	}
+	return 0, false
+}
+
+// KVClient privately reads values by key from a KVServer.
+type KVClient struct {
+	state *ClientState
+	table []uint64
+	srv   PIRServer
+}
+
+// NewKVClient returns a KVClient that retrieves from srv with state. table is the public Table of the KVServer.
+func NewKVClient(state *ClientState, table []uint64, srv PIRServer) KVClient {
+	return KVClient{state, table, srv}
+}
+
+// Get privately retrieves the value stored under key. It returns ErrKeyNotFound, without contacting
+// the server, for a key that is not in the table.
+func (c KVClient) Get(key []byte) (uint64, error) {
+	x, ok := lookup(c.table, key)
+	if !ok {
+		return 0, fmt.Errorf("key %q: %w", key, ErrKeyNotFound)
+	}
+	return c.state.Retrieve(x, c.srv)
+}
@@ -0,0 +1,52 @@
+package piano
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKV(t *testing.T) {
+	const n = 500
+	keys := make([][]byte, n)
+	values := make([]uint64, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+		values[i] = uint64(i) * 1000003
+	}
+	// a nearly full table, so that many keys are displaced from their hash index
+	server, err := NewKVServer(keys, values, n+n/10)
+	if err != nil {
+		t.Fatalf("NewKVServer: %v", err)
+	}
+	displaced := 0
+	for _, key := range keys {
+		if x, _ := lookup(server.Table, key); x != fingerprint(key)%server.DBSize {
+			displaced++
+		}
+	}
+	if displaced == 0 {
+		t.Fatalf("no key was displaced, collisions are not tested")
+	}
+
+	state := NewClient(server.DBSize).InitializeState(server.Server)
+	client := NewKVClient(state, server.Table, server)
+	// fetch a part of the keys, all of them would take more than Q queries
+	for i := 0; i < n; i += 5 {
+		key := keys[i]
+		value, err := client.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		if value != values[i] {
+			t.Fatalf("Get(%q) = %d, want %d", key, value, values[i])
+		}
+	}
+	if _, err := client.Get([]byte("missing")); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(missing): got %v, want ErrKeyNotFound", err)
+	}
+
+	if _, err := NewKVServer([][]byte{[]byte("a"), []byte("a")}, []uint64{1, 2}, 10); err == nil {
+		t.Fatalf("NewKVServer accepted a duplicate key")
+	}
+}
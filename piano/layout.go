@@ -0,0 +1,160 @@
+package piano
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// checkBoundaries validates chunk boundaries and returns the size of the largest chunk. Chunk i holds the
+// entries [boundaries[i], boundaries[i+1]), so the boundaries start at 0 and increase strictly. Every chunk
+// size has to divide the largest one: an offset vector carries every offset as a uniform value in
+// [0, ChunkSize) that the server reduces modulo the size of its chunk, which keeps the punctured chunk hidden.
+func checkBoundaries(boundaries []uint64) (uint64, error) {
+	if len(boundaries) < 2 || boundaries[0] != 0 {
+		return 0, fmt.Errorf("chunk boundaries %v do not start at 0 and end at DBSize", boundaries)
+	}
+	var largest uint64
+	for i := 1; i < len(boundaries); i++ {
+		if boundaries[i] <= boundaries[i-1] {
+			return 0, fmt.Errorf("chunk %d is empty: boundaries %d and %d", i-1, boundaries[i-1], boundaries[i])
+		}
+		if size := boundaries[i] - boundaries[i-1]; size > largest {
+			largest = size
+		}
+	}
+	for i := 1; i < len(boundaries); i++ {
+		if size := boundaries[i] - boundaries[i-1]; largest%size != 0 {
+			return 0, fmt.Errorf("chunk %d has %d entries, which does not divide the largest chunk of %d", i-1, size, largest)
+		}
+	}
+	return largest, nil
+}
+
+// NewServerWithBoundaries is like NewServerWithParams, but chunk i holds the entries [boundaries[i],
+// boundaries[i+1]), so hot records can live in smaller chunks. The boundaries start at 0 and end at DBSize, and
+// the size of every chunk divides the size of the largest one, which becomes ChunkSize. There is no padding.
+// The client needs the same boundaries, see NewClientWithBoundaries.
+func NewServerWithBoundaries(boundaries []uint64) (Server, error) {
+	chunkSize, err := checkBoundaries(boundaries)
+	if err != nil {
+		return Server{}, err
+	}
+	ChunkNum := uint64(len(boundaries) - 1)
+	DBSize := boundaries[ChunkNum]
+	s := Server{
+		DB:         make([]uint64, DBSize),
+		DBSize:     DBSize,
+		ChunkSize:  chunkSize,
+		ChunkNum:   ChunkNum,
+		Boundaries: append([]uint64(nil), boundaries...),
+		timing:     &processTiming{},
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := range s.DB {
+		s.DB[i] = rng.Uint64()
+	}
+	return s, nil
+}
+
+// NewClientWithBoundaries returns a Client for a database with the chunk boundaries of NewServerWithBoundaries.
+// The hint counts are the ones of NewClient, scaled up if the largest chunk, which has the most queries and the
+// lowest chance to be hit by a primary hint, is larger than the default sqrt(DBSize).
+func NewClientWithBoundaries(boundaries []uint64) (Client, error) {
+	chunkSize, err := checkBoundaries(boundaries)
+	if err != nil {
+		return Client{}, err
+	}
+	DBSize := boundaries[len(boundaries)-1]
+	c := NewClient(DBSize)
+	if scale := float64(chunkSize) / math.Sqrt(float64(DBSize)); scale > 1 {
+		c.M1 = uint64(math.Ceil(float64(c.M1) * scale))
+		c.M2 = uint64(math.Ceil(float64(c.M2) * scale))
+	}
+	c.Boundaries = append([]uint64(nil), boundaries...)
+	return c, nil
+}
+
+// chunking returns ChunkSize and ChunkNum for a database with DBSize entries, from the Boundaries if they are set.
+// checkChunking reports whether the Boundaries fit DBSize.
+func (c Client) chunking(DBSize uint64) (uint64, uint64) {
+	if c.Boundaries == nil {
+		return chunkParams(DBSize)
+	}
+	ChunkSize, _ := checkBoundaries(c.Boundaries)
+	return ChunkSize, uint64(len(c.Boundaries) - 1)
+}
+
+// checkChunking returns an error if the Boundaries are set but are not valid for a database with DBSize entries.
+func (c Client) checkChunking(DBSize uint64) error {
+	if c.Boundaries == nil {
+		return nil
+	}
+	if _, err := checkBoundaries(c.Boundaries); err != nil {
+		return err
+	}
+	if end := c.Boundaries[len(c.Boundaries)-1]; end != DBSize {
+		return fmt.Errorf("chunk boundaries end at %d, DBSize is %d", end, DBSize)
+	}
+	return nil
+}
+
+// sameBoundaries reports whether a database chunked by a matches one chunked by b.
+func sameBoundaries(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// chunkOf returns the chunk of index in a database chunked by boundaries, or by chunkSize if they are nil.
+func chunkOf(boundaries []uint64, chunkSize uint64, index uint64) uint64 {
+	if boundaries == nil {
+		return index / chunkSize
+	}
+	return uint64(sort.Search(len(boundaries)-2, func(i int) bool { return boundaries[i+1] > index }))
+}
+
+// chunkStart returns the first index of the chunkId-th chunk.
+func chunkStart(boundaries []uint64, chunkSize uint64, chunkId uint64) uint64 {
+	if boundaries == nil {
+		return chunkId * chunkSize
+	}
+	return boundaries[chunkId]
+}
+
+// chunkLen returns the number of entries of the chunkId-th chunk, including the padding.
+func chunkLen(boundaries []uint64, chunkSize uint64, chunkId uint64) uint64 {
+	if boundaries == nil {
+		return chunkSize
+	}
+	return boundaries[chunkId+1] - boundaries[chunkId]
+}
+
+// chunk returns the entries of the chunkId-th chunk.
+func (s Server) chunk(chunkId uint64) []uint64 {
+	start := chunkStart(s.Boundaries, s.ChunkSize, chunkId)
+	return s.DB[start : start+chunkLen(s.Boundaries, s.ChunkSize, chunkId)]
+}
+
+// chunkOf returns the chunk of index.
+func (c *ClientState) chunkOf(index uint64) uint64 {
+	return chunkOf(c.config.Boundaries, c.ChunkSize, index)
+}
+
+// chunkStart returns the first index of the chunkId-th chunk.
+func (c *ClientState) chunkStart(chunkId uint64) uint64 {
+	return chunkStart(c.config.Boundaries, c.ChunkSize, chunkId)
+}
+
+// chunkLen returns the number of entries of the chunkId-th chunk.
+func (c *ClientState) chunkLen(chunkId uint64) uint64 {
+	return chunkLen(c.config.Boundaries, c.ChunkSize, chunkId)
+}
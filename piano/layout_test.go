@@ -0,0 +1,101 @@
+package piano
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestBoundaries(t *testing.T) {
+	for _, boundaries := range [][]uint64{nil, {0}, {1, 10}, {0, 10, 10, 20}, {0, 30, 100}} {
+		if _, err := NewServerWithBoundaries(boundaries); err == nil {
+			t.Fatalf("NewServerWithBoundaries(%v): expected an error", boundaries)
+		}
+	}
+
+	// a small hot chunk, then chunks of twice and four times its size
+	boundaries := []uint64{0, 100, 300, 700}
+	server, err := NewServerWithBoundaries(boundaries)
+	if err != nil {
+		t.Fatalf("NewServerWithBoundaries: %v", err)
+	}
+	if server.DBSize != 700 || server.ChunkSize != 400 || server.ChunkNum != 3 {
+		t.Fatalf("DBSize %d, ChunkSize %d, ChunkNum %d", server.DBSize, server.ChunkSize, server.ChunkNum)
+	}
+	if chunkId, offset := server.Locate(350); chunkId != 2 || offset != 50 || server.Index(chunkId, offset) != 350 {
+		t.Fatalf("Locate(350) = %d, %d", chunkId, offset)
+	}
+	client, err := NewClientWithBoundaries(boundaries)
+	if err != nil {
+		t.Fatalf("NewClientWithBoundaries: %v", err)
+	}
+	if err := client.Validate(server.DBSize); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if _, err := NewClient(server.DBSize).InitializeStateContext(context.Background(), server); err == nil {
+		t.Fatalf("InitializeStateContext: expected an error for a client without the boundaries")
+	}
+
+	state := client.InitializeStateWithSeed(server, 1)
+	streamed, err := client.InitializeStateFromStreamWithSeed(server.StreamChunks(), server.DBSize, 1)
+	if err != nil {
+		t.Fatalf("InitializeStateFromStream: %v", err)
+	}
+	if !reflect.DeepEqual(state.primaryHints, streamed.primaryHints) || !reflect.DeepEqual(state.backupHints, streamed.backupHints) {
+		t.Fatalf("the streamed setup gives different hints")
+	}
+
+	// the first and last index of every chunk, and random ones
+	rng := rand.New(rand.NewSource(2))
+	indices := []uint64{0, 99, 100, 299, 300, 699}
+	for i := 0; i < 30; i++ {
+		indices = append(indices, rng.Uint64()%server.DBSize)
+	}
+	for _, x := range indices {
+		query, err := state.QueryIndex(x)
+		if err != nil {
+			continue
+		}
+		for _, offset := range query.Prepare() {
+			if offset >= server.ChunkSize {
+				t.Fatalf("query of %d sends offset %d beyond ChunkSize %d", x, offset, server.ChunkSize)
+			}
+		}
+		answer, err := state.Retrieve(x, server)
+		if err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+		if answer != server.Query(x) {
+			t.Fatalf("Retrieve(%d) = %d, want %d", x, answer, server.Query(x))
+		}
+	}
+
+	// the offsets of smaller chunks are spread over [0, ChunkSize) like the others; the distribution test needs a
+	// database much larger than the trials, so here 20 hot chunks of 50 entries come before 90 of 100
+	boundaries = []uint64{0}
+	for i := 0; i < 110; i++ {
+		size := uint64(100)
+		if i < 20 {
+			size = 50
+		}
+		boundaries = append(boundaries, boundaries[len(boundaries)-1]+size)
+	}
+	server, err = NewServerWithBoundaries(boundaries)
+	if err != nil {
+		t.Fatalf("NewServerWithBoundaries: %v", err)
+	}
+	client, err = NewClientWithBoundaries(boundaries)
+	if err != nil {
+		t.Fatalf("NewClientWithBoundaries: %v", err)
+	}
+	state = client.InitializeStateWithSeed(server, 3)
+	if report, err := AnalyzeQueryDistribution(state, int(20*server.ChunkSize)); err != nil || !report.Uniform() {
+		t.Fatalf("offset vectors are skewed at positions %v: %v", report.Skewed, err)
+	}
+	for _, x := range []uint64{0, 999, 1000, server.DBSize - 1} {
+		if answer, err := state.Retrieve(x, server); err != nil || answer != server.Query(x) {
+			t.Fatalf("Retrieve(%d) = %d, %v, want %d", x, answer, err, server.Query(x))
+		}
+	}
+}
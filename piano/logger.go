@@ -0,0 +1,30 @@
+package piano
+
+// Logger receives the diagnostic messages of a Server or a ClientState, such as fallbacks taken by Retrieve.
+// *log.Logger implements it. Without one, set with SetLogger, nothing is logged.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// SetLogger sets the logger of the state; nil turns logging off.
+func (c *ClientState) SetLogger(logger Logger) {
+	c.logger = logger
+}
+
+func (c *ClientState) logf(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+	}
+}
+
+// SetLogger sets the logger of the server; nil turns logging off. Copies of the
+// Server made afterwards share it.
+func (s *Server) SetLogger(logger Logger) {
+	s.logger = logger
+}
+
+func (s Server) logf(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, v...)
+	}
+}
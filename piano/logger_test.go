@@ -0,0 +1,53 @@
+package piano
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testLogger collects the logged lines.
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) contains(s string) bool {
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogger(t *testing.T) {
+	server := NewServer(10000)
+	state := Client{Q: 10, M1: 1, M2: 1}.InitializeState(server)
+	var x uint64
+	for state.findHit(x) != noHit {
+		x++
+	}
+
+	logger := &testLogger{}
+	state.SetLogger(logger)
+	state.Retrieve(x, server)
+	if !logger.contains(fmt.Sprintf("no primary hint contains index %d", x)) {
+		t.Fatalf("no fallback logged, got %q", logger.lines)
+	}
+
+	serverLogger := &testLogger{}
+	server.SetLogger(serverLogger)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := server.ProcessBatchContext(ctx, [][]uint64{randomOffsetVec(server, 1)}); err == nil {
+		t.Fatalf("ProcessBatchContext: expected an error for a canceled context")
+	}
+	if !serverLogger.contains("batch canceled") {
+		t.Fatalf("no cancellation logged, got %q", serverLogger.lines)
+	}
+}
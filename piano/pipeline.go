@@ -0,0 +1,105 @@
+package piano
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// PipelinedRetrieve privately retrieves the indices from srv like Retrieve, with up to concurrency Process calls
+// in flight at a time, which hides the latency of a remote server. Building a query and recovering its answer
+// consume hints, so they run under a lock and only the Process calls overlap. Queries in flight never share a
+// primary hint: a query whose hint is taken waits until that query is recovered, since the server could link two
+// punctured vectors of the same set. Repeated indices are answered from the local cache like in Retrieve, and an
+// index that no primary hint contains falls back to Retrieve while holding the lock. The values are returned in
+// the order of indices; if some index fails, the error of the first one in that order is returned. Like Retrieve,
+// an index fails with ErrStaleHints if srv reports another Version than the hints.
+// srv must be safe for concurrent use, and the ClientState must not be used otherwise until it returns.
+func (c *ClientState) PipelinedRetrieve(indices []uint64, srv PIRServer, concurrency int) ([]uint64, error) {
+	results := c.PipelinedRetrieveResults(indices, srv, concurrency)
+	values := make([]uint64, len(results))
+	for k, result := range results {
+		values[k] = result.Value
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			return values, result.Err
+		}
+	}
+	return values, nil
+}
+
+// PipelinedRetrieveResults is like PipelinedRetrieve, but returns a RetrieveResult for every index, in the order
+// of indices, with the error of each index instead of the first one.
+func (c *ClientState) PipelinedRetrieveResults(indices []uint64, srv PIRServer, concurrency int) []RetrieveResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	results := make([]RetrieveResult, len(indices))
+
+	var mu sync.Mutex
+	released := sync.NewCond(&mu)
+	inFlight := make(map[uint64]bool) // primary hints of the queries in flight
+
+	// retrieve returns the answer for x, calling Process without holding mu.
+	retrieve := func(x uint64) (uint64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			if answer, ok := c.Cached(x); ok {
+				return answer, nil
+			}
+			query, err := c.QueryIndex(x)
+			if err != nil {
+				return 0, err
+			}
+			if query.IsDummy() {
+				return c.Retrieve(x, srv)
+			}
+			if inFlight[query.hitId] {
+				released.Wait()
+				continue
+			}
+
+			inFlight[query.hitId] = true
+			version := c.version
+			mu.Unlock()
+			parities, serverVersion := processVersion(srv, query.Prepare(), version)
+			mu.Lock()
+			delete(inFlight, query.hitId)
+			released.Broadcast()
+
+			if serverVersion != version {
+				return 0, fmt.Errorf("retrieve index %d: server version %d, hints of version %d: %w", x, serverVersion, version, ErrStaleHints)
+			}
+			answer, err := c.RecoverAnswer(query, parities)
+			if errors.Is(err, ErrStaleQuery) {
+				// the hints were replaced in the meantime, e.g. by a new streaming epoch
+				continue
+			}
+			if err != nil {
+				return 0, fmt.Errorf("retrieve index %d: %w", x, err)
+			}
+			return answer, nil
+		}
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(indices); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range next {
+				value, err := retrieve(indices[k])
+				results[k] = RetrieveResult{Index: indices[k], Value: value, Err: err}
+			}
+		}()
+	}
+	for k := range indices {
+		next <- k
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,79 @@
+package piano
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowServer delays every Process call like a remote server and tracks how many calls overlap.
+type slowServer struct {
+	PIRServer
+	delay       time.Duration
+	inFlight    int32
+	maxInFlight int32
+}
+
+func (s *slowServer) Process(offsetVec []uint64) []uint64 {
+	n := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+	for {
+		peak := atomic.LoadInt32(&s.maxInFlight)
+		if n <= peak || atomic.CompareAndSwapInt32(&s.maxInFlight, peak, n) {
+			break
+		}
+	}
+	time.Sleep(s.delay)
+	return s.PIRServer.Process(offsetVec)
+}
+
+func TestPipelinedRetrieve(t *testing.T) {
+	server := NewServer(10000)
+	state := NewClient(server.DBSize).InitializeState(server)
+	indices := make([]uint64, 100)
+	for k := range indices {
+		indices[k] = state.rng.Uint64() % server.DBSize
+	}
+	// a repeated index and two of the same chunk
+	indices[10], indices[20], indices[21] = indices[0], 5000, 5001
+
+	slow := &slowServer{PIRServer: server, delay: time.Millisecond}
+	values, err := state.PipelinedRetrieve(indices, slow, 8)
+	if err != nil {
+		t.Fatalf("PipelinedRetrieve: %v", err)
+	}
+	for k, x := range indices {
+		if values[k] != server.Query(x) {
+			t.Fatalf("index %d: got %d, want %d", x, values[k], server.Query(x))
+		}
+	}
+	if slow.maxInFlight < 2 {
+		t.Fatalf("at most %d Process calls were in flight", slow.maxInFlight)
+	}
+
+	// every distinct index consumed exactly one backup hint of its chunk
+	want := make([]uint64, server.ChunkNum)
+	seen := make(map[uint64]bool)
+	for _, x := range indices {
+		if !seen[x] {
+			seen[x] = true
+			want[x/server.ChunkSize]++
+		}
+	}
+	for i := range want {
+		if state.consumedHintNum[i] < want[i] {
+			t.Fatalf("chunk %d consumed %d backup hints, want at least %d", i, state.consumedHintNum[i], want[i])
+		}
+	}
+}
+
+func TestPipelinedRetrieveStale(t *testing.T) {
+	server := NewServer(10000)
+	state := NewClient(server.DBSize).InitializeState(server)
+	server.Update(0, 1)
+	_, err := state.PipelinedRetrieve([]uint64{1, 5000}, server, 2)
+	if !errors.Is(err, ErrStaleHints) {
+		t.Fatalf("PipelinedRetrieve from an updated server: got %v, want ErrStaleHints", err)
+	}
+}
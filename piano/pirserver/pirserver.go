@@ -0,0 +1,192 @@
+// Package pirserver serves a piano.Server over gRPC with the QueryService defined in query/query.proto.
+package pirserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"example.com/piano"
+	pb "example.com/query"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// set the max message size to 12MB
+const maxMsgSize = 12 * 1024 * 1024
+
+// QueryServiceServer answers PlaintextQuery, PunctSetQuery and FetchFullDB from a piano.Server.
+type QueryServiceServer struct {
+	pb.UnimplementedQueryServiceServer
+	server piano.Server
+}
+
+// NewGRPCServer returns a gRPC server with the query service for s registered.
+func NewGRPCServer(s piano.Server) *grpc.Server {
+	g := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxMsgSize),
+		grpc.MaxSendMsgSize(maxMsgSize),
+	)
+	pb.RegisterQueryServiceServer(g, &QueryServiceServer{server: s})
+	return g
+}
+
+// The plaintext query returns the value of the database entry with the given index.
+// This is a non-private baseline.
+func (s *QueryServiceServer) PlaintextQuery(ctx context.Context, in *pb.PlaintextQueryMsg) (*pb.PlaintextResponse, error) {
+	id := in.GetIndex()
+	if id >= s.server.DBSize {
+		return nil, status.Errorf(codes.OutOfRange, "index %d out of range", id)
+	}
+	return &pb.PlaintextResponse{Val: []uint64{s.server.Query(id)}}, nil
+}
+
+// Given a punctured offset vector, return the ChunkNum possible parities.
+func (s *QueryServiceServer) PunctSetQuery(ctx context.Context, in *pb.PunctSetQueryMsg) (*pb.PunctSetResponse, error) {
+	guesses, err := s.server.ProcessChecked(in.GetIndices())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return &pb.PunctSetResponse{ReturnSize: s.server.ChunkNum, Guesses: guesses}, nil
+}
+
+// Streamingly send the database to the client. This is used in the setup phase. The chunks follow the
+// Boundaries of the server, if any, and the first chunk carries the Boundaries and the Version.
+func (s *QueryServiceServer) FetchFullDB(in *pb.FetchFullDBMsg, stream pb.QueryService_FetchFullDBServer) error {
+	for i := uint64(0); i < s.server.ChunkNum; i++ {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		start, end := s.server.Index(i, 0), s.server.Index(i+1, 0)
+		ret := &pb.DBChunk{ChunkId: i, ChunkSize: s.server.ChunkSize, Chunk: s.server.DB[start:end]}
+		if i == 0 {
+			// the first chunk carries the layout and the version of the database
+			ret.Boundaries, ret.Version = s.server.Boundaries, s.server.Version
+		}
+		if err := stream.Send(ret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoteServer talks to a QueryServiceServer. It has the same Process and Query methods as piano.Server,
+// so the query loop is the same for a local and a remote server. Since those methods cannot return
+// an error, a failed call returns nil (or 0) and the error is kept for Err.
+type RemoteServer struct {
+	conn   *grpc.ClientConn
+	client pb.QueryServiceClient
+
+	mu  sync.Mutex
+	err error
+}
+
+var _ piano.PIRServer = (*RemoteServer)(nil)
+
+// Dial connects to the query service at addr.
+func Dial(addr string) (*RemoteServer, error) {
+	conn, err := grpc.Dial(
+		addr,
+		grpc.WithInsecure(),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMsgSize), grpc.MaxCallSendMsgSize(maxMsgSize)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteServer{conn: conn, client: pb.NewQueryServiceClient(conn)}, nil
+}
+
+// Close closes the connection.
+func (r *RemoteServer) Close() error {
+	return r.conn.Close()
+}
+
+// Err returns the error of the last failed call, if any.
+func (r *RemoteServer) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *RemoteServer) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// Process sends the punctured offset vector to the server and returns the parities.
+func (r *RemoteServer) Process(offsetVec []uint64) []uint64 {
+	guesses, err := r.ProcessContext(context.Background(), offsetVec)
+	if err != nil {
+		r.setErr(err)
+		return nil
+	}
+	return guesses
+}
+
+// ProcessContext is like Process, but the call is canceled with ctx and the error is returned instead of kept for Err.
+func (r *RemoteServer) ProcessContext(ctx context.Context, offsetVec []uint64) ([]uint64, error) {
+	res, err := r.client.PunctSetQuery(ctx, &pb.PunctSetQueryMsg{
+		PunctSetSize: uint64(len(offsetVec)),
+		Indices:      offsetVec,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.GetGuesses(), nil
+}
+
+// Query returns the x-th entry with a non-private plaintext query.
+func (r *RemoteServer) Query(x uint64) uint64 {
+	res, err := r.client.PlaintextQuery(context.Background(), &pb.PlaintextQueryMsg{Index: x})
+	if err != nil {
+		r.setErr(err)
+		return 0
+	}
+	if len(res.GetVal()) != 1 {
+		r.setErr(fmt.Errorf("malformed plaintext response"))
+		return 0
+	}
+	return res.GetVal()[0]
+}
+
+// Download streams the whole database from the server, as the client does in the setup phase.
+// The returned Server can be passed to Client.InitializeState.
+func (r *RemoteServer) Download(DBSize uint64) (piano.Server, error) {
+	return r.DownloadContext(context.Background(), DBSize)
+}
+
+// DownloadContext is like Download, but the stream is canceled with ctx.
+func (r *RemoteServer) DownloadContext(ctx context.Context, DBSize uint64) (piano.Server, error) {
+	stream, err := r.client.FetchFullDB(ctx, &pb.FetchFullDBMsg{Dummy: 1})
+	if err != nil {
+		return piano.Server{}, err
+	}
+
+	var s piano.Server
+	s.DBSize = DBSize
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return piano.Server{}, err
+		}
+		if chunk.GetChunkId() != s.ChunkNum {
+			return piano.Server{}, fmt.Errorf("got chunk %d, want %d", chunk.GetChunkId(), s.ChunkNum)
+		}
+		if s.ChunkNum == 0 {
+			s.Boundaries, s.Version = chunk.GetBoundaries(), chunk.GetVersion()
+		}
+		s.ChunkSize = chunk.GetChunkSize()
+		s.DB = append(s.DB, chunk.GetChunk()...)
+		s.ChunkNum++
+	}
+	if err := s.CheckLayout(); err != nil {
+		return piano.Server{}, fmt.Errorf("download: %w", err)
+	}
+	return s, nil
+}
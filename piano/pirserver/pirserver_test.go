@@ -0,0 +1,120 @@
+package pirserver
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"example.com/piano"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sameDatabase reports whether a and b hold the same database with the same chunking and Version.
+func sameDatabase(a, b piano.Server) bool {
+	return reflect.DeepEqual(a.DB, b.DB) && a.DBSize == b.DBSize && a.ChunkSize == b.ChunkSize &&
+		a.ChunkNum == b.ChunkNum && a.Version == b.Version && reflect.DeepEqual(a.Boundaries, b.Boundaries)
+}
+
+func TestRemoteQueryLoop(t *testing.T) {
+	server := piano.NewServer(10000)
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	g := NewGRPCServer(server)
+	go g.Serve(lis)
+	defer g.Stop()
+
+	remote, err := Dial(lis.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer remote.Close()
+
+	downloaded, err := remote.Download(server.DBSize)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if !sameDatabase(server, downloaded) {
+		t.Fatalf("downloaded database differs from the server's")
+	}
+
+	client := piano.NewClient(server.DBSize)
+	state := client.InitializeState(downloaded)
+	for q := 0; q < 100; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		parities := remote.Process(query.Prepare())
+		if err := remote.Err(); err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+		answer, err := state.RecoverAnswer(query, parities)
+		if err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		if want := remote.Query(query.Index()); answer != want {
+			t.Fatalf("index %d: got %d, want %d", query.Index(), answer, want)
+		}
+	}
+
+	if remote.Process([]uint64{1, 2, 3}) != nil || remote.Err() == nil {
+		t.Fatalf("Process: expected an error for a malformed offset vector")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := remote.ProcessContext(ctx, make([]uint64, server.ChunkNum-1)); status.Code(err) != codes.Canceled {
+		t.Fatalf("ProcessContext: got %v, want Canceled", err)
+	}
+	if _, err := remote.DownloadContext(ctx, server.DBSize); status.Code(err) != codes.Canceled {
+		t.Fatalf("DownloadContext: got %v, want Canceled", err)
+	}
+}
+
+func TestRemoteBoundaries(t *testing.T) {
+	server, err := piano.NewServerWithBoundaries([]uint64{0, 64, 96, 112, 176})
+	if err != nil {
+		t.Fatalf("NewServerWithBoundaries: %v", err)
+	}
+	server.Update(5, 42)
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	g := NewGRPCServer(server)
+	go g.Serve(lis)
+	defer g.Stop()
+
+	remote, err := Dial(lis.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer remote.Close()
+
+	downloaded, err := remote.Download(server.DBSize)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if !sameDatabase(server, downloaded) {
+		t.Fatalf("downloaded database differs from the server's")
+	}
+
+	client, err := piano.NewClientWithBoundaries(server.Boundaries)
+	if err != nil {
+		t.Fatalf("NewClientWithBoundaries: %v", err)
+	}
+	state := client.InitializeState(downloaded)
+	for x := uint64(0); x < server.DBSize; x++ {
+		answer, err := state.Retrieve(x, remote)
+		if err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+		if answer != server.Query(x) {
+			t.Fatalf("index %d: got %d, want %d", x, answer, server.Query(x))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package piano
+
+import "fmt"
+
+// QueryPlan is the schedule of PlanQueries for a known access sequence.
+type QueryPlan struct {
+	// Rounds holds the indices to query, one batch per server round-trip. Every index of the sequence that is
+	// not cached appears in exactly one round, however often it repeats; the later reads are served from the
+	// local cache.
+	Rounds [][]uint64
+
+	indices []uint64 // the access sequence, in order
+	state   *ClientState
+}
+
+// PlanQueries schedules the reads of indices, in this order, for ExecutePlan on state. Repeated and cached
+// indices are not queried again, and the other indices are batched into as few rounds as the primary hints
+// allow: two queries of a round cannot share a hint, so an index whose hint is taken moves to a later round.
+// Within a round the indices are interleaved across chunks, so the backup hints of a chunk are consumed
+// evenly along the schedule rather than in bursts. The plan does not change state.
+func PlanQueries(indices []uint64, state *ClientState) QueryPlan {
+	plan := QueryPlan{indices: indices, state: state}
+	seen := make(map[uint64]bool)
+	var byHint [][]uint64 // the r-th round holds the r-th index of every hint
+	hintRound := make(map[uint64]int)
+	var missed []uint64
+	for _, x := range indices {
+		if seen[x] {
+			continue
+		}
+		seen[x] = true
+		if _, ok := state.Cached(x); ok {
+			continue
+		}
+		local, err := state.localIndex(x)
+		hitId := noHit
+		if err == nil {
+			hitId = state.findHit(local)
+		}
+		if hitId == noHit {
+			// retrieved on its own at the end, or fails there if out of range
+			missed = append(missed, x)
+			continue
+		}
+		r := hintRound[hitId]
+		hintRound[hitId]++
+		if r == len(byHint) {
+			byHint = append(byHint, nil)
+		}
+		byHint[r] = append(byHint[r], x)
+	}
+	for _, round := range byHint {
+		plan.Rounds = append(plan.Rounds, interleaveChunks(round, state))
+	}
+	if len(missed) > 0 {
+		plan.Rounds = append(plan.Rounds, missed)
+	}
+	return plan
+}
+
+// interleaveChunks orders indices round-robin over their chunks in state, keeping the order within every chunk.
+// The indices are in the range of state.
+func interleaveChunks(indices []uint64, state *ClientState) []uint64 {
+	var chunks []uint64
+	byChunk := make(map[uint64][]uint64)
+	for _, x := range indices {
+		chunkId := state.chunkOf(x - state.rangeStart)
+		if _, ok := byChunk[chunkId]; !ok {
+			chunks = append(chunks, chunkId)
+		}
+		byChunk[chunkId] = append(byChunk[chunkId], x)
+	}
+	ordered := make([]uint64, 0, len(indices))
+	for len(ordered) < len(indices) {
+		for _, chunkId := range chunks {
+			if rest := byChunk[chunkId]; len(rest) > 0 {
+				ordered = append(ordered, rest[0])
+				byChunk[chunkId] = rest[1:]
+			}
+		}
+	}
+	return ordered
+}
+
+// ExecutePlan runs plan against srv and returns the entries of the planned access sequence, in its order.
+// A round is a single call if srv has ProcessBatch, like Server. Recovering a round refreshes its hints, so an
+// index of a later round may have lost its hint or now share one with another index of its round; such an
+// index is retrieved with Retrieve after its round instead.
+func ExecutePlan(plan QueryPlan, srv PIRServer) ([]uint64, error) {
+	c := plan.state
+	values := make(map[uint64]uint64)
+	for _, round := range plan.Rounds {
+		var queries []ClientQuery
+		var missed []uint64
+		used := make(map[uint64]bool)
+		for _, x := range round {
+			if answer, ok := c.Cached(x); ok {
+				values[x] = answer
+				continue
+			}
+			query, err := c.QueryIndex(x)
+			if err != nil {
+				return nil, fmt.Errorf("execute plan: %w", err)
+			}
+			if query.IsDummy() || used[query.hitId] {
+				missed = append(missed, x)
+				continue
+			}
+			used[query.hitId] = true
+			queries = append(queries, query)
+		}
+
+		if len(queries) > 0 {
+			answers, errs := c.RecoverBatch(queries, processRound(srv, c.PrepareBatch(queries)))
+			for i, query := range queries {
+				if errs[i] != nil {
+					return nil, fmt.Errorf("execute plan: index %d: %w", query.Index(), errs[i])
+				}
+				values[query.Index()] = answers[i]
+			}
+		}
+		for _, x := range missed {
+			answer, err := c.Retrieve(x, srv)
+			if err != nil {
+				return nil, fmt.Errorf("execute plan: %w", err)
+			}
+			values[x] = answer
+		}
+	}
+
+	out := make([]uint64, len(plan.indices))
+	for i, x := range plan.indices {
+		answer, ok := values[x]
+		if !ok {
+			// cached when the plan was made
+			if answer, ok = c.Cached(x); !ok {
+				return nil, fmt.Errorf("execute plan: index %d is neither planned nor cached", x)
+			}
+		}
+		out[i] = answer
+	}
+	return out, nil
+}
@@ -0,0 +1,111 @@
+package piano
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// roundTripServer counts the round-trips to a Server, a ProcessBatch call being one.
+type roundTripServer struct {
+	server Server
+	calls  int
+}
+
+func (s *roundTripServer) Process(offsetVec []uint64) []uint64 {
+	s.calls++
+	return s.server.Process(offsetVec)
+}
+
+func (s *roundTripServer) ProcessBatch(offsetVecs [][]uint64) [][]uint64 {
+	s.calls++
+	return s.server.ProcessBatch(offsetVecs)
+}
+
+func (s *roundTripServer) Query(x uint64) uint64 {
+	return s.server.Query(x)
+}
+
+func TestPlanQueries(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	setup := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+
+	// 60 distinct indices, each read about 3 times
+	rng := rand.New(rand.NewSource(3))
+	distinct := rng.Perm(int(server.DBSize))[:60]
+	var indices []uint64
+	for i := 0; i < 180; i++ {
+		indices = append(indices, uint64(distinct[rng.Intn(len(distinct))]))
+	}
+
+	naive := &roundTripServer{server: server}
+	state := setup.Clone()
+	for _, x := range indices {
+		if _, err := state.Retrieve(x, naive); err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+	}
+
+	planned := &roundTripServer{server: server}
+	state = setup.Clone()
+	plan := PlanQueries(indices, state)
+	queried := 0
+	for _, round := range plan.Rounds {
+		queried += len(round)
+	}
+	if queried > len(distinct) {
+		t.Fatalf("the plan queries %d indices, the sequence has %d distinct ones", queried, len(distinct))
+	}
+	values, err := ExecutePlan(plan, planned)
+	if err != nil {
+		t.Fatalf("ExecutePlan: %v", err)
+	}
+	for i, x := range indices {
+		if values[i] != server.Query(x) {
+			t.Fatalf("read %d, index %d: got %d, want %d", i, x, values[i], server.Query(x))
+		}
+	}
+	if planned.calls >= naive.calls {
+		t.Fatalf("the plan took %d round-trips, sequential Retrieve %d", planned.calls, naive.calls)
+	}
+	t.Logf("%d rounds, %d round-trips, sequential Retrieve %d", len(plan.Rounds), planned.calls, naive.calls)
+
+	// a second plan of the same sequence is served from the cache
+	plan = PlanQueries(indices, state)
+	if len(plan.Rounds) != 0 {
+		t.Fatalf("the plan of a cached sequence has %d rounds", len(plan.Rounds))
+	}
+	calls := planned.calls
+	if values, err := ExecutePlan(plan, planned); err != nil || values[0] != server.Query(indices[0]) || planned.calls != calls {
+		t.Fatalf("ExecutePlan of a cached sequence: %v after %d round-trips", err, planned.calls-calls)
+	}
+}
+
+func TestInterleaveChunks(t *testing.T) {
+	// chunks of 64, 32, 16 and 64 entries
+	client, err := NewClientWithBoundaries([]uint64{0, 64, 96, 112, 176})
+	if err != nil {
+		t.Fatalf("NewClientWithBoundaries: %v", err)
+	}
+	server, err := NewServerWithBoundaries(client.Boundaries)
+	if err != nil {
+		t.Fatalf("NewServerWithBoundaries: %v", err)
+	}
+	state := client.InitializeStateWithSeed(server, 1)
+	got := interleaveChunks([]uint64{96, 100, 64, 70, 112}, state)
+	if want := []uint64{96, 64, 112, 100, 70}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("boundaries: got %v, want %v", got, want)
+	}
+
+	// the chunks of a range client start at RangeStart
+	client, err = NewClientForRange(1000, 2000)
+	if err != nil {
+		t.Fatalf("NewClientForRange: %v", err)
+	}
+	state = client.InitializeStateWithSeed(NewServerWithSeed(10000, 2), 3)
+	last, next := 1000+state.ChunkSize-1, 1000+state.ChunkSize // the end of chunk 0 and the start of chunk 1
+	got = interleaveChunks([]uint64{next, next + 1, last}, state)
+	if want := []uint64{next, last, next + 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("range: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package piano
+
+import (
+	"context"
+	"fmt"
+)
+
+// PoolSelector returns the name of the hint pool that answers index, or "" for the hints of the state itself.
+type PoolSelector func(index uint64) string
+
+// AddHintPool runs the setup phase of client against s for an extra pool of hints named name. Once the
+// SetPoolSelector function routes an index to the pool, QueryIndex, RecoverAnswer and Retrieve use its primary
+// and backup hints instead of the state's own, so interleaved workloads, e.g. hot metadata and cold blobs, each
+// consume only the backup hints of their own pool. client sets M1 and M2 of the pool; the range and the chunk
+// boundaries are the ones of the state, and s has to be at the Version of the state. The answers of every pool
+// go to the local cache of the state. A pool of the same name is replaced. Save, ApplyUpdate and RotateKeys
+// leave the pools out: after an update the queries of a pool return ErrStaleHints until it is added again.
+func (c *ClientState) AddHintPool(name string, client Client, s Server) error {
+	if name == "" {
+		return fmt.Errorf("hint pool name is empty")
+	}
+	if s.Version != c.version {
+		return fmt.Errorf("hint pool %q: server version %d, hints of version %d: %w", name, s.Version, c.version, ErrStaleHints)
+	}
+	client.RangeStart, client.RangeEnd = c.config.RangeStart, c.config.RangeEnd
+	client.Boundaries = c.config.Boundaries
+	// the state caches the answers of its pools
+	client.DisableCache = true
+	pool, err := client.initializeState(context.Background(), s, c.rng.Int63(), 1)
+	if err != nil {
+		return fmt.Errorf("hint pool %q: %w", name, err)
+	}
+	if pool.DBSize != c.DBSize {
+		return fmt.Errorf("hint pool %q: DBSize is %d, the state has %d", name, pool.DBSize, c.DBSize)
+	}
+	pool.failureMode, pool.logger = c.failureMode, c.logger
+	if c.pools == nil {
+		c.pools = make(map[string]*ClientState)
+	}
+	c.pools[name] = pool
+	return nil
+}
+
+// SetPoolSelector routes every index to the hint pool named by selector, see AddHintPool. An index whose pool was
+// not added is answered by the hints of the state itself, as is every index if selector is nil.
+func (c *ClientState) SetPoolSelector(selector PoolSelector) {
+	c.poolSelector = selector
+}
+
+// HintPool returns the state of the hint pool named name, e.g. for its ChunkHintsRemaining, or nil if there is
+// no such pool. Queries should go through the state that owns the pool.
+func (c *ClientState) HintPool(name string) *ClientState {
+	return c.pools[name]
+}
+
+// poolFor returns the name and the state of the hint pool of local, which is c itself for the default pool.
+func (c *ClientState) poolFor(local uint64) (string, *ClientState) {
+	if c.poolSelector == nil {
+		return "", c
+	}
+	name := c.poolSelector(c.rangeStart + local)
+	if pool, ok := c.pools[name]; ok {
+		return name, pool
+	}
+	return "", c
+}
+
+// poolQuery builds the query for target from the hints of the pool named name, for a state at version.
+func (c *ClientState) poolQuery(name string, target uint64, version uint64) (ClientQuery, error) {
+	if c.version != version {
+		return ClientQuery{}, fmt.Errorf("hint pool %q: hints of version %d, the state has %d: %w", name, c.version, version, ErrStaleHints)
+	}
+	query, err := c.queryIndex(target)
+	query.pool = name
+	return query, err
+}
+
+// recoverPool is RecoverAnswer for a query of a hint pool.
+func (c *ClientState) recoverPool(clientQuery ClientQuery, serverParities []uint64) (uint64, error) {
+	pool, ok := c.pools[clientQuery.pool]
+	if !ok {
+		return 0, fmt.Errorf("hint pool %q: %w", clientQuery.pool, ErrStaleQuery)
+	}
+	query := clientQuery
+	query.pool = ""
+	answer, err := pool.RecoverAnswer(query, serverParities)
+	if err != nil {
+		return 0, err
+	}
+	c.cachePut(clientQuery.index, answer)
+	return answer, nil
+}
@@ -0,0 +1,70 @@
+package piano
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHintPools(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	client := NewClient(server.DBSize)
+	state := client.InitializeStateWithSeed(server, 2)
+	hot := client
+	hot.M2 = 128
+	if err := state.AddHintPool("hot", hot, server); err != nil {
+		t.Fatalf("AddHintPool: %v", err)
+	}
+	pool := state.HintPool("hot")
+	// the first 100 entries are the hot metadata, all in chunk 0
+	state.SetPoolSelector(func(index uint64) string {
+		if index < 100 {
+			return "hot"
+		}
+		return ""
+	})
+
+	for x := uint64(0); x < 90; x++ {
+		answer, err := state.Retrieve(x, server)
+		if err != nil || answer != server.Query(x) {
+			t.Fatalf("Retrieve(%d): got %d, %v, want %d", x, answer, err, server.Query(x))
+		}
+	}
+	if state.consumedHintNum[0] != 0 {
+		t.Fatalf("hot reads consumed %d backup hints of the state", state.consumedHintNum[0])
+	}
+	if pool.consumedHintNum[0] < 90 {
+		t.Fatalf("hot reads consumed %d backup hints of the pool, want at least 90", pool.consumedHintNum[0])
+	}
+
+	consumed := append([]uint64(nil), pool.consumedHintNum...)
+	for x := uint64(100); x < 120; x++ {
+		query, err := state.QueryIndex(x)
+		if err != nil {
+			t.Fatalf("QueryIndex(%d): %v", x, err)
+		}
+		if query.IsDummy() {
+			continue
+		}
+		answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+		if err != nil || answer != server.Query(x) {
+			t.Fatalf("RecoverAnswer(%d): got %d, %v, want %d", x, answer, err, server.Query(x))
+		}
+	}
+	for i := range consumed {
+		if pool.consumedHintNum[i] != consumed[i] {
+			t.Fatalf("cold reads consumed backup hints of the pool in chunk %d", i)
+		}
+	}
+	if state.consumedHintNum[1] == 0 {
+		t.Fatalf("cold reads consumed no backup hints of the state")
+	}
+	if answer, ok := state.Cached(50); !ok || answer != server.Query(50) {
+		t.Fatalf("Cached(50): got %d, %v, want %d", answer, ok, server.Query(50))
+	}
+
+	// a pool at an older version is stale
+	state.ApplyUpdate(5000, 1)
+	if _, err := state.QueryIndex(95); !errors.Is(err, ErrStaleHints) {
+		t.Fatalf("QueryIndex of a stale pool: got %v, want ErrStaleHints", err)
+	}
+}
@@ -0,0 +1,44 @@
+package piano
+
+// Precompute speeds up Process for a fixed database. See Server.BuildPrecompute.
+type Precompute struct {
+	// delta[i*ChunkSize+o] = DB[i*ChunkSize+o] ^ DB[(i+1)*ChunkSize+o] for the first ChunkNum-1 chunks
+	delta []uint64
+}
+
+// BuildPrecompute returns the accelerator for ProcessFast. It takes as much memory as the database, and
+// has to be built again after Update. It panics for a database with Boundaries.
+func (s Server) BuildPrecompute() *Precompute {
+	if s.Boundaries != nil {
+		panic("piano: BuildPrecompute needs chunks of ChunkSize entries")
+	}
+	n := s.ChunkNum - 1
+	p := &Precompute{delta: make([]uint64, n*s.ChunkSize)}
+	for i := uint64(0); i < n*s.ChunkSize; i++ {
+		p.delta[i] = s.DB[i] ^ s.DB[i+s.ChunkSize]
+	}
+	return p
+}
+
+// ProcessFast is like Process, but with p it reads two entries per chunk instead of three, in a single pass.
+// p must have been built from the current database. Like Process, it answers a malformed vector with no parities.
+func (s Server) ProcessFast(p *Precompute, offsetVec []uint64) []uint64 {
+	offsetVec, err := checkOffsets(offsetVec, s.ChunkSize, s.ChunkNum)
+	if err != nil {
+		s.logf("piano: ProcessFast: %v", err)
+		return nil
+	}
+	// parities[i] is parities[0] ^ deltas[i], where deltas is the prefix XOR of the deltas at the offsets,
+	// so parities[0] and deltas come out of a single pass
+	parities := make([]uint64, s.ChunkNum)
+	base, deltas := uint64(0), uint64(0)
+	for i := uint64(0); i < s.ChunkNum-1; i++ {
+		base ^= s.DB[(i+1)*s.ChunkSize+offsetVec[i]]
+		deltas ^= p.delta[i*s.ChunkSize+offsetVec[i]]
+		parities[i+1] = deltas
+	}
+	for i := range parities {
+		parities[i] ^= base
+	}
+	return parities
+}
@@ -0,0 +1,41 @@
+package piano
+
+import "fmt"
+
+// PrefetchError is returned by Prefetch when some indices could not be retrieved.
+type PrefetchError struct {
+	Prefetched []uint64 // indices now in the local cache
+	Failed     []uint64 // indices that could not be retrieved
+	Err        error    // the error of the first failed index
+}
+
+func (e *PrefetchError) Error() string {
+	return fmt.Sprintf("prefetched %d of %d indices: %v", len(e.Prefetched), len(e.Prefetched)+len(e.Failed), e.Err)
+}
+
+func (e *PrefetchError) Unwrap() error {
+	return e.Err
+}
+
+// Prefetch privately retrieves the indices from s into the local cache, so that later Retrieve calls for
+// them neither contact the server nor consume hints. A failed index, e.g. of a chunk out of backup hints,
+// does not stop the others; the result is then a *PrefetchError listing both. With a bounded cache
+// (SetCacheCapacity) prefetched entries can be evicted again.
+func (c *ClientState) Prefetch(indices []uint64, s PIRServer) error {
+	var prefetched, failed []uint64
+	var firstErr error
+	for _, x := range indices {
+		if _, err := c.Retrieve(x, s); err != nil {
+			failed = append(failed, x)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		prefetched = append(prefetched, x)
+	}
+	if len(failed) > 0 {
+		return &PrefetchError{prefetched, failed, firstErr}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package piano
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPrefetch(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+	indices := []uint64{1, 500, 501, 9999}
+	if err := state.Prefetch(indices, server); err != nil {
+		t.Fatalf("Prefetch: %v", err)
+	}
+
+	srv := &countingServer{PIRServer: server}
+	consumed := append([]uint64(nil), state.consumedHintNum...)
+	for _, x := range indices {
+		answer, err := state.Retrieve(x, srv)
+		if err != nil || answer != server.Query(x) {
+			t.Fatalf("Retrieve(%d): got %d, %v, want %d", x, answer, err, server.Query(x))
+		}
+	}
+	if srv.calls != 0 {
+		t.Fatalf("prefetched indices made %d server calls", srv.calls)
+	}
+	for i := range consumed {
+		if state.consumedHintNum[i] != consumed[i] {
+			t.Fatalf("prefetched indices consumed backup hints of chunk %d", i)
+		}
+	}
+
+	// chunk 0 only has 2 backup hints
+	client.M2 = 2
+	state = client.InitializeState(server)
+	indices = []uint64{0, 1, 2, 3, 4}
+	err := state.Prefetch(indices, server)
+	var prefetchErr *PrefetchError
+	if !errors.As(err, &prefetchErr) || !errors.Is(err, ErrHintsExhausted) {
+		t.Fatalf("Prefetch: got %v, want a PrefetchError with ErrHintsExhausted", err)
+	}
+	if len(prefetchErr.Failed) == 0 || len(prefetchErr.Prefetched)+len(prefetchErr.Failed) != len(indices) {
+		t.Fatalf("prefetched %v, failed %v", prefetchErr.Prefetched, prefetchErr.Failed)
+	}
+	for _, x := range prefetchErr.Prefetched {
+		if answer, ok := state.Cached(x); !ok || answer != server.Query(x) {
+			t.Fatalf("prefetched index %d is not cached", x)
+		}
+	}
+}
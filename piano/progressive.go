@@ -0,0 +1,163 @@
+package piano
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ProgressiveSetup is a setup phase running in the background, see Client.InitializeStateProgressive.
+type ProgressiveSetup struct {
+	state *ClientState
+
+	mu     sync.Mutex
+	cond   *sync.Cond // signaled when a chunk is folded and when the setup ends
+	folded uint64     // the number of chunks folded into the hints so far
+	done   bool
+	err    error
+}
+
+// InitializeStateProgressive is like InitializeStateFromStream, but returns right away and folds the chunks in
+// the background, so that the first queries do not wait for the whole database. ProgressiveSetup.QueryIndex
+// blocks only until the chunk of its index has been folded, and the query can be sent to the server while the
+// rest of the database is still downloading. The hint parities only cover the database once every chunk is
+// folded, so ProgressiveSetup.RecoverAnswer waits for the end of the setup. Every chunk is dropped once it is
+// folded, so the setup holds no more of the database than InitializeStateFromStream.
+func (c Client) InitializeStateProgressive(ch <-chan []uint64, DBSize uint64) *ProgressiveSetup {
+	return c.InitializeStateProgressiveWithSeed(ch, DBSize, time.Now().UnixNano())
+}
+
+// InitializeStateProgressiveWithSeed is like InitializeStateProgressive, but samples from seed like
+// InitializeStateWithSeed.
+func (c Client) InitializeStateProgressiveWithSeed(ch <-chan []uint64, DBSize uint64, seed int64) *ProgressiveSetup {
+	p := &ProgressiveSetup{}
+	p.cond = sync.NewCond(&p.mu)
+	// check the chunking before allocating any hints for it
+	if DBSize == 0 {
+		p.done, p.err = true, fmt.Errorf("setup: %w", ErrEmptyDatabase)
+		return p
+	}
+	if err := c.checkChunking(DBSize); err != nil {
+		p.done, p.err = true, err
+		return p
+	}
+	ChunkSize, ChunkNum := c.chunking(DBSize)
+	p.state = c.newClientState(DBSize, ChunkSize, ChunkNum, rand.New(rand.NewSource(seed)))
+	go p.run(ch)
+	return p
+}
+
+func (p *ProgressiveSetup) run(ch <-chan []uint64) {
+	c := p.state
+	var err error
+	for i := uint64(0); i < c.ChunkNum; i++ {
+		chunk, ok := <-ch
+		if !ok {
+			err = fmt.Errorf("stream closed after %d of %d chunks", i, c.ChunkNum)
+			break
+		}
+		if uint64(len(chunk)) != c.chunkLen(i) {
+			err = fmt.Errorf("chunk %d has %d entries, want %d", i, len(chunk), c.chunkLen(i))
+			break
+		}
+		// only this goroutine writes the hint parities until the setup ends, the queries only read the keys
+		c.foldChunk(i, chunk)
+		p.mu.Lock()
+		p.folded = i + 1
+		p.mu.Unlock()
+		p.cond.Broadcast()
+	}
+	p.mu.Lock()
+	p.done, p.err = true, err
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// Ready reports whether the chunkId-th chunk has been folded into the hints.
+func (p *ProgressiveSetup) Ready(chunkId uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return chunkId < p.folded
+}
+
+// Wait blocks until the setup ends and returns the state, or the error of the stream.
+func (p *ProgressiveSetup) Wait() (*ClientState, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitDone()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.state, nil
+}
+
+// waitDone blocks until the setup ends. p.mu must be held.
+func (p *ProgressiveSetup) waitDone() {
+	for !p.done {
+		p.cond.Wait()
+	}
+}
+
+// QueryIndex builds the query for index like ClientState.QueryIndex. It blocks until the chunk of index is
+// Ready, and fails with the error of the stream if the setup ends without it.
+func (p *ProgressiveSetup) QueryIndex(index uint64) (ClientQuery, error) {
+	c := p.state
+	if c == nil {
+		// the setup failed before it started
+		return ClientQuery{}, p.err
+	}
+	local, err := c.localIndex(index)
+	if err != nil {
+		return ClientQuery{}, err
+	}
+	chunkId := c.chunkOf(local)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.done && chunkId >= p.folded {
+		p.cond.Wait()
+	}
+	if chunkId >= p.folded {
+		return ClientQuery{}, p.err
+	}
+	return c.QueryIndex(index)
+}
+
+// RecoverAnswer recovers the answer to a query of QueryIndex like ClientState.RecoverAnswer. It blocks until
+// the setup ends, since until then the hint parities miss the chunks that are still downloading.
+func (p *ProgressiveSetup) RecoverAnswer(clientQuery ClientQuery, serverParities []uint64) (uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitDone()
+	if p.err != nil {
+		return 0, p.err
+	}
+	return p.state.RecoverAnswer(clientQuery, serverParities)
+}
+
+// Retrieve reads the entry at index from srv. It sends the query as soon as the chunk of index is Ready and
+// recovers the answer once the setup ends, so the round-trip overlaps with the rest of the download. An index
+// that is cached or that no primary hint contains is read with ClientState.Retrieve after the setup. Retrieve
+// is safe for concurrent use, but the state from Wait must not be used concurrently with it.
+func (p *ProgressiveSetup) Retrieve(index uint64, srv PIRServer) (uint64, error) {
+	if query, err := p.QueryIndex(index); err == nil && !query.IsDummy() {
+		parities, version := processVersion(srv, query.Prepare(), p.state.version)
+		if version != p.state.version {
+			return 0, fmt.Errorf("retrieve index %d: server version %d, hints of version %d: %w", index, version, p.state.version, ErrStaleHints)
+		}
+		// a concurrent Retrieve may have consumed the same hint first, then the query is stale
+		if answer, err := p.RecoverAnswer(query, parities); !errors.Is(err, ErrStaleQuery) {
+			return answer, err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitDone()
+	if p.err != nil {
+		return 0, p.err
+	}
+	return p.state.Retrieve(index, srv)
+}
@@ -0,0 +1,126 @@
+package piano
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInitializeStateProgressive(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	client := NewClient(server.DBSize)
+	ch := make(chan []uint64)
+	p := client.InitializeStateProgressiveWithSeed(ch, server.DBSize, 2)
+	srv := &countingServer{PIRServer: server}
+
+	chunk := func(i uint64) []uint64 { return server.DB[i*server.ChunkSize : (i+1)*server.ChunkSize] }
+	if p.Ready(0) {
+		t.Fatalf("chunk 0 is ready before it was sent")
+	}
+
+	// a query of chunk 50 waits for it while the first chunks arrive
+	x := 50*server.ChunkSize + 7
+	queries := make(chan error)
+	go func() {
+		_, err := p.QueryIndex(x)
+		queries <- err
+	}()
+	for i := uint64(0); i < 10; i++ {
+		ch <- chunk(i)
+	}
+	// the unbuffered channel returns once the chunk is received, not folded, so send one more
+	ch <- chunk(10)
+	for i := uint64(0); i < 10; i++ {
+		if !p.Ready(i) {
+			t.Fatalf("chunk %d is not ready after it was sent", i)
+		}
+	}
+	if p.Ready(50) {
+		t.Fatalf("chunk 50 is ready before it was sent")
+	}
+
+	// a query of a ready chunk goes to the server during the setup, its answer is recovered after it
+	var query ClientQuery
+	for y := uint64(0); y < 10*server.ChunkSize; y++ {
+		q, err := p.QueryIndex(y)
+		if err != nil {
+			t.Fatalf("QueryIndex(%d) during the setup: %v", y, err)
+		}
+		if !q.IsDummy() {
+			query = q
+			break
+		}
+	}
+	parities := srv.Process(query.Prepare())
+	answers := make(chan uint64)
+	go func() {
+		answer, err := p.RecoverAnswer(query, parities)
+		if err != nil {
+			t.Errorf("RecoverAnswer(%d): %v", query.Index(), err)
+		}
+		answers <- answer
+	}()
+	select {
+	case <-queries:
+		t.Fatalf("QueryIndex(%d) returned before its chunk arrived", x)
+	case <-answers:
+		t.Fatalf("RecoverAnswer returned before the setup ended")
+	default:
+	}
+
+	for i := uint64(11); i <= 51; i++ {
+		ch <- chunk(i)
+	}
+	if err := <-queries; err != nil {
+		t.Fatalf("QueryIndex(%d): %v", x, err)
+	}
+	for i := uint64(52); i < server.ChunkNum; i++ {
+		ch <- chunk(i)
+	}
+	if answer := <-answers; answer != server.Query(query.Index()) {
+		t.Fatalf("index %d: got %d, want %d", query.Index(), answer, server.Query(query.Index()))
+	}
+
+	state, err := p.Wait()
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if !p.Ready(server.ChunkNum - 1) {
+		t.Fatalf("the last chunk is not ready after the setup")
+	}
+	// the same queries on InitializeStateWithSeed give the same hints
+	want := client.InitializeStateWithSeed(server, 2)
+	for y := uint64(0); y <= query.Index(); y++ {
+		if q, err := want.QueryIndex(y); err == nil && !q.IsDummy() {
+			want.RecoverAnswer(q, server.Process(q.Prepare()))
+		}
+	}
+	if !reflect.DeepEqual(state.primaryHints, want.primaryHints) || !reflect.DeepEqual(state.backupHints, want.backupHints) {
+		t.Fatalf("the progressive setup gives different hints than InitializeStateWithSeed")
+	}
+	// after the setup, reads are private queries
+	calls := srv.calls
+	y := uint64(4242)
+	if answer, err := p.Retrieve(y, srv); err != nil || answer != server.Query(y) || srv.calls == calls {
+		t.Fatalf("Retrieve(%d) after the setup: got %d, %v after %d server calls", y, answer, err, srv.calls-calls)
+	}
+
+	closed := make(chan []uint64)
+	close(closed)
+	short := client.InitializeStateProgressive(closed, server.DBSize)
+	if _, err := short.Wait(); err == nil {
+		t.Fatalf("Wait: expected an error for a closed stream")
+	}
+	if _, err := short.Retrieve(0, srv); err == nil {
+		t.Fatalf("Retrieve: expected an error for a closed stream")
+	}
+
+	// invalid boundaries fail before any hints are allocated
+	client.Boundaries = []uint64{}
+	bad := client.InitializeStateProgressive(closed, server.DBSize)
+	if _, err := bad.Wait(); err == nil {
+		t.Fatalf("Wait: expected an error for empty chunk boundaries")
+	}
+	if _, err := bad.Retrieve(0, srv); err == nil {
+		t.Fatalf("Retrieve: expected an error for empty chunk boundaries")
+	}
+}
@@ -0,0 +1,88 @@
+package piano
+
+import "fmt"
+
+// A query that was sent to the server can be recovered by its id, for a transport that returns the parities
+// tagged with the id instead of in order. The state keeps a query until its primary hint is consumed, from
+// then on none of the queries of that hint can be recovered, or until it is one of more than maxPendingQueries
+// queries kept, when the oldest is dropped: queries that are built but never sent do not pile up.
+
+// maxPendingQueries bounds the queries RecoverAnswerByID can recover.
+const maxPendingQueries = 4096
+
+// QueryID returns the id of the query, unique within its ClientState. Dummy queries have id 0 and cannot be
+// recovered by id.
+func (c ClientQuery) QueryID() uint64 {
+	return c.id
+}
+
+// track assigns the next id to query and keeps it until its primary hint is consumed.
+func (c *ClientState) track(query ClientQuery) ClientQuery {
+	if c.pending == nil {
+		c.pending = make(map[uint64]ClientQuery)
+		c.hintQueries = make(map[uint64][]uint64)
+	}
+	c.lastQueryID++
+	query.id = c.lastQueryID
+	c.pending[query.id] = query
+	c.hintQueries[query.hitId] = append(c.hintQueries[query.hitId], query.id)
+	c.pendingOrder = append(c.pendingOrder, query.id)
+	for len(c.pending) > maxPendingQueries {
+		c.dropOldest()
+	}
+	if len(c.pendingOrder) > 2*maxPendingQueries {
+		// drop the ids that went away with their hint
+		kept := c.pendingOrder[:0]
+		for _, id := range c.pendingOrder {
+			if _, ok := c.pending[id]; ok {
+				kept = append(kept, id)
+			}
+		}
+		c.pendingOrder = kept
+	}
+	return query
+}
+
+// dropOldest forgets the oldest query that is still kept.
+func (c *ClientState) dropOldest() {
+	for len(c.pendingOrder) > 0 {
+		id := c.pendingOrder[0]
+		c.pendingOrder = c.pendingOrder[1:]
+		query, ok := c.pending[id]
+		if !ok {
+			continue
+		}
+		delete(c.pending, id)
+		ids := c.hintQueries[query.hitId]
+		for k := range ids {
+			if ids[k] == id {
+				ids = append(ids[:k], ids[k+1:]...)
+				break
+			}
+		}
+		if len(ids) == 0 {
+			delete(c.hintQueries, query.hitId)
+		} else {
+			c.hintQueries[query.hitId] = ids
+		}
+		return
+	}
+}
+
+// untrack forgets the queries of the hitId-th primary hint.
+func (c *ClientState) untrack(hitId uint64) {
+	for _, id := range c.hintQueries[hitId] {
+		delete(c.pending, id)
+	}
+	delete(c.hintQueries, hitId)
+}
+
+// RecoverAnswerByID is like RecoverAnswer for the query with the given id. An id whose primary hint was
+// consumed, by this or another query, returns ErrStaleQuery.
+func (c *ClientState) RecoverAnswerByID(id uint64, serverParities []uint64) (uint64, error) {
+	query, ok := c.pending[id]
+	if !ok {
+		return 0, fmt.Errorf("query %d: %w", id, ErrStaleQuery)
+	}
+	return c.RecoverAnswer(query, serverParities)
+}
@@ -0,0 +1,81 @@
+package piano
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRecoverAnswerByID(t *testing.T) {
+	server := NewServer(10000)
+	state := NewClient(server.DBSize).InitializeState(server)
+
+	type response struct {
+		id       uint64
+		index    uint64
+		parities [][]uint64
+	}
+	var responses []response
+	used := make(map[uint64]bool)
+	for len(responses) < 50 {
+		query, err := state.TryRandomQuery()
+		if err != nil || used[query.hitId] {
+			continue
+		}
+		used[query.hitId] = true
+		responses = append(responses, response{query.QueryID(), query.Index(), [][]uint64{server.Process(query.Prepare())}})
+	}
+
+	state.rng.Shuffle(len(responses), func(a, b int) { responses[a], responses[b] = responses[b], responses[a] })
+	for _, r := range responses {
+		answer, err := state.RecoverAnswerByID(r.id, r.parities[0])
+		if err != nil {
+			t.Fatalf("RecoverAnswerByID(%d): %v", r.id, err)
+		}
+		if answer != server.Query(r.index) {
+			t.Fatalf("query %d, index %d: got %d, want %d", r.id, r.index, answer, server.Query(r.index))
+		}
+		// the hint is consumed, so the id is no longer pending
+		if _, err := state.RecoverAnswerByID(r.id, r.parities[0]); !errors.Is(err, ErrStaleQuery) {
+			t.Fatalf("recovering query %d twice: got %v, want ErrStaleQuery", r.id, err)
+		}
+	}
+	// the queries that were built on a hint in use but never sent went away with the hint
+	if len(state.pending) != 0 || len(state.hintQueries) != 0 {
+		t.Fatalf("%d queries still pending", len(state.pending))
+	}
+}
+
+func TestPendingQueriesBounded(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	state := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+	var first, last ClientQuery
+	for built := 0; built < 3*maxPendingQueries; {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		if built == 0 {
+			first = query
+		}
+		last = query
+		built++
+	}
+	if len(state.pending) != maxPendingQueries || len(state.pendingOrder) > 2*maxPendingQueries {
+		t.Fatalf("%d queries pending, %d ids ordered, want at most %d", len(state.pending), len(state.pendingOrder), maxPendingQueries)
+	}
+	ids := 0
+	for _, hintIds := range state.hintQueries {
+		ids += len(hintIds)
+	}
+	if ids != len(state.pending) {
+		t.Fatalf("the hints hold %d query ids, %d queries are pending", ids, len(state.pending))
+	}
+
+	if _, err := state.RecoverAnswerByID(first.QueryID(), server.Process(first.Prepare())); !errors.Is(err, ErrStaleQuery) {
+		t.Fatalf("RecoverAnswerByID of a dropped query: got %v, want ErrStaleQuery", err)
+	}
+	answer, err := state.RecoverAnswerByID(last.QueryID(), server.Process(last.Prepare()))
+	if err != nil || answer != server.Query(last.Index()) {
+		t.Fatalf("RecoverAnswerByID of the last query: got %d, %v, want %d", answer, err, server.Query(last.Index()))
+	}
+}
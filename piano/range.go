@@ -0,0 +1,77 @@
+package piano
+
+import "fmt"
+
+// QueryRange privately retrieves the length entries starting at start from srv and returns them in order.
+// Cached entries are not queried again. The other entries are queried in rounds, one batch per round: if
+// srv has ProcessBatch, like Server, a round is a single call. Queries of the same round use distinct
+// primary hints, so an index whose hint is already taken waits for the next round. Consecutive indices
+// mostly fall into the same chunk and every query of a chunk consumes one of its M2 backup hints, so a
+// range longer than M2 fails with ErrHintsExhausted unless the parameters allow for it. An index that
+// no primary hint contains is retrieved with Retrieve at the end.
+func (c *ClientState) QueryRange(start uint64, length uint64, srv PIRServer) ([]uint64, error) {
+	if _, err := c.localIndex(start); err != nil || length > c.rangeStart+c.DBSize-start {
+		return nil, fmt.Errorf("range [%d, %d+%d) out of range, DBSize is %d", start, start, length, c.DBSize)
+	}
+
+	values := make([]uint64, length)
+	var pending, missed []uint64
+	for x := start; x < start+length; x++ {
+		if answer, ok := c.Cached(x); ok {
+			values[x-start] = answer
+		} else {
+			pending = append(pending, x)
+		}
+	}
+
+	for len(pending) > 0 {
+		var queries []ClientQuery
+		var next []uint64
+		used := make(map[uint64]bool)
+		for _, x := range pending {
+			query, err := c.QueryIndex(x)
+			switch {
+			case err != nil:
+				return nil, err
+			case query.IsDummy():
+				missed = append(missed, x)
+			case used[query.hitId]:
+				next = append(next, x)
+			default:
+				used[query.hitId] = true
+				queries = append(queries, query)
+			}
+		}
+
+		answers, errs := c.RecoverBatch(queries, processRound(srv, c.PrepareBatch(queries)))
+		for i, query := range queries {
+			if errs[i] != nil {
+				return nil, fmt.Errorf("query range: index %d: %w", query.Index(), errs[i])
+			}
+			values[query.Index()-start] = answers[i]
+		}
+		pending = next
+	}
+
+	for _, x := range missed {
+		answer, err := c.Retrieve(x, srv)
+		if err != nil {
+			return nil, fmt.Errorf("query range: %w", err)
+		}
+		values[x-start] = answer
+	}
+	return values, nil
+}
+
+// processRound answers offsetVecs in a single ProcessBatch call if srv has it, like Server, and with one Process
+// call each otherwise.
+func processRound(srv PIRServer, offsetVecs [][]uint64) [][]uint64 {
+	if batch, ok := srv.(interface{ ProcessBatch([][]uint64) [][]uint64 }); ok {
+		return batch.ProcessBatch(offsetVecs)
+	}
+	parities := make([][]uint64, len(offsetVecs))
+	for i, offsetVec := range offsetVecs {
+		parities[i] = srv.Process(offsetVec)
+	}
+	return parities
+}
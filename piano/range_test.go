@@ -0,0 +1,39 @@
+package piano
+
+import "testing"
+
+func TestQueryRange(t *testing.T) {
+	server := NewServer(10000)
+	defaults := NewClient(server.DBSize)
+	// the range falls into two chunks, so each of them needs about 50 backup hints
+	client, err := NewClientWithParams(defaults.Q, defaults.M1, 100)
+	if err != nil {
+		t.Fatalf("NewClientWithParams: %v", err)
+	}
+	state := client.InitializeState(server)
+
+	start := 5000 - server.ChunkSize/2
+	for _, x := range []uint64{start, start + 42} {
+		if _, err := state.Retrieve(x, server); err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+	}
+
+	srv := &countingServer{PIRServer: server}
+	values, err := state.QueryRange(start, 100, srv)
+	if err != nil {
+		t.Fatalf("QueryRange: %v", err)
+	}
+	for i, value := range values {
+		if want := server.Query(start + uint64(i)); value != want {
+			t.Fatalf("index %d: got %d, want %d", start+uint64(i), value, want)
+		}
+	}
+	if srv.calls >= 100 {
+		t.Fatalf("QueryRange made %d server calls, the 2 cached entries should not be queried", srv.calls)
+	}
+
+	if _, err := state.QueryRange(server.DBSize-10, 11, server); err == nil {
+		t.Fatalf("QueryRange: expected an error for a range past DBSize")
+	}
+}
@@ -0,0 +1,193 @@
+package piano
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math/rand"
+	"time"
+)
+
+// DefaultRecordSize is the size in bytes of a uint64 entry.
+const DefaultRecordSize = 8
+
+// ChecksumSize is the size in bytes of the CRC-32 that ends every record of a checksummed RecordServer.
+const ChecksumSize = 4
+
+// Record is a fixed-size database entry of RecordSize bytes.
+type Record []byte
+
+// xorRecord sets dst to dst XOR src. Both records must have the same size.
+func xorRecord(dst Record, src Record) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// RecordServer is like Server, but every entry is a Record of RecordSize bytes. It is a type of its own rather
+// than a RecordSize of Server: the uint64 entries of Server are what Update and ApplyUpdate, the precomputation,
+// the sharding, the encodings and the gRPC service work on, and XORing a uint64 is much cheaper than a byte
+// slice. DefaultRecordSize gives records of the size of a Server entry.
+type RecordServer struct {
+	DB          []byte // the database, every RecordSize bytes is one Record
+	RecordSize  uint64
+	DBSize      uint64
+	ChunkSize   uint64
+	ChunkNum    uint64
+	Checksummed bool // every record ends with the CRC-32 of the rest, see NewRecordServerWithChecksum
+}
+
+// NewRecordServer generates a random database with DBSize records of RecordSize bytes. Like NewServer, it
+// panics with ErrEmptyDatabase if DBSize is 0.
+func NewRecordServer(DBSize uint64, RecordSize uint64) RecordServer {
+	ChunkSize, ChunkNum := mustChunkParams(DBSize)
+
+	// pad the db to ChunkSize*ChunkNum, the padding part is all 0
+	DB := make([]byte, ChunkSize*ChunkNum*RecordSize)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	rng.Read(DB[:DBSize*RecordSize])
+
+	return RecordServer{DB, RecordSize, DBSize, ChunkSize, ChunkNum, false}
+}
+
+// NewRecordServerWithChecksum is like NewRecordServer, but every record carries RecordSize random bytes
+// followed by their CRC-32 in little-endian order, so it is RecordSize+ChecksumSize bytes long. A client
+// set up against it checks the CRC of every recovered record.
+func NewRecordServerWithChecksum(DBSize uint64, RecordSize uint64) RecordServer {
+	s := NewRecordServer(DBSize, RecordSize+ChecksumSize)
+	for i := uint64(0); i < DBSize; i++ {
+		record := s.Query(i)
+		binary.LittleEndian.PutUint32(record[RecordSize:], crc32.ChecksumIEEE(record[:RecordSize]))
+	}
+	s.Checksummed = true
+	return s
+}
+
+// validChecksum reports whether the record ends with the CRC-32 of the rest.
+func validChecksum(record Record) bool {
+	n := len(record) - ChecksumSize
+	return n >= 0 && binary.LittleEndian.Uint32(record[n:]) == crc32.ChecksumIEEE(record[:n])
+}
+
+// Query returns the x-th record of the database. The record aliases the database.
+func (s RecordServer) Query(x uint64) Record {
+	return Record(s.DB[x*s.RecordSize : (x+1)*s.RecordSize])
+}
+
+func (s RecordServer) possibleParities(offsetVec []uint64) []Record {
+	parities := make([]Record, s.ChunkNum)
+	parities[0] = make(Record, s.RecordSize)
+	for i := uint64(0); i < s.ChunkNum-1; i++ {
+		xorRecord(parities[0], s.Query((i+1)*s.ChunkSize+offsetVec[i]))
+	}
+	for i := uint64(0); i < s.ChunkNum-1; i++ {
+		parities[i+1] = append(make(Record, 0, s.RecordSize), parities[i]...)
+		xorRecord(parities[i+1], s.Query((i+1)*s.ChunkSize+offsetVec[i]))
+		xorRecord(parities[i+1], s.Query(i*s.ChunkSize+offsetVec[i]))
+	}
+	return parities
+}
+
+// Process answers a punctured offset vector, packed or not, with the ChunkNum possible parities. Like
+// Server.Process, it answers a malformed vector, see Server.CheckOffsetVec, with no parities.
+func (s RecordServer) Process(offsetVec []uint64) []Record {
+	offsetVec, err := checkOffsets(offsetVec, s.ChunkSize, s.ChunkNum)
+	if err != nil {
+		return nil
+	}
+	return s.possibleParities(offsetVec)
+}
+
+// RecordClientState is the client state for a RecordServer. The hint keys and the backup accounting are kept
+// in a ClientState, the parities and the local cache are Records. The ClientState is not embedded: its
+// Cached, Retrieve and the other methods that answer from uint64 parities do not apply to records.
+type RecordClientState struct {
+	hints *ClientState
+
+	primaryParities []Record
+	backupParities  []Record
+	recordCache     map[uint64]Record
+	checksummed     bool
+}
+
+// InitializeRecordState runs the setup phase against a RecordServer.
+func (c Client) InitializeRecordState(s RecordServer) *RecordClientState {
+	state := &RecordClientState{
+		hints:           c.newClientState(s.DBSize, s.ChunkSize, s.ChunkNum, rand.New(rand.NewSource(time.Now().UnixNano()))),
+		primaryParities: make([]Record, c.M1),
+		recordCache:     make(map[uint64]Record),
+		checksummed:     s.Checksummed,
+	}
+	hints := state.hints
+	state.backupParities = make([]Record, len(hints.backupHints))
+	for j := range state.primaryParities {
+		state.primaryParities[j] = make(Record, s.RecordSize)
+	}
+	for j := range state.backupParities {
+		state.backupParities[j] = make(Record, s.RecordSize)
+	}
+
+	for i := uint64(0); i < s.ChunkNum; i++ {
+		for j := uint64(0); j < c.M1; j++ {
+			xorRecord(state.primaryParities[j], s.Query(hints.Elem(&hints.primaryHints[j], i)))
+		}
+		for j := uint64(0); j < uint64(len(hints.backupHints)); j++ {
+			if !hints.isBackupOf(j, i) {
+				xorRecord(state.backupParities[j], s.Query(hints.Elem(&hints.backupHints[j], i)))
+			}
+		}
+	}
+
+	return state
+}
+
+// QueryIndex builds the query for the record at index like ClientState.QueryIndex. A retrieved record is in
+// the local cache, see Cached, and fails with ErrAlreadyCached.
+func (c *RecordClientState) QueryIndex(index uint64) (ClientQuery, error) {
+	return c.hints.QueryIndex(index)
+}
+
+// TryRandomQuery builds the query for a random record that is not cached, like ClientState.TryRandomQuery.
+func (c *RecordClientState) TryRandomQuery() (ClientQuery, error) {
+	return c.hints.TryRandomQuery()
+}
+
+// Cached returns the record at index if it has been retrieved.
+func (c *RecordClientState) Cached(index uint64) (Record, bool) {
+	record, ok := c.recordCache[index]
+	return record, ok
+}
+
+// ChunkHintsRemaining returns the number of unconsumed backup hints of the chunkId-th chunk.
+func (c *RecordClientState) ChunkHintsRemaining(chunkId uint64) uint64 {
+	return c.hints.ChunkHintsRemaining(chunkId)
+}
+
+// RecoverAnswer recovers the queried record from the server's parities and refreshes the consumed hint.
+// It fails the same way as ClientState.RecoverAnswer and leaves the state unchanged on error. Against a
+// checksummed server it also returns ErrIntegrity if the CRC of the recovered record does not match.
+func (c *RecordClientState) RecoverAnswer(clientQuery ClientQuery, serverParities []Record) (Record, error) {
+	if err := c.hints.checkRecoverable(clientQuery, len(serverParities)); err != nil {
+		return nil, err
+	}
+
+	if uint64(len(serverParities[clientQuery.chunkId])) != uint64(len(c.primaryParities[clientQuery.hitId])) {
+		return nil, ErrMalformedResponse
+	}
+	hitId := clientQuery.hitId
+	answer := append(Record{}, serverParities[clientQuery.chunkId]...)
+	xorRecord(answer, c.primaryParities[hitId])
+	if c.checksummed && !validChecksum(answer) {
+		return nil, ErrIntegrity
+	}
+
+	c.recordCache[clientQuery.index] = answer
+	// also mark the index in the hint state, so that its QueryIndex and TryRandomQuery skip it; the value is
+	// never read, since the hint state is not exposed
+	c.hints.localCache[clientQuery.index] = 0
+
+	backupId := c.hints.refreshHint(clientQuery)
+	c.primaryParities[hitId] = append(Record{}, c.backupParities[backupId]...)
+	xorRecord(c.primaryParities[hitId], answer)
+
+	return answer, nil
+}
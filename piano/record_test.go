@@ -0,0 +1,87 @@
+package piano
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRecordRetrieval(t *testing.T) {
+	server := NewRecordServer(10000, 256)
+	client := NewClient(server.DBSize)
+	state := client.InitializeRecordState(server)
+
+	recovered := 0
+	for q := 0; q < 200; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+		if err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		if !bytes.Equal(answer, server.Query(query.Index())) {
+			t.Fatalf("index %d: got %x, want %x", query.Index(), answer, server.Query(query.Index()))
+		}
+		recovered++
+	}
+	if recovered == 0 {
+		t.Fatalf("no query was recovered")
+	}
+
+	// a retrieved record is cached as a record, not as the marker of the hint state
+	for x := range state.recordCache {
+		if record, ok := state.Cached(x); !ok || !bytes.Equal(record, server.Query(x)) {
+			t.Fatalf("Cached(%d): got %x, %v, want %x", x, record, ok, server.Query(x))
+		}
+		if _, err := state.QueryIndex(x); !errors.Is(err, ErrAlreadyCached) {
+			t.Fatalf("QueryIndex(%d) of a cached record: got %v, want ErrAlreadyCached", x, err)
+		}
+		break
+	}
+	if _, ok := state.Cached(server.DBSize); ok {
+		t.Fatalf("Cached(%d) of a record that was never retrieved", server.DBSize)
+	}
+}
+
+func TestRecordChecksum(t *testing.T) {
+	server := NewRecordServerWithChecksum(10000, 16)
+	if server.RecordSize != 16+ChecksumSize {
+		t.Fatalf("got record size %d, want %d", server.RecordSize, 16+ChecksumSize)
+	}
+	state := NewClient(server.DBSize).InitializeRecordState(server)
+
+	for q := 0; q < 20; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		parities := server.Process(query.Prepare())
+
+		// a flipped bit in the parity of the queried chunk is detected, and the state is left unchanged
+		corrupted := make([]Record, len(parities))
+		for i := range parities {
+			corrupted[i] = append(Record{}, parities[i]...)
+		}
+		corrupted[query.chunkId][q%16] ^= 1 << (q % 8)
+		if _, err := state.RecoverAnswer(query, corrupted); err != ErrIntegrity {
+			t.Fatalf("RecoverAnswer with a flipped bit: got %v, want ErrIntegrity", err)
+		}
+
+		answer, err := state.RecoverAnswer(query, parities)
+		if err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		if !bytes.Equal(answer, server.Query(query.Index())) {
+			t.Fatalf("index %d: got %x, want %x", query.Index(), answer, server.Query(query.Index()))
+		}
+	}
+}
+
+func TestDefaultRecordSize(t *testing.T) {
+	server := NewRecordServer(10000, DefaultRecordSize)
+	if uint64(len(server.Query(0))) != DefaultRecordSize {
+		t.Fatalf("got record size %d, want %d", len(server.Query(0)), DefaultRecordSize)
+	}
+}
@@ -0,0 +1,19 @@
+package piano
+
+// RecordingServer wraps a PIRServer and keeps a copy of every offset vector sent to Process, so tests can
+// inspect exactly what the server sees.
+type RecordingServer struct {
+	PIRServer
+	Requests [][]uint64
+}
+
+// NewRecordingServer returns a RecordingServer forwarding to s.
+func NewRecordingServer(s PIRServer) *RecordingServer {
+	return &RecordingServer{PIRServer: s}
+}
+
+// Process records offsetVec and forwards it.
+func (r *RecordingServer) Process(offsetVec []uint64) []uint64 {
+	r.Requests = append(r.Requests, append([]uint64(nil), offsetVec...))
+	return r.PIRServer.Process(offsetVec)
+}
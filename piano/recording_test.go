@@ -0,0 +1,47 @@
+package piano
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordingServer(t *testing.T) {
+	server := NewServer(10000)
+	state := NewClient(server.DBSize).InitializeState(server)
+	srv := NewRecordingServer(server)
+
+	for _, x := range []uint64{0, 4242, 9999} {
+		query, err := state.QueryIndex(x)
+		if err != nil {
+			t.Fatalf("QueryIndex(%d): %v", x, err)
+		}
+		want := query.Prepare()
+		parities := srv.Process(query.Prepare())
+		if !query.IsDummy() {
+			if _, err := state.RecoverAnswer(query, parities); err != nil {
+				t.Fatalf("RecoverAnswer(%d): %v", x, err)
+			}
+		}
+
+		got := srv.Requests[len(srv.Requests)-1]
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("index %d: the server saw %v, want %v", x, got, want)
+		}
+		// the server only sees offsets of the other chunks, never one pointing at x
+		if uint64(len(got)) != server.ChunkNum-1 {
+			t.Fatalf("index %d: the server saw %d offsets, want %d", x, len(got), server.ChunkNum-1)
+		}
+		for _, offset := range got {
+			if offset >= server.ChunkSize {
+				t.Fatalf("index %d: offset %d out of range", x, offset)
+			}
+		}
+	}
+
+	if _, err := state.Retrieve(1234, srv); err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	if len(srv.Requests) < 4 {
+		t.Fatalf("Retrieve did not go through the RecordingServer")
+	}
+}
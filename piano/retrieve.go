@@ -0,0 +1,30 @@
+package piano
+
+// RetrieveResult is the outcome of retrieving one index.
+type RetrieveResult struct {
+	Index uint64
+	Value uint64
+	Err   error // the error of Retrieve, Value is meaningless if it is set
+}
+
+// RetrieveStream retrieves indices from srv one by one with Retrieve and sends a RetrieveResult for each, in
+// order, on the returned channel, which is closed after the last one. A failed index does not stop the others.
+// Results are produced as the channel is drained, so only one is held at a time; the caller must drain it.
+// The state is in use until the channel is closed and must not be used otherwise meanwhile. An index out of
+// range fails the whole call before anything is sent to srv.
+func (c *ClientState) RetrieveStream(indices []uint64, srv PIRServer) (<-chan RetrieveResult, error) {
+	for _, x := range indices {
+		if _, err := c.localIndex(x); err != nil {
+			return nil, err
+		}
+	}
+	results := make(chan RetrieveResult)
+	go func() {
+		defer close(results)
+		for _, x := range indices {
+			value, err := c.Retrieve(x, srv)
+			results <- RetrieveResult{Index: x, Value: value, Err: err}
+		}
+	}()
+	return results, nil
+}
@@ -0,0 +1,112 @@
+package piano
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRetrieveStream(t *testing.T) {
+	server := NewServerWithSeed(40000, 1)
+	client := NewClient(server.DBSize)
+	rng := rand.New(rand.NewSource(3))
+	indices := make([]uint64, 1000)
+	for i := range indices {
+		indices[i] = rng.Uint64() % server.DBSize
+	}
+	// a few repeats, served from the cache
+	copy(indices[900:], indices[:100])
+
+	state := client.InitializeStateWithSeed(server, 2)
+	results, err := state.RetrieveStream(indices, server)
+	if err != nil {
+		t.Fatalf("RetrieveStream: %v", err)
+	}
+	n := 0
+	for result := range results {
+		if result.Index != indices[n] {
+			t.Fatalf("result %d is for index %d, want %d", n, result.Index, indices[n])
+		}
+		if result.Err != nil {
+			t.Fatalf("index %d: %v", result.Index, result.Err)
+		}
+		if result.Value != server.Query(result.Index) {
+			t.Fatalf("index %d: got %d, want %d", result.Index, result.Value, server.Query(result.Index))
+		}
+		n++
+	}
+	if n != len(indices) {
+		t.Fatalf("got %d results, want %d", n, len(indices))
+	}
+	if _, ok := <-results; ok {
+		t.Fatalf("the channel is still open")
+	}
+
+	// the same hints are consumed as by Retrieve one by one
+	sequential := client.InitializeStateWithSeed(server, 2)
+	for _, x := range indices {
+		if _, err := sequential.Retrieve(x, server); err != nil {
+			t.Fatalf("Retrieve(%d): %v", x, err)
+		}
+	}
+	if !reflect.DeepEqual(state.consumedHintNum, sequential.consumedHintNum) {
+		t.Fatalf("RetrieveStream and Retrieve consumed different backup hints")
+	}
+
+	if _, err := state.RetrieveStream([]uint64{0, server.DBSize}, server); err == nil {
+		t.Fatalf("RetrieveStream: expected an error for an out of range index")
+	}
+}
+
+func TestRetrieveResults(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	state := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+	rng := rand.New(rand.NewSource(4))
+	indices := make([]uint64, 200)
+	for i := range indices {
+		indices[i] = rng.Uint64() % server.DBSize
+	}
+	// repeats, and an index out of range in the middle
+	copy(indices[150:], indices[:20])
+	indices[100] = server.DBSize
+
+	check := func(name string, results []RetrieveResult, want []uint64) {
+		if len(results) != len(want) {
+			t.Fatalf("%s: %d results for %d indices", name, len(results), len(want))
+		}
+		for k, result := range results {
+			if result.Index != want[k] {
+				t.Fatalf("%s: result %d is for index %d, want %d", name, k, result.Index, want[k])
+			}
+			if result.Index >= server.DBSize {
+				if result.Err == nil {
+					t.Fatalf("%s: no error for index %d out of range", name, result.Index)
+				}
+				continue
+			}
+			if result.Err != nil || result.Value != server.Query(result.Index) {
+				t.Fatalf("%s: index %d: got %d, %v, want %d", name, result.Index, result.Value, result.Err, server.Query(result.Index))
+			}
+		}
+	}
+	check("PipelinedRetrieveResults", state.PipelinedRetrieveResults(indices, server, 8), indices)
+
+	// a batch of queries of distinct primary hints, in a shuffled order
+	var queries []ClientQuery
+	var batch []uint64
+	used := make(map[uint64]bool)
+	for len(queries) < 20 {
+		query := state.RandomQuery()
+		if used[query.hitId] {
+			continue
+		}
+		used[query.hitId] = true
+		queries = append(queries, query)
+		batch = append(batch, query.Index())
+	}
+	rng.Shuffle(len(queries), func(i, j int) {
+		queries[i], queries[j] = queries[j], queries[i]
+		batch[i], batch[j] = batch[j], batch[i]
+	})
+	check("RecoverBatchResults", state.RecoverBatchResults(queries, server.ProcessBatch(state.PrepareBatch(queries))), batch)
+}
@@ -0,0 +1,95 @@
+package piano
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// In the robust mode the client keeps R independent hint sets, the replicas, and every query is made once per
+// replica. The R answers are majority-voted, so up to (R-1)/2 wrong responses, e.g. from malicious servers that
+// each answer one replica, are outvoted. It costs R times the client storage and the traffic of a query.
+
+// RobustClientState is the client state of the robust mode.
+type RobustClientState struct {
+	Replicas []*ClientState
+}
+
+// RobustQuery is a query in flight in the robust mode, one ClientQuery per replica.
+type RobustQuery struct {
+	Queries []ClientQuery
+}
+
+// InitializeRobustState runs the setup phase of R replicas with independently sampled hints against s.
+func (c Client) InitializeRobustState(s Server, R int) (*RobustClientState, error) {
+	if R <= 0 {
+		return nil, fmt.Errorf("the number of replicas must be positive, got %d", R)
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	state := &RobustClientState{make([]*ClientState, R)}
+	for r := range state.Replicas {
+		state.Replicas[r] = c.InitializeStateWithSeed(s, rng.Int63())
+	}
+	return state, nil
+}
+
+// QueryIndex builds the query of x in every replica. A replica where no primary hint contains x gets a dummy
+// query, which is sent like the others but does not vote.
+func (c *RobustClientState) QueryIndex(x uint64) (RobustQuery, error) {
+	query := RobustQuery{make([]ClientQuery, len(c.Replicas))}
+	for r, replica := range c.Replicas {
+		q, err := replica.QueryIndex(x)
+		if err != nil {
+			return RobustQuery{}, fmt.Errorf("replica %d: %w", r, err)
+		}
+		query.Queries[r] = q
+	}
+	return query, nil
+}
+
+// Prepare returns the punctured offset vectors that are sent to the server, one per replica.
+func (q RobustQuery) Prepare() [][]uint64 {
+	offsetVecs := make([][]uint64, len(q.Queries))
+	for r, query := range q.Queries {
+		offsetVecs[r] = query.Prepare()
+	}
+	return offsetVecs
+}
+
+// RecoverAnswerRobust recovers the answer in every replica from its parities and returns the value more than
+// half of the replicas agree on. The replicas that recovered a different value are corrected, so their
+// refreshed hint and local cache hold the agreed value. Without such a majority it returns ErrInconsistent;
+// the replicas have then consumed their hints like after any other query.
+func (c *RobustClientState) RecoverAnswerRobust(query RobustQuery, parities [][]uint64) (uint64, error) {
+	if len(query.Queries) != len(c.Replicas) || len(parities) != len(c.Replicas) {
+		return 0, fmt.Errorf("%d queries and %d responses for %d replicas: %w",
+			len(query.Queries), len(parities), len(c.Replicas), ErrMalformedResponse)
+	}
+
+	answers := make([]uint64, len(c.Replicas))
+	recovered := make([]bool, len(c.Replicas))
+	votes := make(map[uint64]int)
+	for r, replica := range c.Replicas {
+		answer, err := replica.RecoverAnswer(query.Queries[r], parities[r])
+		if err != nil {
+			// a replica that cannot recover does not vote
+			continue
+		}
+		answers[r], recovered[r] = answer, true
+		votes[answer]++
+	}
+
+	for agreed, n := range votes {
+		if 2*n <= len(c.Replicas) {
+			continue
+		}
+		for r, replica := range c.Replicas {
+			if recovered[r] && answers[r] != agreed {
+				replica.primaryHints[query.Queries[r].hitId].parity ^= answers[r] ^ agreed
+				replica.cachePut(query.Queries[r].index, agreed)
+			}
+		}
+		return agreed, nil
+	}
+	return 0, ErrInconsistent
+}
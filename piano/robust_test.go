@@ -0,0 +1,71 @@
+package piano
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRecoverAnswerRobust(t *testing.T) {
+	server := NewServer(10000)
+	state, err := NewClient(server.DBSize).InitializeRobustState(server, 3)
+	if err != nil {
+		t.Fatalf("InitializeRobustState: %v", err)
+	}
+	honest := func(query RobustQuery) [][]uint64 {
+		parities := make([][]uint64, len(query.Queries))
+		for r, offsetVec := range query.Prepare() {
+			parities[r] = server.Process(offsetVec)
+		}
+		return parities
+	}
+
+	for q, x := range []uint64{1, 2, 3, 5000, 9999} {
+		query, err := state.QueryIndex(x)
+		if err != nil {
+			t.Fatalf("QueryIndex: %v", err)
+		}
+		parities := honest(query)
+		// a malicious server flips the response of one replica
+		bad := q % 3
+		for i := range parities[bad] {
+			parities[bad][i] ^= 0xdead
+		}
+		answer, err := state.RecoverAnswerRobust(query, parities)
+		if err != nil {
+			t.Fatalf("index %d: RecoverAnswerRobust: %v", x, err)
+		}
+		if answer != server.Query(x) {
+			t.Fatalf("index %d: got %d, want %d", x, answer, server.Query(x))
+		}
+		// the corrupted replica was corrected
+		if cached, ok := state.Replicas[bad].Cached(x); !ok || cached != server.Query(x) {
+			t.Fatalf("index %d: the corrupted replica cached %d, want %d", x, cached, server.Query(x))
+		}
+	}
+
+	// later queries of the same chunks still give the right answers
+	for _, x := range []uint64{4, 5001, 9998} {
+		query, err := state.QueryIndex(x)
+		if err != nil {
+			t.Fatalf("QueryIndex: %v", err)
+		}
+		if answer, err := state.RecoverAnswerRobust(query, honest(query)); err != nil || answer != server.Query(x) {
+			t.Fatalf("index %d: got %d, %v, want %d", x, answer, err, server.Query(x))
+		}
+	}
+
+	// two of three corrupted replicas that disagree
+	query, err := state.QueryIndex(6000)
+	if err != nil {
+		t.Fatalf("QueryIndex: %v", err)
+	}
+	parities := honest(query)
+	for r := 0; r < 2; r++ {
+		for i := range parities[r] {
+			parities[r][i] ^= uint64(r + 1)
+		}
+	}
+	if _, err := state.RecoverAnswerRobust(query, parities); !errors.Is(err, ErrInconsistent) {
+		t.Fatalf("two corrupted replicas: got %v, want ErrInconsistent", err)
+	}
+}
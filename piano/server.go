@@ -0,0 +1,618 @@
+package piano
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+
+	"example.com/util"
+)
+
+// Server holds the public database and the chunking parameters.
+// Query, Process and the other methods that only read the database are safe for concurrent use by many
+// clients, each with its own ClientState. Update and Append write the database and must not run concurrently with them.
+type Server struct {
+	DB        []uint64
+	DBSize    uint64
+	ChunkSize uint64
+	ChunkNum  uint64
+	Version   uint64 // counts the writes to the database, see Update and Append
+
+	// Boundaries are the chunk boundaries of NewServerWithBoundaries: chunk i holds DB[Boundaries[i]:Boundaries[i+1]].
+	// They are nil for chunks of ChunkSize entries.
+	Boundaries []uint64
+
+	logger Logger         // see SetLogger, not encoded
+	timing *processTiming // see ProcessTimed, allocated by the constructors and shared by the copies, not encoded
+}
+
+// processTiming aggregates the durations measured by Server.ProcessTimed.
+type processTiming struct {
+	mu    sync.Mutex
+	calls int64
+	total time.Duration
+}
+
+// PIRServer is the part of a server the client talks to after the setup phase. Server implements it, and so does
+// a remote server or a wrapper such as RecordingServer.
+type PIRServer interface {
+	// Process answers a punctured offset vector with the ChunkNum possible parities.
+	Process(offsetVec []uint64) []uint64
+	// Query returns the x-th entry; this is the non-private baseline.
+	Query(x uint64) uint64
+}
+
+// chunkParams returns ChunkSize and ChunkNum for a database with DBSize entries.
+func chunkParams(DBSize uint64) (uint64, uint64) {
+	if DBSize == 0 {
+		return 0, 0
+	}
+	ChunkSize := uint64(math.Sqrt(float64(DBSize)))
+	ChunkNum := uint64(math.Ceil(float64(DBSize) / float64(ChunkSize)))
+	return ChunkSize, ChunkNum
+}
+
+// mustChunkParams is chunkParams for the constructors without an error: it panics with ErrEmptyDatabase if
+// DBSize is 0.
+func mustChunkParams(DBSize uint64) (uint64, uint64) {
+	if DBSize == 0 {
+		panic(fmt.Errorf("piano: new server: %w", ErrEmptyDatabase))
+	}
+	return chunkParams(DBSize)
+}
+
+// newPaddedServer allocates a Server for DBSize entries with the default chunking.
+// The DB is padded to ChunkSize*ChunkNum, the padding part is all 0.
+// It panics with ErrEmptyDatabase if DBSize is 0.
+func newPaddedServer(DBSize uint64) Server {
+	ChunkSize, _ := mustChunkParams(DBSize)
+	return newPaddedServerWithChunkSize(DBSize, ChunkSize)
+}
+
+func newPaddedServerWithChunkSize(DBSize uint64, ChunkSize uint64) Server {
+	ChunkNum := (DBSize + ChunkSize - 1) / ChunkSize
+	return Server{DB: make([]uint64, ChunkSize*ChunkNum), DBSize: DBSize, ChunkSize: ChunkSize, ChunkNum: ChunkNum,
+		timing: &processTiming{}}
+}
+
+// NewServer generates a random database with DBSize entries.
+// DBSize does not have to be a perfect square; the last chunk is padded with zero entries. It panics with
+// ErrEmptyDatabase if DBSize is 0. NewServerFromData does too for empty data.
+func NewServer(DBSize uint64) Server {
+	return NewServerWithSeed(DBSize, time.Now().UnixNano())
+}
+
+// NewServerWithSeed is like NewServer, but the database is generated from seed.
+func NewServerWithSeed(DBSize uint64, seed int64) Server {
+	s := newPaddedServer(DBSize)
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < int(DBSize); i++ {
+		s.DB[i] = rng.Uint64()
+	}
+	return s
+}
+
+// NewServerPRG is like NewServerWithSeed, but entry i is util.PRFEvalSHA256(key, i) for the key holding seed in
+// little-endian order in its first 8 bytes and zeros after. The database then depends on nothing but dbSize and
+// seed, not on the math/rand generator or the AES instructions of the machine, so a single seed reproduces it
+// anywhere, and any entry can be recomputed on its own.
+func NewServerPRG(dbSize uint64, seed int64) Server {
+	s := newPaddedServer(dbSize)
+	var key util.PrfKey
+	binary.LittleEndian.PutUint64(key[:8], uint64(seed))
+	for i := uint64(0); i < dbSize; i++ {
+		s.DB[i] = util.PRFEvalSHA256(&key, i)
+	}
+	return s
+}
+
+// NewServerWithParams is like NewServer, but with a given chunkSize instead of sqrt(DBSize).
+// A larger chunk means fewer chunks, so smaller queries and less server work per query, but each
+// primary hint then hits a given index with probability 1/chunkSize, so the client needs
+// proportionally more primary hints (M1) to keep the ErrNoHint probability at the same level.
+func NewServerWithParams(DBSize uint64, chunkSize uint64) (Server, error) {
+	if DBSize == 0 {
+		return Server{}, fmt.Errorf("new server: %w", ErrEmptyDatabase)
+	}
+	if chunkSize == 0 || chunkSize > DBSize {
+		return Server{}, fmt.Errorf("chunk size %d out of range for DBSize %d", chunkSize, DBSize)
+	}
+	s := newPaddedServerWithChunkSize(DBSize, chunkSize)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := uint64(0); i < DBSize; i++ {
+		s.DB[i] = rng.Uint64()
+	}
+	return s, nil
+}
+
+// NewServerFromData builds a Server holding a copy of data.
+func NewServerFromData(data []uint64) Server {
+	s := newPaddedServer(uint64(len(data)))
+	copy(s.DB, data)
+	return s
+}
+
+// NewServerFromReader builds a Server from dbSize entries read from r, each 8 bytes in little-endian order.
+func NewServerFromReader(r io.Reader, dbSize uint64) (Server, error) {
+	return NewServerFromReaderWithEncoding(r, dbSize, binary.LittleEndian, 8)
+}
+
+// NewServerFromReaderWithEncoding is like NewServerFromReader, but every entry is width bytes in the given
+// byte order. width is 1, 2, 4 or 8; narrower entries are zero-extended to 64 bits.
+func NewServerFromReaderWithEncoding(r io.Reader, dbSize uint64, order binary.ByteOrder, width int) (Server, error) {
+	var decode func([]byte) uint64
+	switch width {
+	case 1:
+		decode = func(b []byte) uint64 { return uint64(b[0]) }
+	case 2:
+		decode = func(b []byte) uint64 { return uint64(order.Uint16(b)) }
+	case 4:
+		decode = func(b []byte) uint64 { return uint64(order.Uint32(b)) }
+	case 8:
+		decode = order.Uint64
+	default:
+		return Server{}, fmt.Errorf("entry width %d not supported, want 1, 2, 4 or 8", width)
+	}
+	if dbSize == 0 {
+		return Server{}, fmt.Errorf("new server: %w", ErrEmptyDatabase)
+	}
+
+	s := newPaddedServer(dbSize)
+	reader := bufio.NewReader(r)
+	buf := make([]byte, width)
+	for i := uint64(0); i < dbSize; i++ {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return Server{}, fmt.Errorf("reading entry %d: %w", i, err)
+		}
+		s.DB[i] = decode(buf)
+	}
+	return s, nil
+}
+
+// Window returns a Server holding a copy of the entries [start, end) with the default chunking for end-start
+// entries. It answers the queries of a client from NewClientForRange.
+func (s Server) Window(start, end uint64) (Server, error) {
+	if start >= end || end > s.DBSize {
+		return Server{}, fmt.Errorf("window [%d, %d) out of range, DBSize is %d", start, end, s.DBSize)
+	}
+	w := newPaddedServer(end - start)
+	copy(w.DB, s.DB[start:end])
+	w.Version = s.Version
+	w.logger = s.logger
+	return w, nil
+}
+
+// EstimateServerMemory returns the approximate number of bytes of the Server, which is dominated by the
+// padded database.
+func (s Server) EstimateServerMemory() uint64 {
+	return 8*uint64(len(s.DB)) + uint64(unsafe.Sizeof(s))
+}
+
+// Locate returns the chunk of index and its offset within the chunk. It does not check that index is below DBSize.
+func (s Server) Locate(index uint64) (chunkId, offset uint64) {
+	chunkId = chunkOf(s.Boundaries, s.ChunkSize, index)
+	return chunkId, index - chunkStart(s.Boundaries, s.ChunkSize, chunkId)
+}
+
+// Index is the inverse of Locate: it returns the index at offset in the chunkId-th chunk.
+func (s Server) Index(chunkId, offset uint64) uint64 {
+	return chunkStart(s.Boundaries, s.ChunkSize, chunkId) + offset
+}
+
+// Query returns the x-th entry of the database. This is the non-private baseline.
+func (s Server) Query(x uint64) uint64 {
+	return s.DB[x]
+}
+
+func (s Server) possibleParities(offsetVec []uint64) []uint64 {
+	parities := make([]uint64, s.ChunkNum)
+	s.possibleParitiesInto(offsetVec, parities)
+	return parities
+}
+
+func (s Server) possibleParitiesInto(offsetVec []uint64, parities []uint64) {
+	// Given a punctured offset, it first guesses the position of the punctured entry,
+	// then it computes the possible parities.
+	// A single chunk is always the punctured one: the offset vector is empty and the only parity is 0, so the
+	// answer is the parity of the hint, which holds the queried entry alone.
+	if s.Boundaries != nil {
+		s.possibleParitiesVariable(offsetVec, parities)
+		return
+	}
+	parities[0] = 0
+	for i := uint64(0); i < s.ChunkNum-1; i++ {
+		xi := (i+1)*s.ChunkSize + offsetVec[i]
+		parities[0] ^= s.DB[xi]
+	}
+	for i := uint64(0); i < s.ChunkNum-1; i++ {
+		parities[i+1] = parities[i] ^ s.DB[(i+1)*s.ChunkSize+offsetVec[i]] ^ s.DB[i*s.ChunkSize+offsetVec[i]]
+	}
+}
+
+// possibleParitiesVariable is possibleParitiesInto for chunks of the sizes of Boundaries, where every offset
+// is taken modulo the size of the chunk it is read from.
+func (s Server) possibleParitiesVariable(offsetVec []uint64, parities []uint64) {
+	parities[0] = 0
+	for i := uint64(0); i < s.ChunkNum-1; i++ {
+		parities[0] ^= s.entry(i+1, offsetVec[i])
+	}
+	for i := uint64(0); i < s.ChunkNum-1; i++ {
+		parities[i+1] = parities[i] ^ s.entry(i+1, offsetVec[i]) ^ s.entry(i, offsetVec[i])
+	}
+}
+
+// Process answers a punctured offset vector with the ChunkNum possible parities.
+// The vector is either unpacked from Prepare or packed from ClientState.PreparePacked; a packed vector is shorter
+// than the ChunkNum-1 offsets it holds, except for a single offset, where both forms are the same.
+// A malformed vector, see CheckOffsetVec, is answered with no parities, which the client rejects with
+// ErrMalformedResponse; ProcessChecked returns the error instead.
+func (s Server) Process(offsetVec []uint64) []uint64 {
+	parities, err := s.ProcessChecked(offsetVec)
+	if err != nil {
+		s.logf("piano: Process: %v", err)
+		return nil
+	}
+	return parities
+}
+
+// ProcessChecked is like Process, but returns the error of CheckOffsetVec for a malformed vector.
+func (s Server) ProcessChecked(offsetVec []uint64) ([]uint64, error) {
+	if err := s.CheckOffsetVec(offsetVec); err != nil {
+		return nil, err
+	}
+	parities := make([]uint64, s.ChunkNum)
+	s.ProcessInto(offsetVec, parities)
+	return parities, nil
+}
+
+// CheckOffsetVec returns an error wrapping ErrMalformedQuery unless offsetVec holds ChunkNum-1 offsets, unpacked
+// or packed, each below ChunkSize. Other vectors would make Process read out of the chunks of the database.
+func (s Server) CheckOffsetVec(offsetVec []uint64) error {
+	_, err := checkOffsets(offsetVec, s.ChunkSize, s.ChunkNum)
+	return err
+}
+
+// checkOffsets is the prologue of every Process variant: it returns offsetVec unpacked, or the error of
+// CheckOffsetVec for a database of chunkNum chunks of chunkSize entries.
+func checkOffsets(offsetVec []uint64, chunkSize, chunkNum uint64) ([]uint64, error) {
+	if chunkNum == 0 {
+		return nil, fmt.Errorf("offset vector for a database without chunks: %w", ErrMalformedQuery)
+	}
+	n := chunkNum - 1
+	width := util.OffsetBits(chunkSize)
+	offsets := offsetVec
+	switch uint64(len(offsetVec)) {
+	case n:
+	case (n*uint64(width) + 63) / 64:
+		offsets = util.UnpackOffsets(offsetVec, width, int(n))
+	default:
+		return nil, fmt.Errorf("got %d offsets, want %d: %w", len(offsetVec), n, ErrMalformedQuery)
+	}
+	for i, offset := range offsets {
+		if offset >= chunkSize {
+			return nil, fmt.Errorf("offset %d is %d, ChunkSize is %d: %w", i, offset, chunkSize, ErrMalformedQuery)
+		}
+	}
+	return offsets, nil
+}
+
+// ProcessVersioned is like Process, but also returns the Version of the database the parities were computed
+// from, which ClientState.RecoverAnswerVersioned checks against the version of the hints.
+func (s Server) ProcessVersioned(offsetVec []uint64) ([]uint64, uint64) {
+	return s.Process(offsetVec), s.Version
+}
+
+// ProcessTimed is like Process, but also returns the time spent computing the parities, without the allocation
+// of the result. AverageProcessTime aggregates the durations of a Server from a constructor or DecodeServer and
+// of all its copies; a Server built as a struct literal has no aggregate. Process itself is not timed. A
+// malformed vector is answered with no parities and is not timed. Like Process, it is safe for concurrent use.
+func (s Server) ProcessTimed(offsetVec []uint64) ([]uint64, time.Duration) {
+	offsetVec, err := checkOffsets(offsetVec, s.ChunkSize, s.ChunkNum)
+	if err != nil {
+		s.logf("piano: ProcessTimed: %v", err)
+		return nil, 0
+	}
+	parities := make([]uint64, s.ChunkNum)
+	start := time.Now()
+	s.ProcessInto(offsetVec, parities)
+	elapsed := time.Since(start)
+
+	if s.timing != nil {
+		s.timing.mu.Lock()
+		s.timing.calls++
+		s.timing.total += elapsed
+		s.timing.mu.Unlock()
+	}
+	return parities, elapsed
+}
+
+// AverageProcessTime returns the mean duration of the ProcessTimed calls so far, or 0 before the first one.
+// Comparing it with ProcessParallel and ProcessFast tells whether they are worth it for the database size.
+func (s Server) AverageProcessTime() time.Duration {
+	if s.timing == nil {
+		return 0
+	}
+	s.timing.mu.Lock()
+	defer s.timing.mu.Unlock()
+	if s.timing.calls == 0 {
+		return 0
+	}
+	return s.timing.total / time.Duration(s.timing.calls)
+}
+
+// ProcessInto is like Process, but writes the parities into out, which must have ChunkNum entries.
+// It does not allocate for an unpacked offset vector. It does not check offsetVec either, see CheckOffsetVec.
+func (s Server) ProcessInto(offsetVec []uint64, out []uint64) {
+	if n := s.ChunkNum - 1; uint64(len(offsetVec)) < n {
+		offsetVec = util.UnpackOffsets(offsetVec, util.OffsetBits(s.ChunkSize), int(n))
+	}
+	s.possibleParitiesInto(offsetVec, out)
+}
+
+// StreamChunks sends the chunks of the database in order, one per send, and closes the channel after the last
+// one. This is the download of the setup phase, see Client.InitializeStateFromStream. The chunks share memory
+// with the database and must not be modified. The receiver has to drain the channel, or the sending goroutine
+// is never released.
+func (s Server) StreamChunks() <-chan []uint64 {
+	ch := make(chan []uint64)
+	go func() {
+		defer close(ch)
+		for i := uint64(0); i < s.ChunkNum; i++ {
+			ch <- s.chunk(i)
+		}
+	}()
+	return ch
+}
+
+// Update sets the index-th entry to newValue and returns the XOR delta between the old and the new value,
+// which clients pass to ClientState.ApplyUpdate. It increments Version. Copies of the Server share the database
+// and see the update, but keep the old Version.
+func (s *Server) Update(index uint64, newValue uint64) (delta uint64) {
+	delta = s.DB[index] ^ newValue
+	s.DB[index] = newValue
+	s.Version++
+	return delta
+}
+
+// Append adds values at the end of the database, at the indices DBSize, DBSize+1 and so on; the existing
+// entries keep their indices. If the values fit into the zero padding of the last chunk the chunking stays and
+// Append returns false: the hints of existing clients stay valid once they ApplyUpdate every appended index
+// with its value as the delta, which also lets them query the appended indices. Otherwise the database is re-chunked for the new DBSize as in NewServer and
+// Append returns true: the existing hints are invalid and the clients must rerun the setup phase.
+// Version grows by the number of values, one for each ApplyUpdate. Copies of the Server made before Append keep
+// the old DBSize and Version. A database with Boundaries has no padding and always gets the default chunking.
+func (s *Server) Append(values []uint64) (rechunked bool) {
+	DBSize := s.DBSize + uint64(len(values))
+	if s.Boundaries != nil || DBSize > s.ChunkSize*s.ChunkNum {
+		grown := newPaddedServer(DBSize)
+		copy(grown.DB, s.DB[:s.DBSize])
+		s.DB, s.ChunkSize, s.ChunkNum, s.Boundaries = grown.DB, grown.ChunkSize, grown.ChunkNum, nil
+		rechunked = true
+	}
+	copy(s.DB[s.DBSize:], values)
+	s.DBSize = DBSize
+	s.Version += uint64(len(values))
+	return rechunked
+}
+
+// ProcessParallel is like Process, but splits the chunks across workers goroutines.
+// If workers is not positive, GOMAXPROCS workers are used. The output is identical to Process, including no
+// parities for a malformed vector. A database with Boundaries is processed by a single goroutine.
+func (s Server) ProcessParallel(offsetVec []uint64, workers int) []uint64 {
+	offsetVec, err := checkOffsets(offsetVec, s.ChunkSize, s.ChunkNum)
+	if err != nil {
+		s.logf("piano: ProcessParallel: %v", err)
+		return nil
+	}
+	n := s.ChunkNum - 1
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if uint64(workers) > n {
+		workers = int(n)
+	}
+	if workers <= 1 || s.Boundaries != nil {
+		return s.possibleParities(offsetVec)
+	}
+
+	// parities[i+1] = parities[i] ^ delta_i. Every worker first computes its part of parities[0] and
+	// the prefix XOR of the deltas within its range of chunks, then the prefixes are shifted by
+	// parities[0] and the deltas of the previous ranges.
+	parities := make([]uint64, s.ChunkNum)
+	base := make([]uint64, workers)
+	delta := make([]uint64, workers)
+	perWorker := (n + uint64(workers) - 1) / uint64(workers)
+	forEachRange := func(f func(w int, start uint64, end uint64)) {
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			start := uint64(w) * perWorker
+			end := start + perWorker
+			if end > n {
+				end = n
+			}
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				f(w, start, end)
+			}(w)
+		}
+		wg.Wait()
+	}
+
+	forEachRange(func(w int, start uint64, end uint64) {
+		for i := start; i < end; i++ {
+			next := s.DB[(i+1)*s.ChunkSize+offsetVec[i]]
+			base[w] ^= next
+			delta[w] ^= next ^ s.DB[i*s.ChunkSize+offsetVec[i]]
+			parities[i+1] = delta[w]
+		}
+	})
+
+	for w := 0; w < workers; w++ {
+		parities[0] ^= base[w]
+	}
+	shift := make([]uint64, workers)
+	prefix := parities[0]
+	for w := 0; w < workers; w++ {
+		shift[w] = prefix
+		prefix ^= delta[w]
+	}
+
+	forEachRange(func(w int, start uint64, end uint64) {
+		for i := start; i < end; i++ {
+			parities[i+1] ^= shift[w]
+		}
+	})
+	return parities
+}
+
+// ProcessBatch answers several punctured offset vectors at once. Like Process, it answers a malformed vector
+// with no parities.
+func (s Server) ProcessBatch(offsetVecs [][]uint64) [][]uint64 {
+	parities := make([][]uint64, len(offsetVecs))
+	for i, offsetVec := range offsetVecs {
+		parities[i] = s.Process(offsetVec)
+	}
+	return parities
+}
+
+// ProcessMany is like ProcessBatch, but reuses the reads of the first offset vector for the others. The vectors
+// of one hint punctured at different chunks, as well as repeated vectors, agree with each other outside the
+// chunks between the punctures; at those positions the base parity XOR and the deltas between the guesses are
+// taken from the first vector, and only the differing positions are read from the database. This pays off for a
+// large database, whose reads miss the CPU caches; for a small one, and for unrelated vectors, which share almost
+// no offsets, the comparisons make it a bit slower than ProcessBatch. The output is identical to ProcessBatch,
+// which answers a malformed vector with no parities.
+func (s Server) ProcessMany(offsetVecs [][]uint64) [][]uint64 {
+	parities := make([][]uint64, len(offsetVecs))
+	n := s.ChunkNum - 1
+	// the unpacked form of every well-formed vector, nil for a malformed one
+	unpacked := make([][]uint64, len(offsetVecs))
+	var ref []uint64
+	for k, offsetVec := range offsetVecs {
+		if err := s.CheckOffsetVec(offsetVec); err != nil {
+			s.logf("piano: ProcessMany: vector %d: %v", k, err)
+			continue
+		}
+		if uint64(len(offsetVec)) != n {
+			offsetVec = util.UnpackOffsets(offsetVec, util.OffsetBits(s.ChunkSize), int(n))
+		}
+		unpacked[k] = offsetVec
+		if ref == nil {
+			ref = offsetVec
+		}
+	}
+	if ref == nil {
+		return parities
+	}
+	// next[i] is the entry of ref[i] in chunk i+1, the one of parities[0], and delta[i] the difference between
+	// the guesses i and i+1
+	next, delta := make([]uint64, n), make([]uint64, n)
+	var base uint64
+	for i := uint64(0); i < n; i++ {
+		next[i] = s.entry(i+1, ref[i])
+		delta[i] = next[i] ^ s.entry(i, ref[i])
+		base ^= next[i]
+	}
+
+	for k, offsetVec := range unpacked {
+		if offsetVec == nil {
+			continue
+		}
+		out := make([]uint64, s.ChunkNum)
+		// out[i+1] is the prefix XOR of the deltas until the base is known
+		b, prefix := base, uint64(0)
+		for i, offset := range offsetVec {
+			d := delta[i]
+			if offset != ref[i] {
+				var x uint64
+				if s.Boundaries == nil {
+					x = s.DB[uint64(i+1)*s.ChunkSize+offset]
+					d = x ^ s.DB[uint64(i)*s.ChunkSize+offset]
+				} else {
+					x = s.entry(uint64(i+1), offset)
+					d = x ^ s.entry(uint64(i), offset)
+				}
+				b ^= next[i] ^ x
+			}
+			prefix ^= d
+			out[i+1] = prefix
+		}
+		for i := range out {
+			out[i] ^= b
+		}
+		parities[k] = out
+	}
+	return parities
+}
+
+// entry returns the entry at offset in the chunkId-th chunk, taking the offset modulo the size of the chunk for
+// a database with Boundaries as possibleParitiesInto does.
+func (s Server) entry(chunkId, offset uint64) uint64 {
+	if s.Boundaries != nil {
+		return s.DB[s.Boundaries[chunkId]+offset%(s.Boundaries[chunkId+1]-s.Boundaries[chunkId])]
+	}
+	return s.DB[chunkId*s.ChunkSize+offset]
+}
+
+// ProcessBatchContext is like ProcessBatch, but stops between offset vectors once ctx is done and returns ctx.Err().
+// A malformed vector returns the error of CheckOffsetVec.
+func (s Server) ProcessBatchContext(ctx context.Context, offsetVecs [][]uint64) ([][]uint64, error) {
+	parities := make([][]uint64, len(offsetVecs))
+	for i, offsetVec := range offsetVecs {
+		if err := ctx.Err(); err != nil {
+			s.logf("piano: batch canceled after %d of %d offset vectors: %v", i, len(offsetVecs), err)
+			return nil, err
+		}
+		answer, err := s.ProcessChecked(offsetVec)
+		if err != nil {
+			return nil, fmt.Errorf("offset vector %d: %w", i, err)
+		}
+		parities[i] = answer
+	}
+	return parities, nil
+}
+
+// Encode writes the database and the chunking parameters to w with encoding/gob.
+func (s Server) Encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// DecodeServer reads a Server written by Encode.
+func DecodeServer(r io.Reader) (Server, error) {
+	var s Server
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return Server{}, err
+	}
+	if err := s.CheckLayout(); err != nil {
+		return Server{}, err
+	}
+	s.timing = &processTiming{}
+	return s, nil
+}
+
+// CheckLayout checks that DB, DBSize, ChunkSize, ChunkNum and Boundaries describe a valid chunking, e.g. for a
+// Server that was decoded or downloaded.
+func (s Server) CheckLayout() error {
+	if s.Boundaries != nil {
+		chunkSize, err := checkBoundaries(s.Boundaries)
+		if err != nil || chunkSize != s.ChunkSize || uint64(len(s.Boundaries)) != s.ChunkNum+1 ||
+			s.Boundaries[s.ChunkNum] != uint64(len(s.DB)) || s.DBSize != uint64(len(s.DB)) {
+			return fmt.Errorf("malformed server: %d entries for DBSize %d and chunk boundaries %v",
+				len(s.DB), s.DBSize, s.Boundaries)
+		}
+	} else if uint64(len(s.DB)) != s.ChunkSize*s.ChunkNum || s.DBSize > uint64(len(s.DB)) {
+		return fmt.Errorf("malformed server: %d entries for DBSize %d, ChunkSize %d, ChunkNum %d",
+			len(s.DB), s.DBSize, s.ChunkSize, s.ChunkNum)
+	}
+	return nil
+}
@@ -0,0 +1,650 @@
+package piano
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/util"
+)
+
+func TestNonSquareDBSize(t *testing.T) {
+	for _, DBSize := range []uint64{9999, 10001, 10007} {
+		server := NewServer(DBSize)
+		if uint64(len(server.DB)) != server.ChunkSize*server.ChunkNum {
+			t.Fatalf("DBSize %d: DB has %d entries, want %d", DBSize, len(server.DB), server.ChunkSize*server.ChunkNum)
+		}
+
+		client := NewClient(DBSize)
+		state := client.InitializeState(server)
+
+		// always include the last entry, which lives in the short chunk
+		indices := []uint64{DBSize - 1}
+		for q := uint64(0); q < 200; q++ {
+			indices = append(indices, state.rng.Uint64()%DBSize)
+		}
+		for _, x := range indices {
+			query, err := state.QueryIndex(x)
+			if err != nil || query.IsDummy() {
+				continue
+			}
+			answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+			if err != nil {
+				t.Fatalf("DBSize %d: RecoverAnswer(%d): %v", DBSize, x, err)
+			}
+			if answer != server.Query(x) {
+				t.Fatalf("DBSize %d: index %d got %d, want %d", DBSize, x, answer, server.Query(x))
+			}
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	server := NewServer(10007)
+	for _, tc := range []struct{ index, chunkId, offset uint64 }{
+		{0, 0, 0},
+		{server.ChunkSize - 1, 0, server.ChunkSize - 1},
+		{server.ChunkSize, 1, 0},
+		{server.ChunkSize + 1, 1, 1},
+		{3*server.ChunkSize - 1, 2, server.ChunkSize - 1},
+		{server.DBSize - 1, server.ChunkNum - 1, (server.DBSize - 1) % server.ChunkSize},
+	} {
+		chunkId, offset := server.Locate(tc.index)
+		if chunkId != tc.chunkId || offset != tc.offset {
+			t.Fatalf("Locate(%d) = %d, %d, want %d, %d", tc.index, chunkId, offset, tc.chunkId, tc.offset)
+		}
+		if got := server.Index(chunkId, offset); got != tc.index {
+			t.Fatalf("Index(%d, %d) = %d, want %d", chunkId, offset, got, tc.index)
+		}
+	}
+	for x := uint64(0); x < server.DBSize; x++ {
+		if server.Index(server.Locate(x)) != x {
+			t.Fatalf("Index(Locate(%d)) = %d", x, server.Index(server.Locate(x)))
+		}
+	}
+}
+
+func TestAppend(t *testing.T) {
+	// 10001 entries are 101 chunks of 100 with 99 entries of padding
+	server := NewServerWithSeed(10001, 1)
+	old := append([]uint64(nil), server.DB[:server.DBSize]...)
+	state := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+
+	values := []uint64{11, 22, 33}
+	if server.Append(values) {
+		t.Fatalf("Append of %d values into the padding re-chunked the database", len(values))
+	}
+	for i, v := range values {
+		state.ApplyUpdate(10001+uint64(i), v)
+	}
+	if state.DBSize != server.DBSize {
+		t.Fatalf("after ApplyUpdate the client has DBSize %d, the server %d", state.DBSize, server.DBSize)
+	}
+	if err := VerifyAgainstPlaintext(state, server, []uint64{0, 5000, 10000, 10001, 10003}); err != nil {
+		t.Fatalf("after ApplyUpdate: %v", err)
+	}
+
+	values = make([]uint64, 500)
+	for i := range values {
+		values[i] = uint64(i) * 7
+	}
+	if !server.Append(values) {
+		t.Fatalf("Append of %d values beyond the padding did not re-chunk the database", len(values))
+	}
+	if server.DBSize != 10504 || server.ChunkSize != 102 || server.ChunkNum != 103 {
+		t.Fatalf("got DBSize %d ChunkSize %d ChunkNum %d, want 10504 102 103", server.DBSize, server.ChunkSize, server.ChunkNum)
+	}
+	for x := range old {
+		if server.Query(uint64(x)) != old[x] {
+			t.Fatalf("index %d: got %d after Append, want %d", x, server.Query(uint64(x)), old[x])
+		}
+	}
+	if server.Query(10002) != 22 || server.Query(10503) != values[499] {
+		t.Fatalf("the appended entries have the wrong values")
+	}
+	for _, x := range server.DB[server.DBSize:] {
+		if x != 0 {
+			t.Fatalf("the padding is not zero")
+		}
+	}
+
+	state = NewClient(server.DBSize).InitializeStateWithSeed(server, 3)
+	if err := VerifyAgainstPlaintext(state, server, []uint64{0, 5000, 10002, 10100, 10503}); err != nil {
+		t.Fatalf("after setup on the enlarged database: %v", err)
+	}
+}
+
+func TestServerEncodeDecode(t *testing.T) {
+	server := NewServer(10001)
+	var buf bytes.Buffer
+	if err := server.Encode(&buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	decoded, err := DecodeServer(&buf)
+	if err != nil {
+		t.Fatalf("DecodeServer: %v", err)
+	}
+	if !reflect.DeepEqual(server, decoded) {
+		t.Fatalf("decoded server differs from the original")
+	}
+
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+	for q := 0; q < 100; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		punctOffsetVec := query.Prepare()
+		parities := decoded.Process(punctOffsetVec)
+		if !reflect.DeepEqual(parities, server.Process(punctOffsetVec)) {
+			t.Fatalf("decoded server gives different parities")
+		}
+		answer, err := state.RecoverAnswer(query, parities)
+		if err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		if answer != server.Query(query.Index()) {
+			t.Fatalf("index %d: got %d, want %d", query.Index(), answer, server.Query(query.Index()))
+		}
+	}
+
+	if _, err := DecodeServer(bytes.NewReader([]byte("not a server"))); err == nil {
+		t.Fatalf("DecodeServer: expected an error for malformed input")
+	}
+}
+
+func TestNewServerFromData(t *testing.T) {
+	data := make([]uint64, 9999)
+	for i := range data {
+		data[i] = uint64(i) * 7
+	}
+	server := NewServerFromData(data)
+	if server.DBSize != uint64(len(data)) {
+		t.Fatalf("got DBSize %d, want %d", server.DBSize, len(data))
+	}
+	ChunkSize, ChunkNum := chunkParams(uint64(len(data)))
+	if server.ChunkSize != ChunkSize || server.ChunkNum != ChunkNum {
+		t.Fatalf("got ChunkSize %d ChunkNum %d, want %d %d", server.ChunkSize, server.ChunkNum, ChunkSize, ChunkNum)
+	}
+
+	raw := make([]byte, 8*len(data))
+	for i, v := range data {
+		binary.LittleEndian.PutUint64(raw[8*i:], v)
+	}
+	fromReader, err := NewServerFromReader(bytes.NewReader(raw), uint64(len(data)))
+	if err != nil {
+		t.Fatalf("NewServerFromReader: %v", err)
+	}
+	if !reflect.DeepEqual(server, fromReader) {
+		t.Fatalf("NewServerFromReader and NewServerFromData differ")
+	}
+	if _, err := NewServerFromReader(bytes.NewReader(raw[:100]), uint64(len(data))); err == nil {
+		t.Fatalf("NewServerFromReader: expected an error for short input")
+	}
+
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+	for q := 0; q < 100; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+		if err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		if answer != data[query.Index()] {
+			t.Fatalf("index %d: got %d, want %d", query.Index(), answer, data[query.Index()])
+		}
+	}
+}
+
+func TestNewServerFromReaderWithEncoding(t *testing.T) {
+	data := make([]uint64, 1000)
+	for i := range data {
+		data[i] = uint64(i) * 1000003 % (1 << 32)
+	}
+	want := NewServerFromData(data)
+
+	for _, width := range []int{4, 8} {
+		var servers []Server
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			raw := make([]byte, width*len(data))
+			for i, v := range data {
+				if width == 4 {
+					order.PutUint32(raw[width*i:], uint32(v))
+				} else {
+					order.PutUint64(raw[width*i:], v)
+				}
+			}
+			server, err := NewServerFromReaderWithEncoding(bytes.NewReader(raw), uint64(len(data)), order, width)
+			if err != nil {
+				t.Fatalf("width %d, %v: %v", width, order, err)
+			}
+			if !reflect.DeepEqual(server, want) {
+				t.Fatalf("width %d, %v: the server differs from NewServerFromData", width, order)
+			}
+			servers = append(servers, server)
+		}
+
+		state := NewClient(want.DBSize).InitializeState(servers[0])
+		for _, x := range []uint64{0, 123, 999} {
+			query, err := state.QueryIndex(x)
+			if err != nil || query.IsDummy() {
+				continue
+			}
+			little := servers[0].Process(query.Prepare())
+			if big := servers[1].Process(query.Prepare()); !reflect.DeepEqual(little, big) {
+				t.Fatalf("width %d, index %d: the byte orders answer differently", width, x)
+			}
+			if answer, err := state.RecoverAnswer(query, little); err != nil || answer != data[x] {
+				t.Fatalf("width %d, index %d: got %d, %v, want %d", width, x, answer, err, data[x])
+			}
+		}
+	}
+
+	if _, err := NewServerFromReaderWithEncoding(bytes.NewReader(nil), 1, binary.LittleEndian, 3); err == nil {
+		t.Fatalf("NewServerFromReaderWithEncoding: expected an error for width 3")
+	}
+}
+
+func randomOffsetVec(s Server, seed int64) []uint64 {
+	rng := rand.New(rand.NewSource(seed))
+	offsetVec := make([]uint64, s.ChunkNum-1)
+	for i := range offsetVec {
+		offsetVec[i] = rng.Uint64() % s.ChunkSize
+	}
+	return offsetVec
+}
+
+func TestProcessParallel(t *testing.T) {
+	for _, DBSize := range []uint64{10007, 1000000} {
+		server := NewServerWithSeed(DBSize, 1)
+		for seed := int64(0); seed < 5; seed++ {
+			offsetVec := randomOffsetVec(server, seed)
+			want := server.Process(offsetVec)
+			for _, workers := range []int{0, 1, 3, 8, 2000} {
+				if got := server.ProcessParallel(offsetVec, workers); !reflect.DeepEqual(got, want) {
+					t.Fatalf("DBSize %d, %d workers: ProcessParallel differs from Process", DBSize, workers)
+				}
+			}
+		}
+	}
+}
+
+// compare with BenchmarkProcess/1000000
+func BenchmarkProcessParallel(b *testing.B) {
+	server := NewServerWithSeed(1000000, 1)
+	offsetVec := randomOffsetVec(server, 2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		server.ProcessParallel(offsetVec, 0)
+	}
+}
+
+func TestProcessFast(t *testing.T) {
+	for _, DBSize := range []uint64{10007, 1000000} {
+		server := NewServerWithSeed(DBSize, 1)
+		precompute := server.BuildPrecompute()
+		for seed := int64(0); seed < 5; seed++ {
+			offsetVec := randomOffsetVec(server, seed)
+			if !reflect.DeepEqual(server.ProcessFast(precompute, offsetVec), server.Process(offsetVec)) {
+				t.Fatalf("DBSize %d: ProcessFast differs from Process", DBSize)
+			}
+		}
+	}
+}
+
+func TestProcessInto(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	offsetVec := randomOffsetVec(server, 2)
+	out := make([]uint64, server.ChunkNum)
+	server.ProcessInto(offsetVec, out)
+	if !reflect.DeepEqual(out, server.Process(offsetVec)) {
+		t.Fatalf("ProcessInto differs from Process")
+	}
+	if allocs := testing.AllocsPerRun(10, func() { server.ProcessInto(offsetVec, out) }); allocs != 0 {
+		t.Fatalf("ProcessInto made %v allocations", allocs)
+	}
+}
+
+func TestConcurrentClients(t *testing.T) {
+	server := NewServer(10000)
+	const clients = 8
+	errs := make(chan error, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			client := NewClient(server.DBSize)
+			state := client.InitializeStateWithSeed(server, seed)
+			indices := make([]uint64, 20)
+			for j := range indices {
+				indices[j] = state.rng.Uint64() % server.DBSize
+			}
+			errs <- VerifyAgainstPlaintext(state, server, indices)
+		}(int64(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("VerifyAgainstPlaintext: %v", err)
+		}
+	}
+}
+
+func TestProcessTimed(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	if server.AverageProcessTime() != 0 {
+		t.Fatalf("AverageProcessTime before ProcessTimed: got %v", server.AverageProcessTime())
+	}
+	offsetVec := randomOffsetVec(server, 2)
+	// the average accumulates over every call so far, not only the last batch
+	var total time.Duration
+	for calls := 1; calls <= 40; calls++ {
+		parities, elapsed := server.ProcessTimed(offsetVec)
+		if elapsed < 0 {
+			t.Fatalf("call %d: ProcessTimed took %v", calls, elapsed)
+		}
+		if !reflect.DeepEqual(parities, server.Process(offsetVec)) {
+			t.Fatalf("call %d: ProcessTimed differs from Process", calls)
+		}
+		total += elapsed
+		if got, want := server.AverageProcessTime(), total/time.Duration(calls); got != want {
+			t.Fatalf("after %d calls: AverageProcessTime() = %v, want %v", calls, got, want)
+		}
+	}
+	if total <= 0 {
+		t.Fatalf("40 calls of ProcessTimed took %v", total)
+	}
+}
+
+func TestProcessTimedConcurrent(t *testing.T) {
+	// run with -race: ProcessTimed must not write the Server that the copies of Process read
+	server := NewServerWithSeed(10000, 1)
+	offsetVec := randomOffsetVec(server, 2)
+	want := server.Process(offsetVec)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				server.ProcessTimed(offsetVec)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if !reflect.DeepEqual(server.Process(offsetVec), want) {
+					t.Errorf("Process differs while ProcessTimed runs")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	copied := server
+	if copied.AverageProcessTime() != server.AverageProcessTime() || server.AverageProcessTime() == 0 {
+		t.Fatalf("copies do not share the aggregate of 200 ProcessTimed calls")
+	}
+	if literal := (Server{DB: server.DB, DBSize: server.DBSize, ChunkSize: server.ChunkSize, ChunkNum: server.ChunkNum}); literal.AverageProcessTime() != 0 {
+		t.Fatalf("a Server literal has an aggregate")
+	}
+}
+
+func TestEmptyDatabase(t *testing.T) {
+	for name, f := range map[string]func(){
+		"NewServer":         func() { NewServer(0) },
+		"NewServerFromData": func() { NewServerFromData(nil) },
+		"NewServer32":       func() { NewServer32(0) },
+		"NewRecordServer":   func() { NewRecordServer(0, DefaultRecordSize) },
+	} {
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, ErrEmptyDatabase) {
+					t.Fatalf("%s: got panic %v, want ErrEmptyDatabase", name, err)
+				}
+			}()
+			f()
+		}()
+	}
+	if _, err := NewServerWithParams(0, 1); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("NewServerWithParams(0, 1): got %v, want ErrEmptyDatabase", err)
+	}
+	if _, _, err := NewServerAutoTuned(0, Metric{ServerCompute: 1}); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("NewServerAutoTuned: got %v, want ErrEmptyDatabase", err)
+	}
+	if _, err := NewServerFromReader(bytes.NewReader(nil), 0); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("NewServerFromReader: got %v, want ErrEmptyDatabase", err)
+	}
+
+	client := NewClient(0)
+	if client.Q == 0 || client.M1 == 0 || client.M2 == 0 {
+		t.Fatalf("NewClient(0) = %+v, want positive parameters", client)
+	}
+	if _, err := client.InitializeStateStreaming(bytes.NewReader(nil), 0); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("InitializeStateStreaming: got %v, want ErrEmptyDatabase", err)
+	}
+	ch := make(chan []uint64)
+	close(ch)
+	if _, err := client.InitializeStateFromStream(ch, 0); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("InitializeStateFromStream: got %v, want ErrEmptyDatabase", err)
+	}
+	if _, err := client.InitializeStateProgressive(ch, 0).Wait(); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("InitializeStateProgressive: got %v, want ErrEmptyDatabase", err)
+	}
+
+	// the zero ClientState has no database either
+	state := &ClientState{}
+	if _, err := state.QueryIndex(0); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("QueryIndex: got %v, want ErrEmptyDatabase", err)
+	}
+	if _, err := state.TryRandomQuery(); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("TryRandomQuery: got %v, want ErrEmptyDatabase", err)
+	}
+	if _, err := state.RandomQueryConstantTime(); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("RandomQueryConstantTime: got %v, want ErrEmptyDatabase", err)
+	}
+	if _, err := state.Retrieve(0, Server{}); !errors.Is(err, ErrEmptyDatabase) {
+		t.Fatalf("Retrieve: got %v, want ErrEmptyDatabase", err)
+	}
+}
+
+func TestSingleChunk(t *testing.T) {
+	large, err := NewServerWithParams(50, 50)
+	if err != nil {
+		t.Fatalf("NewServerWithParams: %v", err)
+	}
+	for _, server := range []Server{NewServerWithSeed(1, 1), large} {
+		if server.ChunkNum != 1 {
+			t.Fatalf("DBSize %d has %d chunks", server.DBSize, server.ChunkNum)
+		}
+		for name, parities := range map[string][]uint64{
+			"Process":         server.Process(nil),
+			"ProcessParallel": server.ProcessParallel(nil, 4),
+			"ProcessFast":     server.ProcessFast(server.BuildPrecompute(), nil),
+		} {
+			if !reflect.DeepEqual(parities, []uint64{0}) {
+				t.Fatalf("DBSize %d: %s = %v, want [0]", server.DBSize, name, parities)
+			}
+		}
+
+		// enough hints that every entry is hit and every one can be queried
+		client, err := NewClientWithParams(server.DBSize, 20*server.DBSize, server.DBSize)
+		if err != nil {
+			t.Fatalf("NewClientWithParams: %v", err)
+		}
+		state := client.InitializeStateWithSeed(server, 2)
+		for x := uint64(0); x < server.DBSize; x++ {
+			query, err := state.QueryIndex(x)
+			if err != nil || query.IsDummy() {
+				t.Fatalf("DBSize %d: QueryIndex(%d): %v, dummy %v", server.DBSize, x, err, query.IsDummy())
+			}
+			if len(query.Prepare()) != 0 {
+				t.Fatalf("DBSize %d: the query of %d sends %d offsets", server.DBSize, x, len(query.Prepare()))
+			}
+			answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+			if err != nil || answer != server.Query(x) {
+				t.Fatalf("DBSize %d: RecoverAnswer(%d) = %d, %v, want %d", server.DBSize, x, answer, err, server.Query(x))
+			}
+		}
+	}
+}
+
+func TestProcessMany(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	variable, err := NewServerWithBoundaries([]uint64{0, 100, 300, 700})
+	if err != nil {
+		t.Fatalf("NewServerWithBoundaries: %v", err)
+	}
+	for _, server := range []Server{server, variable} {
+		full := randomOffsetVec(server, 2)
+		full = append(full, 5)
+		// one hint punctured at every chunk, a repeated vector and unrelated ones
+		var batch [][]uint64
+		for chunkId := uint64(0); chunkId < server.ChunkNum; chunkId++ {
+			batch = append(batch, ClientQuery{offsetVec: full, chunkId: chunkId}.Prepare())
+		}
+		batch = append(batch, batch[1], randomOffsetVec(server, 3), randomOffsetVec(server, 4))
+		if got, want := server.ProcessMany(batch), server.ProcessBatch(batch); !reflect.DeepEqual(got, want) {
+			t.Fatalf("ChunkNum %d: ProcessMany differs from ProcessBatch", server.ChunkNum)
+		}
+	}
+	if got := server.ProcessMany(nil); len(got) != 0 {
+		t.Fatalf("ProcessMany(nil) = %v", got)
+	}
+}
+
+func TestNewServerPRG(t *testing.T) {
+	a, b := NewServerPRG(1000, 7), NewServerPRG(1000, 7)
+	for x := range a.DB {
+		if a.DB[x] != b.DB[x] {
+			t.Fatalf("entry %d differs for the same seed: %d and %d", x, a.DB[x], b.DB[x])
+		}
+	}
+	if c := NewServerPRG(1000, 8); c.DB[0] == a.DB[0] && c.DB[1] == a.DB[1] {
+		t.Fatalf("seeds 7 and 8 give the same database")
+	}
+	// pinned, so that the database is the same on every machine and Go version
+	if a.DB[0] != 13743562003291683236 || a.DB[999] != 13261889096364842299 {
+		t.Fatalf("entries 0 and 999 are %d and %d, want 13743562003291683236 and 13261889096364842299", a.DB[0], a.DB[999])
+	}
+	for x := a.DBSize; x < uint64(len(a.DB)); x++ {
+		if a.DB[x] != 0 {
+			t.Fatalf("padding entry %d is %d, want 0", x, a.DB[x])
+		}
+	}
+}
+
+func TestProcessMalformed(t *testing.T) {
+	server := NewServerWithSeed(1000, 1)
+	n := server.ChunkNum - 1
+	valid := make([]uint64, n)
+	oversized := make([]uint64, n)
+	oversized[n-1] = server.ChunkSize
+	huge := make([]uint64, n)
+	huge[0] = ^uint64(0)
+	for name, offsetVec := range map[string][]uint64{
+		"empty":     {},
+		"short":     valid[:n-2],
+		"long":      append(append([]uint64(nil), valid...), 0),
+		"oversized": oversized,
+		"huge":      huge,
+	} {
+		if _, err := server.ProcessChecked(offsetVec); !errors.Is(err, ErrMalformedQuery) {
+			t.Fatalf("ProcessChecked of the %s vector: got %v, want ErrMalformedQuery", name, err)
+		}
+		if parities := server.Process(offsetVec); parities != nil {
+			t.Fatalf("Process of the %s vector: got %d parities, want none", name, len(parities))
+		}
+		if _, err := server.ProcessBatchContext(context.Background(), [][]uint64{valid, offsetVec}); !errors.Is(err, ErrMalformedQuery) {
+			t.Fatalf("ProcessBatchContext with the %s vector: got %v, want ErrMalformedQuery", name, err)
+		}
+		// the malformed vector first, so that ProcessMany cannot take it as the reference
+		batch := [][]uint64{offsetVec, valid, randomOffsetVec(server, 3), offsetVec}
+		if got, want := server.ProcessMany(batch), server.ProcessBatch(batch); !reflect.DeepEqual(got, want) || got[0] != nil || got[3] != nil {
+			t.Fatalf("ProcessMany with the %s vector: got %v, want %v", name, got, want)
+		}
+	}
+
+	// the packed form of a valid vector is accepted, and a client rejects the answer to a malformed one
+	client := NewClient(server.DBSize)
+	state := client.InitializeStateWithSeed(server, 2)
+	query, err := state.QueryIndex(500)
+	if err != nil || query.IsDummy() {
+		t.Fatalf("QueryIndex: %v", err)
+	}
+	if _, err := server.ProcessChecked(state.PreparePacked(query)); err != nil {
+		t.Fatalf("ProcessChecked of a packed vector: %v", err)
+	}
+	if got, want := server.ProcessMany([][]uint64{state.PreparePacked(query), query.Prepare()}), server.Process(query.Prepare()); !reflect.DeepEqual(got[0], want) || !reflect.DeepEqual(got[1], want) {
+		t.Fatalf("ProcessMany of a packed vector differs from Process")
+	}
+	if _, err := state.RecoverAnswer(query, server.Process(oversized)); !errors.Is(err, ErrMalformedResponse) {
+		t.Fatalf("RecoverAnswer of a malformed query: got %v, want ErrMalformedResponse", err)
+	}
+}
+
+func TestProcessVariantsMalformed(t *testing.T) {
+	server := NewServerWithSeed(1000, 1)
+	precompute := server.BuildPrecompute()
+	sharded, err := NewShardedServer(server, 3)
+	if err != nil {
+		t.Fatalf("NewShardedServer: %v", err)
+	}
+	records, server32 := NewRecordServer(server.DBSize, DefaultRecordSize), NewServer32(server.DBSize)
+	// answers reports whether every entry point answered offsetVec
+	answers := func(offsetVec []uint64) map[string]bool {
+		timed, _ := server.ProcessTimed(offsetVec)
+		return map[string]bool{
+			"ProcessParallel":      server.ProcessParallel(offsetVec, 4) != nil,
+			"ProcessFast":          server.ProcessFast(precompute, offsetVec) != nil,
+			"ProcessTimed":         timed != nil,
+			"ShardedServer":        sharded.Process(offsetVec) != nil,
+			"RecordServer.Process": records.Process(offsetVec) != nil,
+			"Server32.Process":     server32.Process(offsetVec) != nil,
+		}
+	}
+
+	n := server.ChunkNum - 1
+	valid := randomOffsetVec(server, 2)
+	oversized := make([]uint64, n)
+	oversized[n-1] = server.ChunkSize
+	for name, offsetVec := range map[string][]uint64{
+		"empty":     {},
+		"short":     valid[:n-2],
+		"long":      append(append([]uint64(nil), valid...), 0),
+		"oversized": oversized,
+	} {
+		for entry, answered := range answers(offsetVec) {
+			if answered {
+				t.Fatalf("%s answered the %s vector", entry, name)
+			}
+		}
+	}
+
+	// every entry point accepts the packed form
+	packed := util.PackOffsets(valid, util.OffsetBits(server.ChunkSize))
+	for entry, answered := range answers(packed) {
+		if !answered {
+			t.Fatalf("%s did not answer a packed vector", entry)
+		}
+	}
+	if !reflect.DeepEqual(server.ProcessParallel(packed, 4), server.Process(valid)) {
+		t.Fatalf("ProcessParallel of a packed vector differs from Process")
+	}
+	if !reflect.DeepEqual(server.ProcessFast(precompute, packed), server.Process(valid)) {
+		t.Fatalf("ProcessFast of a packed vector differs from Process")
+	}
+}
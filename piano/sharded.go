@@ -0,0 +1,119 @@
+package piano
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ShardedServer answers queries from a database split by chunk ranges across several shards, so that no single
+// machine has to hold the whole database. Shards[i] is a Server holding the chunks FirstChunk[i] to
+// FirstChunk[i]+Shards[i].ChunkNum-1 with the same ChunkSize, and for a Server with Boundaries the part of them
+// of those chunks, shifted to start at 0; the shards are in order and cover all chunks.
+// Process fans out to every shard and XORs their partial parities, which gives exactly the parities of a single
+// Server, so clients use a ShardedServer like any other PIRServer.
+type ShardedServer struct {
+	Shards     []Server
+	FirstChunk []uint64
+	DBSize     uint64
+	ChunkSize  uint64
+	ChunkNum   uint64
+	Boundaries []uint64 // the Boundaries of the sharded Server, if any
+}
+
+var _ PIRServer = (*ShardedServer)(nil)
+
+// NewShardedServer splits the chunks of s into shards shards of nearly equal size. Each shard holds a copy
+// of its part of the database.
+func NewShardedServer(s Server, shards int) (*ShardedServer, error) {
+	if shards <= 0 || uint64(shards) > s.ChunkNum {
+		return nil, fmt.Errorf("%d shards out of range for %d chunks", shards, s.ChunkNum)
+	}
+	sharded := &ShardedServer{DBSize: s.DBSize, ChunkSize: s.ChunkSize, ChunkNum: s.ChunkNum, Boundaries: s.Boundaries}
+	for i := uint64(0); i < uint64(shards); i++ {
+		lo := i * s.ChunkNum / uint64(shards)
+		hi := (i + 1) * s.ChunkNum / uint64(shards)
+		start, end := s.Index(lo, 0), s.Index(hi, 0)
+		shard := Server{
+			DB:        make([]uint64, end-start),
+			DBSize:    end - start,
+			ChunkSize: s.ChunkSize,
+			ChunkNum:  hi - lo,
+		}
+		if s.Boundaries != nil {
+			for _, boundary := range s.Boundaries[lo : hi+1] {
+				shard.Boundaries = append(shard.Boundaries, boundary-start)
+			}
+		}
+		copy(shard.DB, s.DB[start:end])
+		sharded.Shards = append(sharded.Shards, shard)
+		sharded.FirstChunk = append(sharded.FirstChunk, lo)
+	}
+	return sharded, nil
+}
+
+// Query returns the x-th entry of the database from the shard holding it.
+func (s *ShardedServer) Query(x uint64) uint64 {
+	chunkId := chunkOf(s.Boundaries, s.ChunkSize, x)
+	for i := range s.Shards {
+		if chunkId < s.FirstChunk[i]+s.Shards[i].ChunkNum {
+			return s.Shards[i].DB[x-chunkStart(s.Boundaries, s.ChunkSize, s.FirstChunk[i])]
+		}
+	}
+	panic(fmt.Sprintf("index %d is in no shard", x))
+}
+
+// Process answers a punctured offset vector, packed or not, with the ChunkNum possible parities.
+// The shards compute their partial parities concurrently. Like Server.Process, it answers a malformed vector,
+// see Server.CheckOffsetVec, with no parities.
+func (s *ShardedServer) Process(offsetVec []uint64) []uint64 {
+	offsetVec, err := checkOffsets(offsetVec, s.ChunkSize, s.ChunkNum)
+	if err != nil {
+		return nil
+	}
+	partial := make([][]uint64, len(s.Shards))
+	var wg sync.WaitGroup
+	for i := range s.Shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			partial[i] = s.Shards[i].partialParities(offsetVec, s.FirstChunk[i], s.ChunkNum)
+		}(i)
+	}
+	wg.Wait()
+
+	parities := partial[0]
+	for _, p := range partial[1:] {
+		for k := range parities {
+			parities[k] ^= p[k]
+		}
+	}
+	return parities
+}
+
+// partialParities returns the share of the shard s, which holds the chunks starting at firstChunk of a database
+// with ChunkNum chunks, of every possible parity. The k-th parity guesses that chunk k is punctured, so it takes
+// offsetVec[j] from every chunk j < k and offsetVec[j-1] from every chunk j > k.
+func (s Server) partialParities(offsetVec []uint64, firstChunk uint64, ChunkNum uint64) []uint64 {
+	lo, hi := firstChunk, firstChunk+s.ChunkNum
+	entry := func(j uint64, offset uint64) uint64 {
+		return s.entry(j-lo, offset)
+	}
+
+	parities := make([]uint64, ChunkNum)
+	for j := lo; j < hi; j++ {
+		if j > 0 {
+			parities[0] ^= entry(j, offsetVec[j-1])
+		}
+	}
+	// going from guess k to k+1, chunk k starts using offsetVec[k] and chunk k+1 is left out
+	for k := uint64(0); k+1 < ChunkNum; k++ {
+		parities[k+1] = parities[k]
+		if lo <= k && k < hi {
+			parities[k+1] ^= entry(k, offsetVec[k])
+		}
+		if lo <= k+1 && k+1 < hi {
+			parities[k+1] ^= entry(k+1, offsetVec[k])
+		}
+	}
+	return parities
+}
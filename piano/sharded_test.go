@@ -0,0 +1,61 @@
+package piano
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShardedServer(t *testing.T) {
+	for _, DBSize := range []uint64{10000, 10007} {
+		server := NewServerWithSeed(DBSize, 1)
+		sharded, err := NewShardedServer(server, 4)
+		if err != nil {
+			t.Fatalf("NewShardedServer: %v", err)
+		}
+		for seed := int64(0); seed < 5; seed++ {
+			offsetVec := randomOffsetVec(server, seed)
+			if !reflect.DeepEqual(sharded.Process(offsetVec), server.Process(offsetVec)) {
+				t.Fatalf("DBSize %d: the sharded parities differ from Process", DBSize)
+			}
+		}
+
+		state := NewClient(DBSize).InitializeState(server)
+		indices := []uint64{0, DBSize / 2, DBSize - 1}
+		if err := VerifyAgainstPlaintext(state, sharded, indices); err != nil {
+			t.Fatalf("DBSize %d: VerifyAgainstPlaintext: %v", DBSize, err)
+		}
+	}
+
+	// chunks of different sizes are split at their boundaries
+	server, err := NewServerWithBoundaries([]uint64{0, 64, 96, 112, 176, 240, 248})
+	if err != nil {
+		t.Fatalf("NewServerWithBoundaries: %v", err)
+	}
+	sharded, err := NewShardedServer(server, 4)
+	if err != nil {
+		t.Fatalf("NewShardedServer: %v", err)
+	}
+	for x := uint64(0); x < server.DBSize; x++ {
+		if sharded.Query(x) != server.Query(x) {
+			t.Fatalf("boundaries: Query(%d) = %d, want %d", x, sharded.Query(x), server.Query(x))
+		}
+	}
+	for seed := int64(0); seed < 5; seed++ {
+		offsetVec := randomOffsetVec(server, seed)
+		if !reflect.DeepEqual(sharded.Process(offsetVec), server.Process(offsetVec)) {
+			t.Fatalf("boundaries: the sharded parities differ from Process")
+		}
+	}
+	client, err := NewClientWithBoundaries(server.Boundaries)
+	if err != nil {
+		t.Fatalf("NewClientWithBoundaries: %v", err)
+	}
+	state := client.InitializeState(server)
+	if err := VerifyAgainstPlaintext(state, sharded, []uint64{0, 100, server.DBSize - 1}); err != nil {
+		t.Fatalf("boundaries: VerifyAgainstPlaintext: %v", err)
+	}
+
+	if _, err := NewShardedServer(NewServer(100), 11); err == nil {
+		t.Fatalf("NewShardedServer: expected an error for more shards than chunks")
+	}
+}
@@ -0,0 +1,37 @@
+package piano
+
+// Stats counts the communication and computation of a ClientState since SetStatsEnabled(true).
+type Stats struct {
+	Queries       uint64   // queries sent to the server, including dummy ones
+	BytesSent     uint64   // bytes of the punctured offset vectors
+	BytesReceived uint64   // bytes of the parities returned by Process
+	PRFEvals      uint64   // PRF evaluations in Elem
+	HintsConsumed []uint64 // backup hints consumed per chunk
+}
+
+// SetStatsEnabled turns the counters on or off. Turning them on resets them.
+// When they are off, counting costs a branch per Elem call.
+func (c *ClientState) SetStatsEnabled(enabled bool) {
+	c.statsEnabled = enabled
+	c.stats = Stats{}
+	if enabled {
+		c.stats.HintsConsumed = make([]uint64, c.ChunkNum)
+	}
+}
+
+// Stats returns a snapshot of the counters.
+func (c *ClientState) Stats() Stats {
+	snapshot := c.stats
+	snapshot.HintsConsumed = append([]uint64(nil), c.stats.HintsConsumed...)
+	return snapshot
+}
+
+// countExchange counts a query sent to the server and its response.
+func (c *ClientState) countExchange(clientQuery ClientQuery, serverParities []uint64) {
+	if !c.statsEnabled {
+		return
+	}
+	c.stats.Queries++
+	c.stats.BytesSent += 8 * uint64(len(clientQuery.offsetVec)-1)
+	c.stats.BytesReceived += 8 * uint64(len(serverParities))
+}
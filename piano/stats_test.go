@@ -0,0 +1,56 @@
+package piano
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+
+	state.Retrieve(1, server)
+	if stats := state.Stats(); stats.Queries != 0 || stats.PRFEvals != 0 {
+		t.Fatalf("disabled stats counted %+v", stats)
+	}
+
+	state.SetStatsEnabled(true)
+	recovered := uint64(0)
+	for q := 0; q < 50; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		if _, err := state.RecoverAnswer(query, server.Process(query.Prepare())); err == nil {
+			recovered++
+		}
+	}
+
+	stats := state.Stats()
+	if stats.Queries != recovered {
+		t.Fatalf("counted %d queries, want %d", stats.Queries, recovered)
+	}
+	if stats.BytesSent != 8*recovered*(server.ChunkNum-1) || stats.BytesReceived != 8*recovered*server.ChunkNum {
+		t.Fatalf("counted %d bytes sent and %d received for %d queries", stats.BytesSent, stats.BytesReceived, recovered)
+	}
+	consumed := uint64(0)
+	for _, n := range stats.HintsConsumed {
+		consumed += n
+	}
+	if consumed != recovered {
+		t.Fatalf("counted %d consumed hints, want %d", consumed, recovered)
+	}
+	if stats.PRFEvals == 0 {
+		t.Fatalf("no PRF evaluations counted")
+	}
+
+	// the snapshot does not change with later queries
+	before := stats.HintsConsumed[0]
+	if _, err := state.Retrieve(2, server); err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	if stats.HintsConsumed[0] != before || state.Stats().HintsConsumed[0] != before+1 {
+		t.Fatalf("got %d consumed hints in the snapshot and %d now, want %d and %d",
+			stats.HintsConsumed[0], state.Stats().HintsConsumed[0], before, before+1)
+	}
+}
@@ -0,0 +1,73 @@
+package piano
+
+// A setup supports Q queries. In streaming mode the client splits the queries into epochs: once the current
+// epoch is within prefetchThreshold queries of its end, the setup of the next epoch runs in the background
+// against the server. It is switched in as soon as it is ready, replacing all hints and clearing the local
+// cache, so the client never runs out of hints. A query only blocks on the next epoch if the current one
+// is used up before the prefetch finishes.
+
+// streaming is the epoch state of a client in streaming mode.
+type streaming struct {
+	server       Server
+	threshold    uint64
+	epochQueries uint64            // queries recovered in the current epoch
+	next         chan *ClientState // the next epoch's setup, nil if no prefetch is in flight
+}
+
+// EnableStreaming turns on unbounded queries against s, prefetching the next epoch's hints when the current
+// epoch has at most prefetchThreshold queries left. The prefetch reads s in the background, so Server.Update
+// must not be called on s while streaming. Queries made before an epoch switch return ErrStaleQuery.
+func (c *ClientState) EnableStreaming(s Server, prefetchThreshold uint64) {
+	c.streaming = &streaming{server: s, threshold: prefetchThreshold}
+}
+
+// epochRemaining returns how many more queries the current epoch is guaranteed to serve: it ends after
+// Q queries or when the backup hints of any chunk run out.
+func (c *ClientState) epochRemaining() uint64 {
+	var remaining uint64
+	if c.streaming.epochQueries < c.config.Q {
+		remaining = c.config.Q - c.streaming.epochQueries
+	}
+	if r := c.RemainingQueries(); r < remaining {
+		remaining = r
+	}
+	return remaining
+}
+
+// countEpochQuery counts a recovered query and starts the prefetch of the next epoch if it is due.
+func (c *ClientState) countEpochQuery() {
+	if c.streaming == nil {
+		return
+	}
+	c.streaming.epochQueries++
+	if c.streaming.next == nil && c.epochRemaining() <= c.streaming.threshold {
+		next := make(chan *ClientState, 1)
+		config, server, seed := c.config, c.streaming.server, c.rng.Int63()
+		go func() {
+			next <- config.InitializeStateWithSeed(server, seed)
+		}()
+		c.streaming.next = next
+	}
+}
+
+// advanceEpoch switches to the next epoch if its setup is ready, waiting for it if the current epoch is used up.
+func (c *ClientState) advanceEpoch() {
+	if c.streaming == nil || c.streaming.next == nil {
+		return
+	}
+	var next *ClientState
+	if c.epochRemaining() == 0 {
+		next = <-c.streaming.next
+	} else {
+		select {
+		case next = <-c.streaming.next:
+		default:
+			return
+		}
+	}
+
+	c.logf("piano: switching to the next epoch after %d queries", c.streaming.epochQueries)
+	c.replaceHints(next, false)
+	c.streaming.epochQueries = 0
+	c.streaming.next = nil
+}
@@ -0,0 +1,32 @@
+package piano
+
+import "testing"
+
+func TestStreamingSoak(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	client := NewClient(server.DBSize)
+	for name, randomQuery := range map[string]func(*ClientState) (ClientQuery, error){
+		"TryRandomQuery":          (*ClientState).TryRandomQuery,
+		"RandomQueryConstantTime": (*ClientState).RandomQueryConstantTime,
+	} {
+		state := client.InitializeStateWithSeed(server, 2)
+		state.EnableStreaming(server, client.Q/4)
+
+		for q := uint64(0); q < 10*client.Q; q++ {
+			query, err := randomQuery(state)
+			if err == ErrNoHint {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: query %d: %v", name, q, err)
+			}
+			answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+			if err != nil {
+				t.Fatalf("%s: query %d: RecoverAnswer: %v", name, q, err)
+			}
+			if answer != server.Query(query.Index()) {
+				t.Fatalf("%s: query %d: wrong answer for index %d", name, q, query.Index())
+			}
+		}
+	}
+}
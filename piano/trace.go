@@ -0,0 +1,36 @@
+package piano
+
+// QueryTrace records the internal steps of a query, for debugging and bug reports.
+type QueryTrace struct {
+	Index          uint64   `json:"index"`
+	ChunkId        uint64   `json:"chunkId"`
+	HitId          uint64   `json:"hitId"`
+	Dummy          bool     `json:"dummy"`
+	OffsetVec      []uint64 `json:"offsetVec"`
+	PunctOffsetVec []uint64 `json:"punctOffsetVec"`
+	// BackupId is the backup hint that RecoverAnswer would consume, or -1 if the chunk has none left.
+	BackupId int64 `json:"backupId"`
+	// HintParity is the parity of the primary hint, which is XORed with the server's parity of the chunk.
+	HintParity uint64 `json:"hintParity"`
+}
+
+// TraceQuery returns the trace of a query that has not been recovered yet.
+func (c *ClientState) TraceQuery(clientQuery ClientQuery) QueryTrace {
+	trace := QueryTrace{
+		Index:          clientQuery.index,
+		ChunkId:        clientQuery.chunkId,
+		HitId:          clientQuery.hitId,
+		Dummy:          clientQuery.dummy,
+		OffsetVec:      append([]uint64(nil), clientQuery.offsetVec...),
+		PunctOffsetVec: clientQuery.Prepare(),
+		BackupId:       -1,
+	}
+	if clientQuery.dummy {
+		return trace
+	}
+	if c.ChunkHintsRemaining(clientQuery.chunkId) > 0 {
+		trace.BackupId = int64(c.backupStart[clientQuery.chunkId] + c.consumedHintNum[clientQuery.chunkId])
+	}
+	trace.HintParity = c.primaryHints[clientQuery.hitId].parity
+	return trace
+}
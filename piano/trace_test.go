@@ -0,0 +1,44 @@
+package piano
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTraceQuery(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+
+	var query ClientQuery
+	for {
+		var err error
+		if query, err = state.TryRandomQuery(); err == nil {
+			break
+		}
+	}
+	trace := state.TraceQuery(query)
+	if trace.Index != query.Index() || trace.HitId != query.hitId || trace.BackupId != int64(query.chunkId*client.M2) {
+		t.Fatalf("unexpected trace %+v", trace)
+	}
+	if uint64(len(trace.PunctOffsetVec)) != server.ChunkNum-1 {
+		t.Fatalf("punctured vector has %d offsets, want %d", len(trace.PunctOffsetVec), server.ChunkNum-1)
+	}
+	parities := server.Process(trace.PunctOffsetVec)
+	if parities[trace.ChunkId]^trace.HintParity != server.Query(trace.Index) {
+		t.Fatalf("the traced parity does not recover the answer")
+	}
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var decoded QueryTrace
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(trace, decoded) {
+		t.Fatalf("JSON round-trip changed the trace")
+	}
+}
@@ -0,0 +1,93 @@
+package piano
+
+import (
+	"math"
+	"unsafe"
+)
+
+// Metric weighs the costs AutoTuneChunkSize trades against each other. A weight of 0 ignores that cost.
+type Metric struct {
+	ServerCompute float64 // per database entry the server reads to answer a query
+	Bandwidth     float64 // per byte of a query and its response
+	ClientStorage float64 // per byte of hints the client stores
+}
+
+// Cost returns the weighted cost of chunkSize for a database with dbSize entries and the default number of
+// queries Q of NewClient, with the fewest hints that keep both failure probabilities of FailureProbability
+// within what Client.Validate accepts. With chunkSize C and N chunks, a query reads 2(N-1) entries and sends
+// N-1 offsets for N parities, and the client needs about C ln(Q) primary hints and N times a few backup hints.
+func (m Metric) Cost(dbSize, chunkSize uint64) float64 {
+	client := tunedClient(dbSize, chunkSize)
+	chunkNum := (dbSize + chunkSize - 1) / chunkSize
+	compute := float64(2 * (chunkNum - 1))
+	bandwidth := float64(8*(chunkNum-1) + 8*chunkNum)
+	storage := float64((client.M1 + client.M2*chunkNum) * uint64(unsafe.Sizeof(LocalHint{})))
+	return m.ServerCompute*compute + m.Bandwidth*bandwidth + m.ClientStorage*storage
+}
+
+// tunedClient returns the Client with the default Q of NewClient and the smallest M1 and M2 for which the
+// failure probabilities of chunks of chunkSize entries are at most maxFailureProbability.
+func tunedClient(dbSize, chunkSize uint64) Client {
+	Q := NewClient(dbSize).Q
+	chunkNum := (dbSize + chunkSize - 1) / chunkSize
+
+	// Q (1-1/C)^M1 <= p
+	M1 := uint64(1)
+	if chunkSize > 1 {
+		M1 = uint64(math.Ceil(math.Log(maxFailureProbability/float64(Q)) / math.Log1p(-1/float64(chunkSize))))
+	}
+
+	// the chunks are full except maybe the last one, so the exhaustion bound is (chunkNum-1) full tails plus the
+	// last; it decreases in M2 and is large below the mean Q*chunkSize/dbSize, so binary search above that
+	last := dbSize - (chunkNum-1)*chunkSize
+	exhaust := func(M2 uint64) float64 {
+		return float64(chunkNum-1)*binomialTail(Q, float64(chunkSize)/float64(dbSize), M2) +
+			binomialTail(Q, float64(last)/float64(dbSize), M2)
+	}
+	lo, hi := uint64(float64(Q)*float64(chunkSize)/float64(dbSize)), Q
+	if lo < 1 {
+		lo = 1
+	}
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if exhaust(mid) <= maxFailureProbability {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	M2 := lo
+	return Client{Q: Q, M1: M1, M2: M2}
+}
+
+// AutoTuneChunkSize returns the chunk size with the lowest target.Cost for a database with dbSize entries,
+// out of sqrt(dbSize) and a geometric grid of candidates between 1 and dbSize. The default sqrt(dbSize) is
+// close to the optimum when the costs are weighed evenly; a metric dominated by the server compute or the
+// bandwidth favors fewer, larger chunks, one dominated by the client storage smaller ones. It returns 0 for an
+// empty database, which NewServerAutoTuned rejects with ErrEmptyDatabase.
+func AutoTuneChunkSize(dbSize uint64, target Metric) uint64 {
+	if dbSize == 0 {
+		return 0
+	}
+	best, _ := chunkParams(dbSize)
+	bestCost := target.Cost(dbSize, best)
+	for c := 1.0; c <= float64(dbSize); c *= 1.05 {
+		chunkSize := uint64(c)
+		if cost := target.Cost(dbSize, chunkSize); cost < bestCost {
+			best, bestCost = chunkSize, cost
+		}
+	}
+	return best
+}
+
+// NewServerAutoTuned is like NewServer, but with the chunk size of AutoTuneChunkSize for target. It also
+// returns the Client with the hint counts for that chunk size, since the defaults of NewClient assume
+// sqrt(dbSize) entries per chunk.
+func NewServerAutoTuned(dbSize uint64, target Metric) (Server, Client, error) {
+	chunkSize := AutoTuneChunkSize(dbSize, target)
+	server, err := NewServerWithParams(dbSize, chunkSize)
+	if err != nil {
+		return Server{}, Client{}, err
+	}
+	return server, tunedClient(dbSize, chunkSize), nil
+}
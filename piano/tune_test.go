@@ -0,0 +1,45 @@
+package piano
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAutoTuneChunkSize(t *testing.T) {
+	const DBSize = 1000000
+	sqrt, _ := chunkParams(DBSize)
+
+	// the server compute dominates, so fewer chunks are cheaper despite the larger hint table
+	computeHeavy := Metric{ServerCompute: 1000, ClientStorage: 1}
+	tuned := AutoTuneChunkSize(DBSize, computeHeavy)
+	if tuned <= sqrt {
+		t.Fatalf("compute-heavy metric: got chunk size %d, want more than %d", tuned, sqrt)
+	}
+	if computeHeavy.Cost(DBSize, tuned) >= computeHeavy.Cost(DBSize, sqrt) {
+		t.Fatalf("chunk size %d costs %.0f, sqrt %.0f", tuned, computeHeavy.Cost(DBSize, tuned), computeHeavy.Cost(DBSize, sqrt))
+	}
+	if tuned := AutoTuneChunkSize(DBSize, Metric{ClientStorage: 1}); tuned >= sqrt {
+		t.Fatalf("storage-only metric: got chunk size %d, want less than %d", tuned, sqrt)
+	}
+	// evenly weighed, sqrt is not far off
+	even := Metric{ServerCompute: 1, Bandwidth: 1, ClientStorage: 1}
+	if tuned := AutoTuneChunkSize(DBSize, even); math.Abs(math.Log(float64(tuned)/float64(sqrt))) > math.Log(4) {
+		t.Fatalf("even metric: got chunk size %d, sqrt is %d", tuned, sqrt)
+	}
+
+	server, client, err := NewServerAutoTuned(10000, computeHeavy)
+	if err != nil {
+		t.Fatalf("NewServerAutoTuned: %v", err)
+	}
+	if server.ChunkSize != AutoTuneChunkSize(10000, computeHeavy) {
+		t.Fatalf("the server has chunk size %d, want %d", server.ChunkSize, AutoTuneChunkSize(10000, computeHeavy))
+	}
+	noHint, exhaust := FailureProbability(server.DBSize, server.ChunkSize, server.ChunkNum, client.Q, client.M1, client.M2)
+	if noHint > maxFailureProbability || exhaust > maxFailureProbability {
+		t.Fatalf("the tuned client fails with probability %.3g, %.3g", noHint, exhaust)
+	}
+	state := client.InitializeState(server)
+	if err := VerifyAgainstPlaintext(state, server, []uint64{0, 1234, 9999}); err != nil {
+		t.Fatalf("VerifyAgainstPlaintext: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package piano
+
+import (
+	"math/rand"
+	"time"
+
+	"example.com/util"
+)
+
+// In the two-server variant the client keeps only the M1 primary hints. A query is answered by the
+// right server, exactly like the single-server Process. Instead of a stored backup hint, the consumed
+// hint is replaced by a fresh random set whose parity the left server computes from the same punctured
+// offset vector format. Both servers only see uniformly random punctured offset vectors, so the scheme
+// is private as long as the two servers do not collude.
+
+// NewTwoServerSetup generates a random database with DBSize entries and returns the left and the right
+// server holding it.
+func NewTwoServerSetup(DBSize uint64) (Server, Server) {
+	s := NewServer(DBSize)
+	return s, s
+}
+
+// TwoServerClientState is the client state of the two-server variant. It has no backup hints.
+type TwoServerClientState struct {
+	*ClientState
+}
+
+// RefreshQuery asks the left server for the parity of a fresh set punctured at the queried chunk.
+type RefreshQuery struct {
+	chunkId   uint64
+	key       util.PrfKey
+	offsetVec []uint64
+}
+
+// InitializeTwoServerState runs the setup phase against the left server. M2 is ignored.
+func (c Client) InitializeTwoServerState(left Server) *TwoServerClientState {
+	c.M2 = 0
+	c.PerChunkM2 = nil
+	state := c.newClientState(left.DBSize, left.ChunkSize, left.ChunkNum, rand.New(rand.NewSource(time.Now().UnixNano())))
+	state.twoServer = true
+	for i := uint64(0); i < left.ChunkNum; i++ {
+		for j := uint64(0); j < c.M1; j++ {
+			state.primaryHints[j].parity ^= left.Query(state.Elem(&state.primaryHints[j], i))
+		}
+	}
+	return &TwoServerClientState{state}
+}
+
+// PrepareRefresh samples the fresh set that replaces the primary hint consumed by clientQuery.
+func (c *TwoServerClientState) PrepareRefresh(clientQuery ClientQuery) RefreshQuery {
+	hint := LocalHint{key: util.RandKey(c.rng)}
+	offsetVec := make([]uint64, c.ChunkNum)
+	for i := uint64(0); i < c.ChunkNum; i++ {
+		offsetVec[i] = c.Elem(&hint, i) % c.ChunkSize
+	}
+	return RefreshQuery{clientQuery.chunkId, hint.key, offsetVec}
+}
+
+// Prepare returns the punctured offset vector that is sent to the left server.
+func (r RefreshQuery) Prepare() []uint64 {
+	return ClientQuery{chunkId: r.chunkId, offsetVec: r.offsetVec}.Prepare()
+}
+
+// RecoverAnswer recovers the queried entry from the right server's parities and replaces the consumed
+// primary hint with the refreshed set, programmed at the queried index, using the left server's parities.
+// It returns ErrNoHint for a dummy query and ErrStaleQuery if the hint was consumed in the meantime.
+func (c *TwoServerClientState) RecoverAnswer(clientQuery ClientQuery, rightParities []uint64, refresh RefreshQuery, leftParities []uint64) (uint64, error) {
+	if clientQuery.dummy {
+		return 0, ErrNoHint
+	}
+	if uint64(len(rightParities)) != c.ChunkNum || uint64(len(leftParities)) != c.ChunkNum {
+		return 0, ErrMalformedResponse
+	}
+	hitId := clientQuery.hitId
+	if c.primaryHints[hitId].key != clientQuery.hintKey {
+		return 0, ErrStaleQuery
+	}
+
+	chunkId := clientQuery.chunkId
+	answer := rightParities[chunkId] ^ c.primaryHints[hitId].parity
+	c.cachePut(clientQuery.index, answer)
+
+	c.primaryHints[hitId] = LocalHint{key: refresh.key, parity: leftParities[chunkId] ^ answer, programmedPoint: clientQuery.index, isProgrammed: true}
+	return answer, nil
+}
@@ -0,0 +1,57 @@
+package piano
+
+import (
+	"testing"
+)
+
+func TestTwoServer(t *testing.T) {
+	left, right := NewTwoServerSetup(10000)
+	client := NewClient(left.DBSize)
+	state := client.InitializeTwoServerState(left)
+	if len(state.backupHints) != 0 {
+		t.Fatalf("two-server state has %d backup hints", len(state.backupHints))
+	}
+
+	// more queries than there would be backup hints for a single chunk
+	for q := uint64(0); q < 300; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		refresh := state.PrepareRefresh(query)
+		answer, err := state.RecoverAnswer(query, right.Process(query.Prepare()), refresh, left.Process(refresh.Prepare()))
+		if err != nil {
+			t.Fatalf("RecoverAnswer: %v", err)
+		}
+		if answer != right.Query(query.Index()) {
+			t.Fatalf("index %d: got %d, want %d", query.Index(), answer, right.Query(query.Index()))
+		}
+	}
+
+	// every refreshed hint still recovers correctly
+	recovered := 0
+	for x := uint64(0); x < 200; x++ {
+		if _, ok := state.Cached(x); ok {
+			continue
+		}
+		query, err := state.QueryIndex(x)
+		if err != nil {
+			t.Fatalf("QueryIndex(%d): %v", x, err)
+		}
+		if query.IsDummy() {
+			continue
+		}
+		recovered++
+		refresh := state.PrepareRefresh(query)
+		answer, err := state.RecoverAnswer(query, right.Process(query.Prepare()), refresh, left.Process(refresh.Prepare()))
+		if err != nil {
+			t.Fatalf("RecoverAnswer(%d): %v", x, err)
+		}
+		if answer != right.Query(x) {
+			t.Fatalf("index %d: got %d, want %d", x, answer, right.Query(x))
+		}
+	}
+	if recovered < 100 {
+		t.Fatalf("only %d of 200 indices found a primary hint", recovered)
+	}
+}
@@ -0,0 +1,82 @@
+package piano
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Server32 and ClientState32 are the 32-bit versions of Server and ClientState. They halve the memory of
+// the database, and the parities sent back by the server, but the punctured offset vector, which is the
+// sqrt(DBSize) part of the communication, stays the same. The client keeps its parities in the 64-bit
+// hints of the embedded ClientState, where the upper 32 bits stay 0.
+
+// Server32 is like Server, but every entry is a uint32.
+type Server32 struct {
+	DB        []uint32
+	DBSize    uint64
+	ChunkSize uint64
+	ChunkNum  uint64
+}
+
+// NewServer32 generates a random database with DBSize 32-bit entries. Like NewServer, it panics with
+// ErrEmptyDatabase if DBSize is 0.
+func NewServer32(DBSize uint64) Server32 {
+	ChunkSize, ChunkNum := mustChunkParams(DBSize)
+	// pad the db to ChunkSize*ChunkNum, the padding part is all 0
+	s := Server32{make([]uint32, ChunkSize*ChunkNum), DBSize, ChunkSize, ChunkNum}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := uint64(0); i < DBSize; i++ {
+		s.DB[i] = rng.Uint32()
+	}
+	return s
+}
+
+// Query returns the x-th entry of the database.
+func (s Server32) Query(x uint64) uint32 {
+	return s.DB[x]
+}
+
+// Process answers a punctured offset vector, packed or not, with the ChunkNum possible parities. Like
+// Server.Process, it answers a malformed vector, see Server.CheckOffsetVec, with no parities.
+func (s Server32) Process(offsetVec []uint64) []uint32 {
+	offsetVec, err := checkOffsets(offsetVec, s.ChunkSize, s.ChunkNum)
+	if err != nil {
+		return nil
+	}
+	parities := make([]uint32, s.ChunkNum)
+	for i := uint64(0); i < s.ChunkNum-1; i++ {
+		parities[0] ^= s.DB[(i+1)*s.ChunkSize+offsetVec[i]]
+	}
+	for i := uint64(0); i < s.ChunkNum-1; i++ {
+		parities[i+1] = parities[i] ^ s.DB[(i+1)*s.ChunkSize+offsetVec[i]] ^ s.DB[i*s.ChunkSize+offsetVec[i]]
+	}
+	return parities
+}
+
+// ClientState32 is the client state for a Server32.
+type ClientState32 struct {
+	*ClientState
+}
+
+// InitializeState32 runs the setup phase against a Server32.
+func (c Client) InitializeState32(s Server32) *ClientState32 {
+	state := c.newClientState(s.DBSize, s.ChunkSize, s.ChunkNum, rand.New(rand.NewSource(time.Now().UnixNano())))
+	chunk := make([]uint64, s.ChunkSize)
+	for i := uint64(0); i < s.ChunkNum; i++ {
+		for k := range chunk {
+			chunk[k] = uint64(s.DB[i*s.ChunkSize+uint64(k)])
+		}
+		state.foldChunk(i, chunk)
+	}
+	return &ClientState32{state}
+}
+
+// RecoverAnswer recovers the queried entry from the server's parities like ClientState.RecoverAnswer.
+func (c *ClientState32) RecoverAnswer(clientQuery ClientQuery, serverParities []uint32) (uint32, error) {
+	parities := make([]uint64, len(serverParities))
+	for i, parity := range serverParities {
+		parities[i] = uint64(parity)
+	}
+	answer, err := c.ClientState.RecoverAnswer(clientQuery, parities)
+	return uint32(answer), err
+}
@@ -0,0 +1,25 @@
+package piano
+
+import "testing"
+
+func TestServer32(t *testing.T) {
+	server := NewServer32(10007)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState32(server)
+	for q := uint64(0); q < client.Q; q++ {
+		query, err := state.TryRandomQuery()
+		if err != nil {
+			continue
+		}
+		answer, err := state.RecoverAnswer(query, server.Process(query.Prepare()))
+		if err != nil {
+			t.Fatalf("query %d: %v", q, err)
+		}
+		if answer != server.Query(query.Index()) {
+			t.Fatalf("index %d: got %d, want %d", query.Index(), answer, server.Query(query.Index()))
+		}
+		if cached, ok := state.Cached(query.Index()); !ok || cached != uint64(answer) {
+			t.Fatalf("index %d: cached %d, %v", query.Index(), cached, ok)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package piano
+
+import (
+	"fmt"
+)
+
+// VerifyAgainstPlaintext privately retrieves every index with Retrieve and compares the answer to the
+// plaintext Query of the server. It returns the first failed retrieval or mismatch. It is meant for
+// sanity-checking parameter choices, or a ClientState after LoadClientState, against a known database.
+// It consumes backup hints like any other query.
+func VerifyAgainstPlaintext(clientState *ClientState, server PIRServer, indices []uint64) error {
+	for _, x := range indices {
+		answer, err := clientState.Retrieve(x, server)
+		if err != nil {
+			return fmt.Errorf("index %d: %w", x, err)
+		}
+		if want := server.Query(x); answer != want {
+			return fmt.Errorf("index %d: private answer %d, plaintext %d", x, answer, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package piano
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVerifyAgainstPlaintext(t *testing.T) {
+	server := NewServer(10000)
+	client := NewClient(server.DBSize)
+	state := client.InitializeState(server)
+
+	indices := []uint64{0, 1, 2, 100, 101, 9998, 9999}
+	if err := VerifyAgainstPlaintext(state, server, indices); err != nil {
+		t.Fatalf("VerifyAgainstPlaintext: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := state.Save(&buf); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := LoadClientState(&buf)
+	if err != nil {
+		t.Fatalf("LoadClientState: %v", err)
+	}
+	if err := VerifyAgainstPlaintext(loaded, server, append(indices, 5000, 5001)); err != nil {
+		t.Fatalf("VerifyAgainstPlaintext after LoadClientState: %v", err)
+	}
+
+	// a client of another database fails the check
+	other := NewServer(10000)
+	if err := VerifyAgainstPlaintext(loaded, other, []uint64{42}); err == nil {
+		t.Fatalf("VerifyAgainstPlaintext: expected a mismatch against another database")
+	}
+}
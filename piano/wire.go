@@ -0,0 +1,40 @@
+package piano
+
+import (
+	"fmt"
+
+	pb "example.com/query"
+	"google.golang.org/protobuf/proto"
+)
+
+// The codecs below encode a query and its response with the protobuf messages of query/wire.proto, the
+// contract for clients and servers in other languages.
+
+// MarshalQuery encodes a punctured offset vector, as from ClientQuery.Prepare, and its query id, as from
+// ClientQuery.QueryID, into a PianoQueryMsg.
+func MarshalQuery(queryID uint64, punctOffsetVec []uint64) ([]byte, error) {
+	return proto.Marshal(&pb.PianoQueryMsg{QueryId: queryID, PunctOffsetVec: punctOffsetVec})
+}
+
+// UnmarshalQuery decodes a PianoQueryMsg from MarshalQuery.
+func UnmarshalQuery(b []byte) (queryID uint64, punctOffsetVec []uint64, err error) {
+	var msg pb.PianoQueryMsg
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		return 0, nil, fmt.Errorf("unmarshal query: %w", err)
+	}
+	return msg.QueryId, msg.PunctOffsetVec, nil
+}
+
+// MarshalResponse encodes the parities of Server.ProcessVersioned and the database version into a PianoResponse.
+func MarshalResponse(parities []uint64, version uint64) ([]byte, error) {
+	return proto.Marshal(&pb.PianoResponse{Parities: parities, Version: version})
+}
+
+// UnmarshalResponse decodes a PianoResponse from MarshalResponse, for ClientState.RecoverAnswerVersioned.
+func UnmarshalResponse(b []byte) (parities []uint64, version uint64, err error) {
+	var msg pb.PianoResponse
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		return nil, 0, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return msg.Parities, msg.Version, nil
+}
@@ -0,0 +1,76 @@
+package piano
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWireCodecs(t *testing.T) {
+	server := NewServerWithSeed(10000, 1)
+	state := NewClient(server.DBSize).InitializeStateWithSeed(server, 2)
+	x := uint64(4242)
+	query, err := state.QueryIndex(x)
+	if err != nil || query.IsDummy() {
+		t.Fatalf("QueryIndex(%d): %v", x, err)
+	}
+
+	b, err := MarshalQuery(query.QueryID(), query.Prepare())
+	if err != nil {
+		t.Fatalf("MarshalQuery: %v", err)
+	}
+	id, offsetVec, err := UnmarshalQuery(b)
+	if err != nil || id != query.QueryID() || !reflect.DeepEqual(offsetVec, query.Prepare()) {
+		t.Fatalf("UnmarshalQuery: got id %d, %v, want id %d", id, err, query.QueryID())
+	}
+
+	b, err = MarshalResponse(server.ProcessVersioned(offsetVec))
+	if err != nil {
+		t.Fatalf("MarshalResponse: %v", err)
+	}
+	parities, version, err := UnmarshalResponse(b)
+	if err != nil {
+		t.Fatalf("UnmarshalResponse: %v", err)
+	}
+	if answer, err := state.RecoverAnswerByID(id, parities); err != nil || answer != server.Query(x) || version != server.Version {
+		t.Fatalf("RecoverAnswerByID: got %d, %v, version %d, want %d", answer, err, version, server.Query(x))
+	}
+
+	if _, _, err := UnmarshalQuery([]byte{0xff}); err == nil {
+		t.Fatalf("UnmarshalQuery: expected an error for malformed input")
+	}
+	if _, _, err := UnmarshalResponse([]byte{0x0a, 0x05, 0x01}); err == nil {
+		t.Fatalf("UnmarshalResponse: expected an error for malformed input")
+	}
+}
+
+// TestWireGolden pins the wire format: a change here breaks clients in other languages.
+func TestWireGolden(t *testing.T) {
+	b, err := MarshalQuery(7, []uint64{3, 300, 0})
+	if err != nil {
+		t.Fatalf("MarshalQuery: %v", err)
+	}
+	// field 1 varint 7, field 2 packed varints 3, 300, 0
+	if want := []byte{0x08, 0x07, 0x12, 0x04, 0x03, 0xac, 0x02, 0x00}; !bytes.Equal(b, want) {
+		t.Fatalf("MarshalQuery: got % x, want % x", b, want)
+	}
+
+	b, err = MarshalResponse([]uint64{1, 1 << 63}, 2)
+	if err != nil {
+		t.Fatalf("MarshalResponse: %v", err)
+	}
+	// field 1 packed varints 1, 1<<63, field 2 varint 2
+	want := []byte{0x0a, 0x0b, 0x01, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01, 0x10, 0x02}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("MarshalResponse: got % x, want % x", b, want)
+	}
+	parities, version, err := UnmarshalResponse(want)
+	if err != nil || !reflect.DeepEqual(parities, []uint64{1, 1 << 63}) || version != 2 {
+		t.Fatalf("UnmarshalResponse: got %v, %d, %v", parities, version, err)
+	}
+
+	// a query id of 0 and no offsets, for a single chunk, encode to nothing
+	if b, err := MarshalQuery(0, nil); err != nil || len(b) != 0 {
+		t.Fatalf("MarshalQuery(0, nil): got % x, %v", b, err)
+	}
+}
@@ -1 +1 @@
-protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative query/query.proto
\ No newline at end of file
+protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative query/query.proto query/wire.proto
\ No newline at end of file
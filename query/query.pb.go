@@ -486,6 +486,10 @@ type DBChunk struct {
 	ChunkId   uint64   `protobuf:"varint,1,opt,name=ChunkId,proto3" json:"ChunkId,omitempty"`
 	ChunkSize uint64   `protobuf:"varint,2,opt,name=ChunkSize,proto3" json:"ChunkSize,omitempty"`
 	Chunk     []uint64 `protobuf:"varint,3,rep,packed,name=Chunk,proto3" json:"Chunk,omitempty"` // For every DBEntrySize/8 uint64s, we have one complete guesses
+	// The chunk boundaries of a database with chunks of different sizes, empty for chunks of ChunkSize entries
+	Boundaries []uint64 `protobuf:"varint,4,rep,packed,name=Boundaries,proto3" json:"Boundaries,omitempty"`
+	// The version of the database
+	Version uint64 `protobuf:"varint,5,opt,name=Version,proto3" json:"Version,omitempty"`
 }
 
 func (x *DBChunk) Reset() {
@@ -541,6 +545,20 @@ func (x *DBChunk) GetChunk() []uint64 {
 	return nil
 }
 
+func (x *DBChunk) GetBoundaries() []uint64 {
+	if x != nil {
+		return x.Boundaries
+	}
+	return nil
+}
+
+func (x *DBChunk) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
 var File_query_query_proto protoreflect.FileDescriptor
 
 var file_query_query_proto_rawDesc = []byte{
@@ -581,38 +599,41 @@ var file_query_query_proto_rawDesc = []byte{
 	0x47, 0x75, 0x65, 0x73, 0x73, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x04, 0x52, 0x07, 0x47,
 	0x75, 0x65, 0x73, 0x73, 0x65, 0x73, 0x22, 0x26, 0x0a, 0x0e, 0x46, 0x65, 0x74, 0x63, 0x68, 0x46,
 	0x75, 0x6c, 0x6c, 0x44, 0x42, 0x4d, 0x73, 0x67, 0x12, 0x14, 0x0a, 0x05, 0x44, 0x75, 0x6d, 0x6d,
-	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x44, 0x75, 0x6d, 0x6d, 0x79, 0x22, 0x57,
-	0x0a, 0x07, 0x44, 0x42, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x12, 0x18, 0x0a, 0x07, 0x43, 0x68, 0x75,
-	0x6e, 0x6b, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x43, 0x68, 0x75, 0x6e,
-	0x6b, 0x49, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x69, 0x7a, 0x65,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x69, 0x7a,
-	0x65, 0x12, 0x14, 0x0a, 0x05, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x18, 0x03, 0x20, 0x03, 0x28, 0x04,
-	0x52, 0x05, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x32, 0xee, 0x02, 0x0a, 0x0c, 0x51, 0x75, 0x65, 0x72,
-	0x79, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x46, 0x0a, 0x0e, 0x50, 0x6c, 0x61, 0x69,
-	0x6e, 0x74, 0x65, 0x78, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x18, 0x2e, 0x71, 0x75, 0x65,
-	0x72, 0x79, 0x2e, 0x50, 0x6c, 0x61, 0x69, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x51, 0x75, 0x65, 0x72,
-	0x79, 0x4d, 0x73, 0x67, 0x1a, 0x18, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x50, 0x6c, 0x61,
-	0x69, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00,
-	0x12, 0x40, 0x0a, 0x0c, 0x46, 0x75, 0x6c, 0x6c, 0x53, 0x65, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79,
-	0x12, 0x16, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x46, 0x75, 0x6c, 0x6c, 0x53, 0x65, 0x74,
-	0x51, 0x75, 0x65, 0x72, 0x79, 0x4d, 0x73, 0x67, 0x1a, 0x16, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79,
-	0x2e, 0x46, 0x75, 0x6c, 0x6c, 0x53, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x22, 0x00, 0x12, 0x43, 0x0a, 0x0d, 0x50, 0x75, 0x6e, 0x63, 0x74, 0x53, 0x65, 0x74, 0x51, 0x75,
-	0x65, 0x72, 0x79, 0x12, 0x17, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x50, 0x75, 0x6e, 0x63,
-	0x74, 0x53, 0x65, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79, 0x4d, 0x73, 0x67, 0x1a, 0x17, 0x2e, 0x71,
-	0x75, 0x65, 0x72, 0x79, 0x2e, 0x50, 0x75, 0x6e, 0x63, 0x74, 0x53, 0x65, 0x74, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x55, 0x0a, 0x13, 0x42, 0x61, 0x74, 0x63, 0x68,
-	0x65, 0x64, 0x46, 0x75, 0x6c, 0x6c, 0x53, 0x65, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x1d,
-	0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x65, 0x64, 0x46, 0x75,
-	0x6c, 0x6c, 0x53, 0x65, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79, 0x4d, 0x73, 0x67, 0x1a, 0x1d, 0x2e,
-	0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x65, 0x64, 0x46, 0x75, 0x6c,
-	0x6c, 0x53, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x38,
-	0x0a, 0x0b, 0x46, 0x65, 0x74, 0x63, 0x68, 0x46, 0x75, 0x6c, 0x6c, 0x44, 0x42, 0x12, 0x15, 0x2e,
-	0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x46, 0x65, 0x74, 0x63, 0x68, 0x46, 0x75, 0x6c, 0x6c, 0x44,
-	0x42, 0x4d, 0x73, 0x67, 0x1a, 0x0e, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x44, 0x42, 0x43,
-	0x68, 0x75, 0x6e, 0x6b, 0x22, 0x00, 0x30, 0x01, 0x42, 0x13, 0x5a, 0x11, 0x65, 0x78, 0x61, 0x6d,
-	0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x62, 0x06, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x44, 0x75, 0x6d, 0x6d, 0x79, 0x22, 0x91,
+	0x01, 0x0a, 0x07, 0x44, 0x42, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x12, 0x18, 0x0a, 0x07, 0x43, 0x68,
+	0x75, 0x6e, 0x6b, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x43, 0x68, 0x75,
+	0x6e, 0x6b, 0x49, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x69, 0x7a,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x69,
+	0x7a, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x18, 0x03, 0x20, 0x03, 0x28,
+	0x04, 0x52, 0x05, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x12, 0x1e, 0x0a, 0x0a, 0x42, 0x6f, 0x75, 0x6e,
+	0x64, 0x61, 0x72, 0x69, 0x65, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x04, 0x52, 0x0a, 0x42, 0x6f,
+	0x75, 0x6e, 0x64, 0x61, 0x72, 0x69, 0x65, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x56, 0x65, 0x72, 0x73,
+	0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x56, 0x65, 0x72, 0x73, 0x69,
+	0x6f, 0x6e, 0x32, 0xee, 0x02, 0x0a, 0x0c, 0x51, 0x75, 0x65, 0x72, 0x79, 0x53, 0x65, 0x72, 0x76,
+	0x69, 0x63, 0x65, 0x12, 0x46, 0x0a, 0x0e, 0x50, 0x6c, 0x61, 0x69, 0x6e, 0x74, 0x65, 0x78, 0x74,
+	0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x18, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x50, 0x6c,
+	0x61, 0x69, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79, 0x4d, 0x73, 0x67, 0x1a,
+	0x18, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x50, 0x6c, 0x61, 0x69, 0x6e, 0x74, 0x65, 0x78,
+	0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x40, 0x0a, 0x0c, 0x46,
+	0x75, 0x6c, 0x6c, 0x53, 0x65, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x16, 0x2e, 0x71, 0x75,
+	0x65, 0x72, 0x79, 0x2e, 0x46, 0x75, 0x6c, 0x6c, 0x53, 0x65, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79,
+	0x4d, 0x73, 0x67, 0x1a, 0x16, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x46, 0x75, 0x6c, 0x6c,
+	0x53, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x43, 0x0a,
+	0x0d, 0x50, 0x75, 0x6e, 0x63, 0x74, 0x53, 0x65, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x17,
+	0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x50, 0x75, 0x6e, 0x63, 0x74, 0x53, 0x65, 0x74, 0x51,
+	0x75, 0x65, 0x72, 0x79, 0x4d, 0x73, 0x67, 0x1a, 0x17, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e,
+	0x50, 0x75, 0x6e, 0x63, 0x74, 0x53, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x22, 0x00, 0x12, 0x55, 0x0a, 0x13, 0x42, 0x61, 0x74, 0x63, 0x68, 0x65, 0x64, 0x46, 0x75, 0x6c,
+	0x6c, 0x53, 0x65, 0x74, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x1d, 0x2e, 0x71, 0x75, 0x65, 0x72,
+	0x79, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x65, 0x64, 0x46, 0x75, 0x6c, 0x6c, 0x53, 0x65, 0x74,
+	0x51, 0x75, 0x65, 0x72, 0x79, 0x4d, 0x73, 0x67, 0x1a, 0x1d, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79,
+	0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x65, 0x64, 0x46, 0x75, 0x6c, 0x6c, 0x53, 0x65, 0x74, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x38, 0x0a, 0x0b, 0x46, 0x65, 0x74,
+	0x63, 0x68, 0x46, 0x75, 0x6c, 0x6c, 0x44, 0x42, 0x12, 0x15, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79,
+	0x2e, 0x46, 0x65, 0x74, 0x63, 0x68, 0x46, 0x75, 0x6c, 0x6c, 0x44, 0x42, 0x4d, 0x73, 0x67, 0x1a,
+	0x0e, 0x2e, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x44, 0x42, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x22,
+	0x00, 0x30, 0x01, 0x42, 0x13, 0x5a, 0x11, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63,
+	0x6f, 0x6d, 0x2f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -0,0 +1,228 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        v3.21.12
+// source: query/wire.proto
+
+package query
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PianoQueryMsg struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	QueryId uint64 `protobuf:"varint,1,opt,name=QueryId,proto3" json:"QueryId,omitempty"`
+	// the offsets of the query's set in every chunk but the punctured one, ChunkNum-1 in total
+	PunctOffsetVec []uint64 `protobuf:"varint,2,rep,packed,name=PunctOffsetVec,proto3" json:"PunctOffsetVec,omitempty"`
+}
+
+func (x *PianoQueryMsg) Reset() {
+	*x = PianoQueryMsg{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_query_wire_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PianoQueryMsg) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PianoQueryMsg) ProtoMessage() {}
+
+func (x *PianoQueryMsg) ProtoReflect() protoreflect.Message {
+	mi := &file_query_wire_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PianoQueryMsg.ProtoReflect.Descriptor instead.
+func (*PianoQueryMsg) Descriptor() ([]byte, []int) {
+	return file_query_wire_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PianoQueryMsg) GetQueryId() uint64 {
+	if x != nil {
+		return x.QueryId
+	}
+	return 0
+}
+
+func (x *PianoQueryMsg) GetPunctOffsetVec() []uint64 {
+	if x != nil {
+		return x.PunctOffsetVec
+	}
+	return nil
+}
+
+type PianoResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the ChunkNum possible parities, one per guess of the punctured chunk
+	Parities []uint64 `protobuf:"varint,1,rep,packed,name=Parities,proto3" json:"Parities,omitempty"`
+	// the version of the database the parities were computed from
+	Version uint64 `protobuf:"varint,2,opt,name=Version,proto3" json:"Version,omitempty"`
+}
+
+func (x *PianoResponse) Reset() {
+	*x = PianoResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_query_wire_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PianoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PianoResponse) ProtoMessage() {}
+
+func (x *PianoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_query_wire_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PianoResponse.ProtoReflect.Descriptor instead.
+func (*PianoResponse) Descriptor() ([]byte, []int) {
+	return file_query_wire_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PianoResponse) GetParities() []uint64 {
+	if x != nil {
+		return x.Parities
+	}
+	return nil
+}
+
+func (x *PianoResponse) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+var File_query_wire_proto protoreflect.FileDescriptor
+
+var file_query_wire_proto_rawDesc = []byte{
+	0x0a, 0x10, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2f, 0x77, 0x69, 0x72, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x22, 0x51, 0x0a, 0x0d, 0x50, 0x69, 0x61,
+	0x6e, 0x6f, 0x51, 0x75, 0x65, 0x72, 0x79, 0x4d, 0x73, 0x67, 0x12, 0x18, 0x0a, 0x07, 0x51, 0x75,
+	0x65, 0x72, 0x79, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x51, 0x75, 0x65,
+	0x72, 0x79, 0x49, 0x64, 0x12, 0x26, 0x0a, 0x0e, 0x50, 0x75, 0x6e, 0x63, 0x74, 0x4f, 0x66, 0x66,
+	0x73, 0x65, 0x74, 0x56, 0x65, 0x63, 0x18, 0x02, 0x20, 0x03, 0x28, 0x04, 0x52, 0x0e, 0x50, 0x75,
+	0x6e, 0x63, 0x74, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x56, 0x65, 0x63, 0x22, 0x45, 0x0a, 0x0d,
+	0x50, 0x69, 0x61, 0x6e, 0x6f, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1a, 0x0a,
+	0x08, 0x50, 0x61, 0x72, 0x69, 0x74, 0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x04, 0x52,
+	0x08, 0x50, 0x61, 0x72, 0x69, 0x74, 0x69, 0x65, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x56, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x56, 0x65, 0x72, 0x73,
+	0x69, 0x6f, 0x6e, 0x42, 0x13, 0x5a, 0x11, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63,
+	0x6f, 0x6d, 0x2f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_query_wire_proto_rawDescOnce sync.Once
+	file_query_wire_proto_rawDescData = file_query_wire_proto_rawDesc
+)
+
+func file_query_wire_proto_rawDescGZIP() []byte {
+	file_query_wire_proto_rawDescOnce.Do(func() {
+		file_query_wire_proto_rawDescData = protoimpl.X.CompressGZIP(file_query_wire_proto_rawDescData)
+	})
+	return file_query_wire_proto_rawDescData
+}
+
+var file_query_wire_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_query_wire_proto_goTypes = []interface{}{
+	(*PianoQueryMsg)(nil), // 0: query.PianoQueryMsg
+	(*PianoResponse)(nil), // 1: query.PianoResponse
+}
+var file_query_wire_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_query_wire_proto_init() }
+func file_query_wire_proto_init() {
+	if File_query_wire_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_query_wire_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PianoQueryMsg); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_query_wire_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PianoResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_query_wire_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_query_wire_proto_goTypes,
+		DependencyIndexes: file_query_wire_proto_depIdxs,
+		MessageInfos:      file_query_wire_proto_msgTypes,
+	}.Build()
+	File_query_wire_proto = out.File
+	file_query_wire_proto_rawDesc = nil
+	file_query_wire_proto_goTypes = nil
+	file_query_wire_proto_depIdxs = nil
+}
@@ -1,8 +1,13 @@
 package util
 
 import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
 	"fmt"
 	"log"
+	"math"
+	"math/bits"
 	"math/rand"
 	"testing"
 	"time"
@@ -119,6 +124,102 @@ func TestAESPRF128(t *testing.T) {
 	fmt.Printf("AES Average time: %v\n", duration/10000000)
 }
 
+func TestNewCipherMatchesAES(t *testing.T) {
+	for _, key := range []uint64{0, 1, 0x0123456789abcdef, math.MaxUint64} {
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatalf("NewCipher(%#x): %v", key, err)
+		}
+		if len(c.enc) != 11*4 {
+			t.Fatalf("NewCipher(%#x): key schedule of %d words, want %d", key, len(c.enc), 11*4)
+		}
+		k := make([]byte, 16)
+		binary.LittleEndian.PutUint64(k, key)
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			t.Fatalf("aes.NewCipher: %v", err)
+		}
+		src := []byte("0123456789abcdef")
+		got, want := make([]byte, 16), make([]byte, 16)
+		c.Encrypt(got, src)
+		block.Encrypt(want, src)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("NewCipher(%#x): Encrypt gives %x, crypto/aes %x", key, got, want)
+		}
+	}
+}
+
+func TestAESPrfMatchesPRFEval(t *testing.T) {
+	prf, err := NewAESPrf()
+	if err != nil {
+		t.Fatalf("NewAESPrf: %v", err)
+	}
+	key := prf.Key()
+	for x := uint64(0); x < 1000; x++ {
+		if prf.Eval(x) != PRFEval(&key, x) {
+			t.Fatalf("Eval(%d) differs from PRFEval", x)
+		}
+	}
+}
+
+func TestAESPrfUniform(t *testing.T) {
+	prf, err := NewAESPrf()
+	if err != nil {
+		t.Fatalf("NewAESPrf: %v", err)
+	}
+	const chunkSize = 100
+	const chunkNum = 100000
+	counts := make([]float64, chunkSize)
+	for chunkId := uint64(0); chunkId < chunkNum; chunkId++ {
+		counts[prf.Eval(chunkId)%chunkSize]++
+	}
+
+	// chi-square statistic with chunkSize-1 = 99 degrees of freedom, mean 99 and standard deviation ~14
+	expected := float64(chunkNum) / chunkSize
+	chi2 := 0.0
+	for _, c := range counts {
+		chi2 += (c - expected) * (c - expected) / expected
+	}
+	if chi2 > 200 {
+		t.Fatalf("offsets are not uniform: chi-square %v", chi2)
+	}
+}
+
+func BenchmarkAESPrfEval(b *testing.B) {
+	prf, err := NewAESPrf()
+	if err != nil {
+		b.Fatalf("NewAESPrf: %v", err)
+	}
+	add := uint64(0)
+	for i := 0; i < b.N; i++ {
+		add += prf.Eval(uint64(i))
+	}
+	_ = add
+}
+
+func TestPackOffsets(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, chunkSize := range []uint64{1, 2, 3, 1000, 1 << 20, 1<<40 + 1} {
+		width := OffsetBits(chunkSize)
+		for _, n := range []int{0, 1, 7, 999} {
+			offsets := make([]uint64, n)
+			for i := range offsets {
+				offsets[i] = rng.Uint64() % chunkSize
+			}
+			packed := PackOffsets(offsets, width)
+			if want := (n*int(width) + 63) / 64; len(packed) != want {
+				t.Fatalf("chunk size %d, %d offsets: packed into %d words, want %d", chunkSize, n, len(packed), want)
+			}
+			unpacked := UnpackOffsets(packed, width, n)
+			for i := range offsets {
+				if unpacked[i] != offsets[i] {
+					t.Fatalf("chunk size %d, offset %d: got %d, want %d", chunkSize, i, unpacked[i], offsets[i])
+				}
+			}
+		}
+	}
+}
+
 func testDebugAES(test *testing.T) {
 	var prfkeyL = []byte{36, 156, 50, 234, 92, 230, 49, 9, 174, 170, 205, 160, 98, 236, 29, 243}
 	var prfkeyR = []byte{209, 12, 199, 173, 29, 74, 44, 128, 194, 224, 14, 44, 2, 201, 110, 28}
@@ -157,3 +258,112 @@ func main() {
 		}
 	*/
 }
+
+func TestPRFEvalRange(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	key := RandKey(rng)
+	out := make([]uint64, 100)
+	PRFEvalRange(&key, out)
+	for x, y := range out {
+		if want := PRFEval(&key, uint64(x)); y != want {
+			t.Fatalf("PRFEvalRange at %d: got %d, want %d", x, y, want)
+		}
+	}
+}
+
+func TestPRFEvalDeterministic(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for k := 0; k < 8; k++ {
+		key := RandKey(rng)
+		other := RandKey(rng)
+		same := 0
+		for x := uint64(0); x < 1000; x++ {
+			if PRFEval(&key, x) != PRFEval(&key, x) {
+				t.Fatalf("key %d: PRFEval(%d) is not deterministic", k, x)
+			}
+			copied := key
+			if PRFEval(&copied, x) != PRFEval(&key, x) {
+				t.Fatalf("key %d: PRFEval(%d) differs for a copy of the key", k, x)
+			}
+			if PRFEval(&other, x) == PRFEval(&key, x) {
+				same++
+			}
+		}
+		if same > 1 {
+			t.Fatalf("key %d: %d of 1000 outputs equal those of another key", k, same)
+		}
+	}
+}
+
+func TestPRFEvalAvalanche(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for k := 0; k < 8; k++ {
+		key := RandKey(rng)
+		flipped, trials := 0, 0
+		for i := 0; i < 100; i++ {
+			x := rng.Uint64()
+			y := PRFEval(&key, x)
+			for bit := uint(0); bit < 64; bit++ {
+				flipped += bits.OnesCount64(y ^ PRFEval(&key, x^1<<bit))
+				trials++
+			}
+		}
+		// 6400 trials of 64 fair bits have a mean of 32 with a standard deviation of 0.05
+		if mean := float64(flipped) / float64(trials); mean < 31.5 || mean > 32.5 {
+			t.Fatalf("key %d: flipping an input bit flips %.2f output bits on average, want about 32", k, mean)
+		}
+	}
+}
+
+func TestPRFEvalSHA256(t *testing.T) {
+	var key PrfKey
+	for i := range key {
+		key[i] = byte(i)
+	}
+	// the first 8 bytes of SHA-256 over the key and x, computed independently
+	for x, want := range map[uint64]uint64{0: 4796346890389587585, 1: 12074235244615009508, 12345: 14507944606175675987} {
+		if got := PRFEvalSHA256(&key, x); got != want {
+			t.Fatalf("PRFEvalSHA256(%d) = %d, want %d", x, got, want)
+		}
+	}
+}
+
+func BenchmarkPRFEval(b *testing.B) {
+	key := RandKey(rand.New(rand.NewSource(4)))
+	add := uint64(0)
+	for i := 0; i < b.N; i++ {
+		add += PRFEval(&key, uint64(i))
+	}
+	_ = add
+}
+
+func TestPackEntries(t *testing.T) {
+	for _, f := range []float64{0, math.Copysign(0, -1), 1.5, -2.25e-300, math.MaxFloat64, math.Inf(-1), math.SmallestNonzeroFloat64} {
+		if got := UnpackFloat64(PackFloat64(f)); got != f || math.Signbit(got) != math.Signbit(f) {
+			t.Fatalf("float64 %v: got %v after the round trip", f, got)
+		}
+	}
+	if got := UnpackFloat64(PackFloat64(math.NaN())); !math.IsNaN(got) {
+		t.Fatalf("NaN: got %v after the round trip", got)
+	}
+
+	rng := rand.New(rand.NewSource(5))
+	for i := 0; i < 1000; i++ {
+		hi, lo := rng.Uint32(), rng.Uint32()
+		if gotHi, gotLo := UnpackUint32Pair(PackUint32Pair(hi, lo)); gotHi != hi || gotLo != lo {
+			t.Fatalf("uint32 pair %d, %d: got %d, %d after the round trip", hi, lo, gotHi, gotLo)
+		}
+		n := int64(rng.Uint64())
+		if got := UnpackInt64(PackInt64(n)); got != n {
+			t.Fatalf("int64 %d: got %d after the round trip", n, got)
+		}
+	}
+	if PackUint32Pair(1, 2) != 1<<32|2 {
+		t.Fatalf("PackUint32Pair(1, 2) = %#x", PackUint32Pair(1, 2))
+	}
+
+	b := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	if PackBytes(b) != 0x0807060504030201 || UnpackBytes(PackBytes(b)) != b {
+		t.Fatalf("bytes %v: packed into %#x", b, PackBytes(b))
+	}
+}
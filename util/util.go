@@ -1,9 +1,11 @@
 package util
 
 import (
-	//"crypto/sha256"
+	crand "crypto/rand"
+	"crypto/sha256"
 	"hash/fnv"
 	"math"
+	"math/bits"
 
 	// "fmt"
 	//////////////////"io"
@@ -29,6 +31,10 @@ type PrfKey128 [16]byte
 type block [16]byte
 type DBEntry [DBEntryLength]uint64
 
+// PrfKey is the key of the PRF used for the hints: the 16 bytes of an AES-128 key, in the order they
+// are passed to the AES key expansion. PRFEval(key, x) encrypts the block holding x in little-endian
+// order followed by 8 zero bytes, XORs the block into the ciphertext (Matyas-Meyer-Oseas) and returns
+// the first 8 bytes of the result in little-endian order.
 type PrfKey PrfKey128
 
 func RandKey256(rng *rand.Rand) PrfKey256 {
@@ -57,6 +63,29 @@ func PRFEval(key *PrfKey, x uint64) uint64 {
 	return PRFEval4((*PrfKey128)(key), x)
 }
 
+// PRFEvalSHA256 is a PRF on the same keys as PRFEval: it returns the first 8 bytes, in little-endian order,
+// of the SHA-256 hash of the key followed by x in little-endian order. It is slower than PRFEval, but does
+// not depend on the AES instructions of the assembly.
+func PRFEvalSHA256(key *PrfKey, x uint64) uint64 {
+	var buf [24]byte
+	copy(buf[:16], key[:])
+	binary.LittleEndian.PutUint64(buf[16:], x)
+	sum := sha256.Sum256(buf[:])
+	return binary.LittleEndian.Uint64(sum[:8])
+}
+
+// PRFEvalRange sets out[x] to PRFEval(key, x) for every x < len(out), expanding the key schedule only once.
+func PRFEvalRange(key *PrfKey, out []uint64) {
+	longKey := make([]uint32, 11*4)
+	expandKeyAsm(&key[0], &longKey[0])
+	var src, dst block
+	for x := range out {
+		binary.LittleEndian.PutUint64(src[:], uint64(x))
+		aes128MMO(&longKey[0], &dst[0], &src[0])
+		out[x] = binary.LittleEndian.Uint64(dst[:])
+	}
+}
+
 func DBEntryXor(dst *DBEntry, src *DBEntry) {
 	for i := 0; i < DBEntryLength; i++ {
 		(*dst)[i] ^= (*src)[i]
@@ -128,6 +157,7 @@ func GenParams(DBSize uint64) (uint64, uint64) {
 type AesPrf struct {
 	// block cipher.Block
 	enc []uint32
+	key PrfKey
 }
 
 func xor16(dst, a, b *byte)
@@ -138,8 +168,9 @@ func expandKeyAsm(key *byte, enc *uint32)
 func NewCipher(key uint64) (*AesPrf, error) {
 	k := make([]byte, 16)
 	binary.LittleEndian.PutUint64(k, key)
-	// n := 11*4
-	c := AesPrf{make([]uint32, 4)}
+	// expandKeyAsm writes the whole AES-128 key schedule, 11 round keys of 4 words each
+	c := AesPrf{enc: make([]uint32, 11*4)}
+	copy(c.key[:], k)
 	expandKeyAsm(&k[0], &c.enc[0])
 	// fmt.Println("NEW CIPHER")
 	// fmt.Println(k)
@@ -151,6 +182,31 @@ func (c *AesPrf) Encrypt(dst, src []byte) {
 	encryptAes128(&c.enc[0], &dst[0], &src[0])
 }
 
+// NewAESPrf samples a PrfKey from crypto/rand and expands its AES-128 key schedule once.
+// Eval(x) equals PRFEval on Key() and x, so hints keyed with Key() work unchanged.
+func NewAESPrf() (*AesPrf, error) {
+	var key PrfKey
+	if _, err := crand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	c := AesPrf{enc: make([]uint32, 11*4), key: key}
+	expandKeyAsm(&key[0], &c.enc[0])
+	return &c, nil
+}
+
+// Key returns the PRF key.
+func (c *AesPrf) Key() PrfKey {
+	return c.key
+}
+
+// Eval evaluates the PRF on x with a single AES-128 block in MMO mode.
+func (c *AesPrf) Eval(x uint64) uint64 {
+	var src, dst block
+	binary.LittleEndian.PutUint64(src[:], x)
+	aes128MMO(&c.enc[0], &dst[0], &src[0])
+	return binary.LittleEndian.Uint64(dst[:])
+}
+
 func DefaultHash(key uint64) uint64 {
 	hash := fnv.New64a()
 	b := make([]byte, 8)
@@ -226,3 +282,93 @@ func (p *PRSet) MembTest(id uint64, SetSize uint64, ChunkSize uint64) bool {
 	offset := tmp & (ChunkSize - 1)
 	return ChunkOffset == offset
 }
+
+// OffsetBits returns the number of bits needed for an offset smaller than ChunkSize, ceil(log2(ChunkSize)).
+func OffsetBits(ChunkSize uint64) uint {
+	if ChunkSize <= 1 {
+		return 0
+	}
+	return uint(bits.Len64(ChunkSize - 1))
+}
+
+// PackOffsets packs offsets of width bits each into 64-bit words, lowest bits first.
+// Every offset must be smaller than 1<<width.
+func PackOffsets(offsets []uint64, width uint) []uint64 {
+	packed := make([]uint64, (uint64(len(offsets))*uint64(width)+63)/64)
+	if width == 0 {
+		return packed
+	}
+	pos := uint64(0)
+	for _, offset := range offsets {
+		word, shift := pos/64, pos%64
+		packed[word] |= offset << shift
+		if shift+uint64(width) > 64 {
+			packed[word+1] |= offset >> (64 - shift)
+		}
+		pos += uint64(width)
+	}
+	return packed
+}
+
+// UnpackOffsets reverses PackOffsets, returning the first n offsets of width bits each.
+func UnpackOffsets(packed []uint64, width uint, n int) []uint64 {
+	offsets := make([]uint64, n)
+	if width == 0 {
+		return offsets
+	}
+	mask := ^uint64(0) >> (64 - width)
+	pos := uint64(0)
+	for i := range offsets {
+		word, shift := pos/64, pos%64
+		offset := packed[word] >> shift
+		if shift+uint64(width) > 64 {
+			offset |= packed[word+1] << (64 - shift)
+		}
+		offsets[i] = offset & mask
+		pos += uint64(width)
+	}
+	return offsets
+}
+
+// PackFloat64 stores f in a uint64 entry, bit for bit, so that a retrieved entry can be read as a float64.
+func PackFloat64(f float64) uint64 {
+	return math.Float64bits(f)
+}
+
+// UnpackFloat64 reverses PackFloat64.
+func UnpackFloat64(entry uint64) float64 {
+	return math.Float64frombits(entry)
+}
+
+// PackInt64 stores i in a uint64 entry in two's complement.
+func PackInt64(i int64) uint64 {
+	return uint64(i)
+}
+
+// UnpackInt64 reverses PackInt64.
+func UnpackInt64(entry uint64) int64 {
+	return int64(entry)
+}
+
+// PackUint32Pair stores hi in the upper and lo in the lower 32 bits of a uint64 entry.
+func PackUint32Pair(hi, lo uint32) uint64 {
+	return uint64(hi)<<32 | uint64(lo)
+}
+
+// UnpackUint32Pair reverses PackUint32Pair.
+func UnpackUint32Pair(entry uint64) (hi, lo uint32) {
+	return uint32(entry >> 32), uint32(entry)
+}
+
+// PackBytes stores an 8-byte payload in a uint64 entry in little-endian order, as NewServerFromReader reads
+// it from a file.
+func PackBytes(b [8]byte) uint64 {
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+// UnpackBytes reverses PackBytes.
+func UnpackBytes(entry uint64) [8]byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], entry)
+	return b
+}